@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/go-pkgz/lgr"
@@ -13,6 +14,7 @@ import (
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 	"github.com/zwergpro/pg-chisel/pkg/chisel/strategies"
 	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
 	"github.com/zwergpro/pg-chisel/pkg/contrib/fs"
 	"github.com/zwergpro/pg-chisel/pkg/dump"
 )
@@ -24,6 +26,12 @@ var opts struct {
 	Dbg         bool   `long:"dbg" description:"Debug mode"`
 	Config      string `short:"c" long:"config" description:"Config file" default:"chisel.yml"`
 	CheckConfig bool   `long:"check-config" description:"Check config file"`
+	DryRun      bool   `long:"dry-run" description:"Run tasks without writing and print their stats"`
+	Jobs        int    `short:"j" long:"jobs" description:"Number of concurrent tasks" default:"1"`
+	Workers     int    `short:"w" long:"workers" description:"Number of workers per table" default:"1"`
+	Report      string `long:"report" description:"Write the JSON run report to the file"`
+	Resume      bool   `long:"resume" description:"Skip the tasks completed by the failed run"`
+	SecretsFile string `long:"secrets-file" env:"CHISEL_SECRETS_FILE" description:"Secrets file"`
 	Version     bool   `short:"V" long:"version" description:"show version"`
 }
 
@@ -62,37 +70,211 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("config parse error: %w", err)
 	}
+	if opts.SecretsFile != "" {
+		if err = cel_extensions.LoadSecretsFile(opts.SecretsFile); err != nil {
+			return err
+		}
+	}
 	if opts.CheckConfig {
-		log.Printf("[INFO] Config file correct!")
-		return nil
+		return checkConfig(conf)
 	}
 
 	log.Printf("[INFO] Source dir: %s", conf.Source)
 	log.Printf("[INFO] Destination dir: %s", conf.Destination)
 
+	if opts.Resume && opts.DryRun {
+		return errors.New("resume can not be combined with dry run")
+	}
+
+	// The directory destination is written only once every task succeeded.
+	// Completed tasks are journaled, so a failed run keeps them to be resumed.
+	var staged *dump.StagedDestination
+	var journal *strategies.Journal
+	var strategyOpts []strategies.StrategyOption
+	if !opts.DryRun {
+		if staged, err = dump.StageDestination(conf, opts.Resume); err != nil {
+			return err
+		}
+		defer func() {
+			if journal != nil && journal.Completed() > 0 {
+				staged.Keep()
+				log.Printf("[INFO] Completed tasks are journaled, run with --resume to skip them")
+			}
+			if err := staged.Abort(); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		}()
+
+		if conf.Format == config.DIRECTORY_FORMAT {
+			if journal, err = strategies.OpenJournal(conf.Destination, opts.Resume); err != nil {
+				return err
+			}
+			strategyOpts = append(strategyOpts, strategies.WithJournal(journal))
+		}
+	}
+
 	dbDump, err := dump.LoadDump(conf)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err := dbDump.Close(); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+	}()
 
-	globalStorage, err := storage.NewMapStringStorage(conf.Storage)
+	if opts.DryRun {
+		log.Printf("[INFO] Dry run, the destination is not written")
+		dbDump.DiscardWrites()
+	}
+
+	globalStorage, closeStorage, err := newStorage(conf)
 	if err != nil {
 		return err
 	}
+	defer closeStorage()
 
-	strategy, err := strategies.BuildConsistentStrategy(conf, dbDump, globalStorage)
+	strategy, err := buildStrategy(conf, dbDump, globalStorage, strategyOpts...)
 	if err != nil {
 		return err
 	}
 
+	startedAt := time.Now()
 	if err = strategy.Execute(); err != nil {
 		return err
 	}
 
+	if opts.DryRun {
+		printTaskStats(os.Stdout, strategy.Stats())
+	} else {
+		if err = dump.SaveDump(conf, dbDump); err != nil {
+			return fmt.Errorf("dump save error: %w", err)
+		}
+		// the journal is kept until the commit, so a failed commit can be resumed
+		if err = staged.Commit(); err != nil {
+			return fmt.Errorf("destination commit error: %w", err)
+		}
+		if journal != nil {
+			journal.MoveTo(conf.Destination)
+			if err = journal.Remove(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.Report != "" {
+		report := newRunReport(conf, startedAt, opts.DryRun, strategy.Stats())
+		if err = writeReport(opts.Report, report); err != nil {
+			return fmt.Errorf("report write error: %w", err)
+		}
+		log.Printf("[INFO] Report is written to %s", opts.Report)
+	}
+
 	log.Printf("[INFO] Completed")
 	return nil
 }
 
+// checkConfig builds the tasks against the source dump, if it exists,
+// so CEL expressions are type checked with the column types of the tables.
+func checkConfig(conf *config.Config) error {
+	if _, err := os.Stat(conf.Source); err != nil {
+		log.Printf("[WARN] Source %s is not available, expressions are not checked: %v", conf.Source, err)
+		log.Printf("[INFO] Config file correct!")
+		return nil
+	}
+
+	dbDump, err := dump.LoadDump(conf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := dbDump.Close(); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+	}()
+
+	globalStorage, closeStorage, err := newStorage(conf)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	if _, err = buildStrategy(conf, dbDump, globalStorage); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Config file correct!")
+	return nil
+}
+
+// newStorage creates the storage of the fetched keys selected by the storage_backend section,
+// the bloom keys of the storage section are kept as bloom filters.
+// close removes the files of the disk storage.
+func newStorage(conf *config.Config) (storage.Storage, func(), error) {
+	var store storage.Storage
+	closeStorage := func() {}
+	if conf.StorageBackend.Type == config.DISK_STORAGE {
+		backend := conf.StorageBackend
+		diskStorage, err := storage.NewDiskStorage(
+			conf.Storage.Values, backend.Dir, int64(backend.MemoryMB)*1024*1024,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("disk storage error: %w", err)
+		}
+		log.Printf(
+			"[INFO] Keys beyond %d MB of memory are spilled to %s",
+			backend.MemoryMB, diskStorage.Dir(),
+		)
+		store = diskStorage
+		closeStorage = func() {
+			if err := diskStorage.Close(); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		}
+	} else {
+		mapStorage, err := storage.NewMapStringStorage(conf.Storage.Values)
+		if err != nil {
+			return nil, nil, err
+		}
+		store = mapStorage
+	}
+
+	if bloomKeys := conf.Storage.BloomKeys(); len(bloomKeys) > 0 {
+		store = storage.NewBloomStorage(store, bloomKeys)
+	}
+	return store, closeStorage, nil
+}
+
+// buildStrategy runs the tasks one by one, or concurrently if more than one job is allowed.
+func buildStrategy(
+	conf *config.Config,
+	dbDump *dump.Dump,
+	globalStorage storage.Storage,
+	extraOpts ...strategies.StrategyOption,
+) (strategies.Strategy, error) {
+	if opts.Workers < 1 {
+		return nil, fmt.Errorf("workers must be positive, got %d", opts.Workers)
+	}
+	strategyOpts := []strategies.StrategyOption{strategies.WithWorkers(opts.Workers)}
+	strategyOpts = append(strategyOpts, extraOpts...)
+	if opts.DryRun {
+		strategyOpts = append(strategyOpts, strategies.WithDryRun())
+	}
+
+	if opts.Jobs != 1 {
+		return strategies.BuildParallelStrategy(
+			conf, dbDump, globalStorage, opts.Jobs, strategyOpts...,
+		)
+	}
+	return strategies.BuildConsistentStrategy(conf, dbDump, globalStorage, strategyOpts...)
+}
+
+func defaultIfEmpty(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
 func setupLog(verbose, dbg bool, secs ...string) {
 	logOpts := []lgr.Option{lgr.Out(io.Discard), lgr.Err(io.Discard)} // default to discard
 
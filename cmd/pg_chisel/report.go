@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/strategies"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+// RunReport is the JSON report of a run written with --report.
+type RunReport struct {
+	StartedAt   time.Time `json:"started_at"`
+	DurationSec float64   `json:"duration_sec"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	DryRun      bool      `json:"dry_run"`
+	// Sizes of the dump directories, the destination is not written in dry run.
+	SourceBytes      int64                  `json:"source_bytes"`
+	DestinationBytes int64                  `json:"destination_bytes"`
+	Tasks            []strategies.TaskStats `json:"tasks"`
+}
+
+func newRunReport(
+	conf *config.Config,
+	startedAt time.Time,
+	dryRun bool,
+	tasks []strategies.TaskStats,
+) RunReport {
+	report := RunReport{
+		StartedAt:   startedAt,
+		DurationSec: time.Since(startedAt).Seconds(),
+		Source:      conf.Source,
+		Destination: conf.Destination,
+		DryRun:      dryRun,
+		SourceBytes: dirSize(conf.Source),
+		Tasks:       tasks,
+	}
+	if !dryRun {
+		report.DestinationBytes = dirSize(conf.Destination)
+	}
+	return report
+}
+
+// writeReport writes the report as indented JSON.
+func writeReport(path string, report RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can not encode report: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// dirSize returns the total size of the regular files in the directory, 0 on error.
+func dirSize(dir string) int64 {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		log.Printf("[WARN] Can not measure size of %s: %v", dir, err)
+		return 0
+	}
+	return size
+}
+
+// printTaskStats prints the statistics of the tasks as a table.
+func printTaskStats(out io.Writer, stats []strategies.TaskStats) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tCMD\tTABLE\tREAD\tMATCHED\tDELETED\tMODIFIED\tFETCHED\tKEYS")
+	for _, task := range stats {
+		counters := []string{"-", "-", "-", "-", "-"}
+		if task.Stats != nil {
+			counters = []string{
+				strconv.Itoa(task.Stats.Read),
+				strconv.Itoa(task.Stats.Matched),
+				strconv.Itoa(task.Stats.Deleted),
+				strconv.Itoa(task.Stats.Modified),
+				strconv.Itoa(task.Stats.Fetched),
+			}
+		}
+
+		keys := make([]string, 0, len(task.StorageKeys))
+		for key, size := range task.StorageKeys {
+			keys = append(keys, fmt.Sprintf("%s=%d", key, size.Cardinality))
+		}
+		slices.Sort(keys)
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			task.Task, task.Cmd, defaultIfEmpty(task.Table, "-"),
+			strings.Join(counters, "\t"), defaultIfEmpty(strings.Join(keys, ", "), "-"),
+		)
+	}
+	w.Flush()
+}
@@ -3,27 +3,29 @@ module github.com/zwergpro/pg-chisel
 go 1.23.1
 
 require (
+	github.com/RoaringBitmap/roaring v1.9.4
 	github.com/fatih/color v1.18.0
 	github.com/go-pkgz/lgr v0.11.1
 	github.com/google/cel-go v0.22.1
 	github.com/jessevdk/go-flags v1.6.1
 	github.com/klauspost/compress v1.17.11
+	github.com/pierrec/lz4/v4 v4.1.31
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/exp v0.0.0-20230515195305-f3d0a9c9a5cc
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	cel.dev/expr v0.18.0 // indirect
-	github.com/WAY29/icecream-go v0.0.0-20240322061317-a6fef5a698b9 // indirect
 	github.com/antlr4-go/antlr/v4 v4.13.0 // indirect
+	github.com/bits-and-blooms/bitset v1.12.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/mschoch/smat v0.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/shurcooL/go v0.0.0-20230706063926-5fe729b41b3a // indirect
 	github.com/stoewer/go-strcase v1.2.0 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
-	golang.org/x/exp v0.0.0-20230515195305-f3d0a9c9a5cc // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240826202546-f6391c0de4c7 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240826202546-f6391c0de4c7 // indirect
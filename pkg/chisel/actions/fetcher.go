@@ -9,39 +9,64 @@ import (
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
 )
 
+// FETCH_CHUNK_SIZE is the number of buffered values of a key written at once
+// to a store accepting the values through a KeyWriter.
+const FETCH_CHUNK_SIZE = 64 * 1024
+
 // CELFetcher fetches data using CEL expressions and manages buffered results.
 type CELFetcher struct {
-	buffer map[string][]string // Buffer for storing fetched results
-	store  storage.Storage     // Store for final data persistence
-	prg    cel.Program         // Compiled CEL program
+	buffer  map[string][]string // Buffer for storing fetched results
+	store   storage.Storage     // Store for final data persistence
+	prg     cel.Program         // Compiled CEL program
+	options actionOptions       // Views exposed to the CEL program
+
+	// Writers of the keys streamed to the store, nil if the store does not accept streams.
+	writers map[string]storage.KeyWriter
+	err     error // first error of a write in merge
 }
 
 // NewCELFetcher initializes and validates a CELFetcher instance.
-func NewCELFetcher(fetch map[string]string, store storage.Storage) (*CELFetcher, error) {
+func NewCELFetcher(
+	fetch map[string]string,
+	store storage.Storage,
+	opts ...ActionOption,
+) (*CELFetcher, error) {
 	expression, err := buildCELFetcherExpression(fetch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build CEL expression: %w", err)
 	}
 
-	env, err := createCELFetcherEnvironment()
+	options := newActionOptions(opts)
+
+	env, err := createCELFetcherEnvironment(options.envOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
 	}
 
-	prg, err := compileCELFetcherProgram(env, expression)
+	prg, checkedAST, err := compileCELFetcherProgram(env, expression)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile CEL program: %w", err)
 	}
+	options.useAST(checkedAST)
+	if err := cel_extensions.CheckSecrets(checkedAST); err != nil {
+		return nil, err
+	}
 
-	return &CELFetcher{
-		buffer: make(map[string][]string),
-		store:  store,
-		prg:    prg,
-	}, nil
+	fetcher := &CELFetcher{
+		buffer:  make(map[string][]string),
+		store:   store,
+		prg:     prg,
+		options: options,
+	}
+	if _, ok := store.(storage.StreamStorage); ok {
+		fetcher.writers = make(map[string]storage.KeyWriter)
+	}
+	return fetcher, nil
 }
 
 // buildCELFetcherExpression constructs a CEL-compatible map expression from the fetch rules.
@@ -59,8 +84,8 @@ func buildCELFetcherExpression(fetchRules map[string]string) (string, error) {
 }
 
 // createCELEnvironment initializes a CEL environment.
-func createCELFetcherEnvironment() (*cel.Env, error) {
-	env, err := cel_extensions.NewEnv()
+func createCELFetcherEnvironment(opts ...cel.EnvOption) (*cel.Env, error) {
+	env, err := cel_extensions.NewEnv(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize CEL environment: %w", err)
 	}
@@ -68,19 +93,19 @@ func createCELFetcherEnvironment() (*cel.Env, error) {
 }
 
 // compileCELFetcherProgram parses, validates, and compiles a CEL program.
-func compileCELFetcherProgram(env *cel.Env, expression string) (cel.Program, error) {
+func compileCELFetcherProgram(env *cel.Env, expression string) (cel.Program, *cel.Ast, error) {
 	ast, issues := env.Parse(expression)
 	if issues != nil && issues.Err() != nil {
-		return nil, fmt.Errorf("failed to parse CEL expression: %w", issues.Err())
+		return nil, nil, fmt.Errorf("failed to parse CEL expression: %w", issues.Err())
 	}
 
 	checkedAST, issues := env.Check(ast)
 	if issues != nil && issues.Err() != nil {
-		return nil, fmt.Errorf("failed to check CEL expression: %w", issues.Err())
+		return nil, nil, fmt.Errorf("failed to check CEL expression: %w", issues.Err())
 	}
 
 	if !checkedAST.OutputType().Equal(cel.MapType(cel.StringType, cel.DynType)).Value().(bool) {
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"CEL fetch expression must return map[string]dyn, got: %v",
 			checkedAST.OutputType(),
 		)
@@ -88,16 +113,17 @@ func compileCELFetcherProgram(env *cel.Env, expression string) (cel.Program, err
 
 	prg, err := env.Program(checkedAST)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create CEL program: %w", err)
+		return nil, nil, fmt.Errorf("failed to create CEL program: %w", err)
 	}
-	return prg, nil
+	return prg, checkedAST, nil
 }
 
 // Fetch evaluates the CEL program and stores the results in the buffer.
 func (f *CELFetcher) Fetch(rec storage.RecordStore) error {
 	// Prepare the input for CEL evaluation
-	input := map[string]any{
-		"table": rec.GetColumnMapping(),
+	input, err := f.options.celInput(rec)
+	if err != nil {
+		return fmt.Errorf("failed to prepare CEL input: %w", err)
 	}
 
 	// Evaluate the CEL program
@@ -124,6 +150,12 @@ func (f *CELFetcher) Fetch(rec storage.RecordStore) error {
 			return fmt.Errorf("map key is not a string, got: %T", k)
 		}
 
+		// CEL null is fetched as the \N text of SQL NULL
+		if v.Type() == types.NullType {
+			convertedMap[keyStr] = cel_extensions.PG_NULL
+			continue
+		}
+
 		valStr, ok := v.ConvertToType(cel.StringType).Value().(string)
 		if !ok {
 			return fmt.Errorf("map val is not a string, got: %T", v)
@@ -136,19 +168,99 @@ func (f *CELFetcher) Fetch(rec storage.RecordStore) error {
 		f.buffer[key] = append(f.buffer[key], value)
 	}
 
+	return f.writeChunks()
+}
+
+// writeChunks writes the buffered values of the keys holding a full chunk
+// to the store, if it accepts streams.
+func (f *CELFetcher) writeChunks() error {
+	if f.writers == nil {
+		return nil
+	}
+	for key, values := range f.buffer {
+		if len(values) < FETCH_CHUNK_SIZE {
+			continue
+		}
+		if err := f.write(key, values); err != nil {
+			return err
+		}
+		f.buffer[key] = values[:0]
+	}
+	return nil
+}
+
+// write adds the values to the writer of the key, opened on the first write.
+func (f *CELFetcher) write(key string, values []string) error {
+	w, ok := f.writers[key]
+	if !ok {
+		w = f.store.(storage.StreamStorage).NewKeyWriter(key)
+		f.writers[key] = w
+	}
+	for _, value := range values {
+		if err := w.Add(value); err != nil {
+			return fmt.Errorf("failed to write key %s: %w", key, err)
+		}
+	}
 	return nil
 }
 
 // Flush writes the accumulated data to the Store.
 func (f *CELFetcher) Flush() error {
+	defer func() {
+		clear(f.buffer)
+		clear(f.writers)
+		f.err = nil
+	}()
+	if f.err != nil {
+		return f.err
+	}
+
+	if f.writers == nil {
+		for key, values := range f.buffer {
+			log.Printf("[DEBUG] Flushing key: %s", key)
+			f.store.Set(key, values)
+		}
+		return nil
+	}
+
 	for key, values := range f.buffer {
+		if err := f.write(key, values); err != nil {
+			return err
+		}
+	}
+	for key, w := range f.writers {
 		log.Printf("[DEBUG] Flushing key: %s", key)
-		f.store.Set(key, values)
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to flush key %s: %w", key, err)
+		}
 	}
-	clear(f.buffer)
 	return nil
 }
 
+// Fork returns the fetch function of a batch buffering the records on its own,
+// merge appends them to the buffer of the fetcher.
+func (f *CELFetcher) Fork() (func(rec storage.RecordStore) error, func()) {
+	fork := &CELFetcher{
+		buffer:  make(map[string][]string),
+		store:   f.store,
+		prg:     f.prg,
+		options: f.options,
+	}
+	return fork.Fetch, func() {
+		mergeBuffer(f.buffer, fork.buffer)
+		if err := f.writeChunks(); err != nil && f.err == nil {
+			f.err = err
+		}
+	}
+}
+
+// mergeBuffer appends the values of the fork buffer to the buffer.
+func mergeBuffer(buffer, fork map[string][]string) {
+	for key, values := range fork {
+		buffer[key] = append(buffer[key], values...)
+	}
+}
+
 type DummyFetcher struct {
 	Buffer  map[string][]string
 	Store   storage.Storage
@@ -185,3 +297,8 @@ func (f *DummyFetcher) Flush() error {
 	clear(f.Buffer)
 	return nil
 }
+
+func (f *DummyFetcher) Fork() (func(rec storage.RecordStore) error, func()) {
+	fork := NewDummyFetcher(f.Store, f.Columns)
+	return fork.Fetch, func() { mergeBuffer(f.Buffer, fork.Buffer) }
+}
@@ -1,9 +1,12 @@
 package actions
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage/mocks"
 )
 
@@ -120,3 +123,65 @@ func TestFlush_Success(t *testing.T) {
 	// After flush, buffer should be cleared
 	assert.Empty(t, fetcher.buffer, "buffer should be empty after Flush")
 }
+
+func TestFetch_Fork(t *testing.T) {
+	mockStorage := mocks.NewStorage(t)
+	fetcher, err := NewCELFetcher(map[string]string{"name": `string(table.name)`}, mockStorage)
+	assert.NoError(t, err, "did not expect error with valid fetch rules")
+
+	record := func(name string) *mocks.RecordStore {
+		rec := mocks.NewRecordStore(t)
+		rec.On("GetColumnMapping").Return(map[string][]byte{"name": []byte(name)})
+		return rec
+	}
+
+	// Batches are fetched by the forks in any order and merged in the row order.
+	fetchFirst, mergeFirst := fetcher.Fork()
+	fetchSecond, mergeSecond := fetcher.Fork()
+	assert.NoError(t, fetchSecond(record("c")))
+	assert.NoError(t, fetchFirst(record("a")))
+	assert.NoError(t, fetchFirst(record("b")))
+	assert.Empty(t, fetcher.buffer, "forks buffer the records on their own")
+
+	mergeFirst()
+	mergeSecond()
+
+	assert.Equal(t, map[string][]string{"name": {"a", "b", "c"}}, fetcher.buffer)
+}
+
+func TestFetch_StreamStorage(t *testing.T) {
+	// GIVEN: A fetcher writing to a disk storage, and more values than a chunk.
+	store, err := storage.NewDiskStorage(nil, t.TempDir(), 1024*1024)
+	require.NoError(t, err)
+	defer store.Close()
+	store.Set("id", []string{"previous"})
+
+	fetcher, err := NewCELFetcher(map[string]string{"id": `string(table.id)`}, store)
+	require.NoError(t, err)
+
+	// WHEN: The values are fetched, the first ones by a fork.
+	count := FETCH_CHUNK_SIZE + 10
+	expected := make([]string, 0, count)
+	fetchFirst, mergeFirst := fetcher.Fork()
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("%d", i)
+		expected = append(expected, id)
+		fetch := fetcher.Fetch
+		if i < 10 {
+			fetch = fetchFirst
+		}
+		require.NoError(t, fetch(storage.NewRecord([]byte(id), []string{"id"})))
+		if i == 9 {
+			mergeFirst()
+		}
+	}
+
+	// THEN: Full chunks are written as they are fetched, the key is replaced on Flush.
+	assert.Len(t, fetcher.buffer["id"], 10)
+	assert.Equal(t, []string{"previous"}, store.Get("id"))
+
+	require.NoError(t, fetcher.Flush())
+	assert.Equal(t, expected, store.Get("id"))
+	assert.Empty(t, fetcher.buffer)
+	assert.Empty(t, fetcher.writers)
+}
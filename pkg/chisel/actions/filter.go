@@ -10,16 +10,15 @@ import (
 )
 
 type CELFilter struct {
-	prg cel.Program
+	prg     cel.Program
+	options actionOptions
 }
 
 func (f *CELFilter) IsMatched(rec storage.RecordStore) (bool, error) {
-	// Get the column mapping from the rec
-	table := rec.GetColumnMapping()
-
 	// Prepare the input for CEL evaluation
-	input := map[string]interface{}{
-		"table": table,
+	input, err := f.options.celInput(rec)
+	if err != nil {
+		return false, fmt.Errorf("failed to prepare CEL input: %w", err)
 	}
 
 	// Evaluate the CEL program with the input
@@ -38,9 +37,11 @@ func (f *CELFilter) IsMatched(rec storage.RecordStore) (bool, error) {
 }
 
 // NewCELFilter creates and initializes a new CELFilter.
-func NewCELFilter(expr string, store storage.Storage) (*CELFilter, error) {
+func NewCELFilter(expr string, store storage.Storage, opts ...ActionOption) (*CELFilter, error) {
+	options := newActionOptions(opts)
+
 	// Step 1: Create CEL Environment
-	env, err := createCELEnvironment(store)
+	env, err := createCELEnvironment(store, options.envOptions()...)
 	if err != nil {
 		return nil, err
 	}
@@ -70,16 +71,24 @@ func NewCELFilter(expr string, store storage.Storage) (*CELFilter, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CEL program: %w", err)
 	}
+	options.useAST(checkedAST)
+	if err := cel_extensions.CheckSecrets(checkedAST); err != nil {
+		return nil, err
+	}
 
-	return &CELFilter{prg: prg}, nil
+	return &CELFilter{prg: prg, options: options}, nil
 }
 
 // createCELEnvironment initializes the CEL environment with variables and custom functions.
-func createCELEnvironment(store storage.Storage) (*cel.Env, error) {
-	env, err := cel_extensions.NewEnv(
+func createCELEnvironment(store storage.Storage, opts ...cel.EnvOption) (*cel.Env, error) {
+	opts = append(opts,
 		cel_extensions.GetArrayFunc(store),
 		cel_extensions.GetSetFunc(store),
+		cel_extensions.GetIntSetFunc(store),
+		cel_extensions.GetMaybeInFunc(store),
 	)
+	opts = append(opts, cel_extensions.SampleFuncs()...)
+	env, err := cel_extensions.NewEnv(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
 	}
@@ -186,3 +186,89 @@ func TestCELFilter_EvaluationError(t *testing.T) {
 	)
 	assert.False(t, isMatched, "IsMatched should return false when evaluation fails")
 }
+
+func TestCELFilter_RowSchema(t *testing.T) {
+	schema := cel_extensions.NewRowSchema([]cel_extensions.RowColumn{
+		{Name: "id", Type: "integer", NotNull: true},
+		{Name: "profile_id", Type: "integer"},
+	})
+	expression := `row.id > 1 && row.profile_id == null`
+
+	filter, err := NewCELFilter(expression, mocks.NewStorage(t), WithRowSchema(schema))
+	assert.NoError(t, err, "failed to create CELFilter")
+
+	mockRecord := mocks.NewRecordStore(t)
+	mockRecord.On("GetColumnMapping").Return(map[string][]byte{
+		"id":         []byte("2"),
+		"profile_id": []byte(cel_extensions.PG_NULL),
+	})
+	mockRecord.On("IsNull", "id").Return(false)
+	mockRecord.On("IsNull", "profile_id").Return(true)
+
+	isMatched, err := filter.IsMatched(mockRecord)
+	assert.NoError(t, err, "IsMatched should not return an error")
+	assert.True(t, isMatched, "IsMatched should return true for matching record")
+}
+
+func TestCELFilter_RowSchemaUnreadColumns(t *testing.T) {
+	schema := cel_extensions.NewRowSchema([]cel_extensions.RowColumn{
+		{Name: "id", Type: "integer", NotNull: true},
+		{Name: "amount", Type: "double precision"},
+		{Name: "created_at", Type: "timestamp"},
+	})
+
+	// GIVEN values the typed row can not parse
+	mockRecord := mocks.NewRecordStore(t)
+	mockRecord.On("GetColumnMapping").Return(map[string][]byte{
+		"id":         []byte("2"),
+		"amount":     []byte("1e999"),
+		"created_at": []byte("2024-01-15 10:30:00 BCE"),
+	})
+
+	// THEN the expressions which do not read them are not affected
+	filter, err := NewCELFilter(`string(table.id) == "2"`, mocks.NewStorage(t), WithRowSchema(schema))
+	assert.NoError(t, err, "failed to create CELFilter")
+	isMatched, err := filter.IsMatched(mockRecord)
+	assert.NoError(t, err, "IsMatched should not return an error")
+	assert.True(t, isMatched)
+
+	// AND reading them fails
+	mockRecord.On("IsNull", "amount").Return(false)
+	filter, err = NewCELFilter(`row.amount > 1.0`, mocks.NewStorage(t), WithRowSchema(schema))
+	assert.NoError(t, err, "failed to create CELFilter")
+	_, err = filter.IsMatched(mockRecord)
+	assert.ErrorContains(t, err, "can not parse column amount")
+}
+
+func TestCELFilter_RowSchemaTypeError(t *testing.T) {
+	schema := cel_extensions.NewRowSchema([]cel_extensions.RowColumn{
+		{Name: "id", Type: "integer", NotNull: true},
+	})
+
+	filter, err := NewCELFilter(`row.id == "1"`, mocks.NewStorage(t), WithRowSchema(schema))
+	assert.Error(t, err, "NewCELFilter should return an error for mismatched types")
+	assert.Contains(t, err.Error(), "failed to check CEL expression")
+	assert.Nil(t, filter)
+}
+
+func TestCELFilter_Sample(t *testing.T) {
+	filter, err := NewCELFilter(`sample_seeded(table.id, 0.5, "users")`, mocks.NewStorage(t))
+	assert.NoError(t, err, "failed to create CELFilter")
+
+	// GIVEN the same keys filtered twice
+	var matched []bool
+	for range 2 {
+		for _, id := range []string{"1", "2", "3", "4", "5", "6", "7", "8"} {
+			rec := mocks.NewRecordStore(t)
+			rec.On("GetColumnMapping").Return(map[string][]byte{"id": []byte(id)})
+			isMatched, err := filter.IsMatched(rec)
+			assert.NoError(t, err)
+			matched = append(matched, isMatched)
+		}
+	}
+
+	// THEN the same keys are matched
+	assert.Equal(t, matched[:8], matched[8:])
+	assert.Contains(t, matched, true)
+	assert.Contains(t, matched, false)
+}
@@ -8,18 +8,24 @@ import (
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
 )
 
 type CELModifier struct {
-	prg cel.Program // Compiled CEL program
+	prg     cel.Program // Compiled CEL program
+	options actionOptions
+	sources map[string]string // columns set to a table column, e.g. {"email": "backup_email"}
 }
 
 func (m *CELModifier) Modify(rec storage.RecordStore) error {
 	// Prepare the input for CEL evaluation
-	input := map[string]any{
-		"table": rec.GetColumnMapping(),
+	input, err := m.options.celInput(rec)
+	if err != nil {
+		return fmt.Errorf("failed to prepare CEL input: %w", err)
 	}
 
 	// Evaluate the CEL program
@@ -38,14 +44,20 @@ func (m *CELModifier) Modify(rec storage.RecordStore) error {
 		return fmt.Errorf("result is not a valid map, got: %s", reflect.TypeOf(value))
 	}
 
-	// Convert the map to map[string]string
+	// Convert the map to map[string]string, the columns set to SQL NULL are kept apart
 	convertedMap := make(map[string]string)
+	var nullCols []string
 	for k, v := range goMap {
 		keyStr, ok := k.Value().(string)
 		if !ok {
 			return fmt.Errorf("map key is not a string, got: %T", k)
 		}
 
+		if m.isNull(rec, keyStr, v) {
+			nullCols = append(nullCols, keyStr)
+			continue
+		}
+
 		valStr, ok := v.ConvertToType(cel.StringType).Value().(string)
 		if !ok {
 			return fmt.Errorf("map val is not a string, got: %T", v)
@@ -59,28 +71,63 @@ func (m *CELModifier) Modify(rec storage.RecordStore) error {
 			return err
 		}
 	}
+	for _, key := range nullCols {
+		if err = rec.SetNull(key); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func NewCELModifier(setRules map[string]string) (*CELModifier, error) {
+// isNull reports whether the result sets the column to SQL NULL: CEL null and the NULL
+// constant do, as well as a table column holding SQL NULL. Bytes of other expressions
+// are the \N text of table columns, which is SQL NULL unless it is read from a column
+// holding the \N string.
+func (m *CELModifier) isNull(rec storage.RecordStore, col string, v ref.Val) bool {
+	switch val := v.(type) {
+	case types.Null:
+		return true
+	case types.String:
+		return string(val) == cel_extensions.PG_NULL
+	case types.Bytes:
+		if string(val) != cel_extensions.PG_NULL {
+			return false
+		}
+		if source, ok := m.sources[col]; ok {
+			return rec.IsNull(source)
+		}
+		return true
+	}
+	return false
+}
+
+func NewCELModifier(setRules map[string]string, opts ...ActionOption) (*CELModifier, error) {
 	expression, err := buildCELModifierExpression(setRules)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build CEL expression: %w", err)
 	}
 
-	env, err := createCELModifierEnvironment()
+	options := newActionOptions(opts)
+
+	env, err := createCELModifierEnvironment(options.envOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
 	}
 
-	prg, err := compileCELModifierProgram(env, expression)
+	prg, checkedAST, err := compileCELModifierProgram(env, expression)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile CEL program: %w", err)
 	}
+	options.useAST(checkedAST)
+	if err := cel_extensions.CheckSecrets(checkedAST); err != nil {
+		return nil, err
+	}
 
 	return &CELModifier{
-		prg: prg,
+		prg:     prg,
+		options: options,
+		sources: tableSources(checkedAST),
 	}, nil
 }
 
@@ -97,27 +144,68 @@ func buildCELModifierExpression(setRules map[string]string) (string, error) {
 	return "{" + strings.Join(expressions, ", ") + "}", nil
 }
 
-func createCELModifierEnvironment() (*cel.Env, error) {
-	env, err := cel_extensions.NewEnv()
+// tableSources returns the columns whose rule is a table column, table.name or table["name"].
+func tableSources(checked *cel.Ast) map[string]string {
+	sources := make(map[string]string)
+	expr := checked.NativeRep().Expr()
+	if expr.Kind() != ast.MapKind {
+		return sources
+	}
+	for _, entry := range expr.AsMap().Entries() {
+		key, ok := entry.AsMapEntry().Key().AsLiteral().(types.String)
+		if !ok {
+			continue
+		}
+		if source, ok := tableColumn(entry.AsMapEntry().Value()); ok {
+			sources[string(key)] = source
+		}
+	}
+	return sources
+}
+
+func tableColumn(expr ast.Expr) (string, bool) {
+	isTable := func(e ast.Expr) bool {
+		return e.Kind() == ast.IdentKind && e.AsIdent() == "table"
+	}
+	switch expr.Kind() {
+	case ast.SelectKind:
+		sel := expr.AsSelect()
+		if isTable(sel.Operand()) && !sel.IsTestOnly() {
+			return sel.FieldName(), true
+		}
+	case ast.CallKind:
+		call := expr.AsCall()
+		if call.FunctionName() == operators.Index && len(call.Args()) == 2 &&
+			isTable(call.Args()[0]) && call.Args()[1].Kind() == ast.LiteralKind {
+			if name, ok := call.Args()[1].AsLiteral().(types.String); ok {
+				return string(name), true
+			}
+		}
+	}
+	return "", false
+}
+
+func createCELModifierEnvironment(opts ...cel.EnvOption) (*cel.Env, error) {
+	env, err := cel_extensions.NewEnv(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize CEL environment: %w", err)
 	}
 	return env, nil
 }
 
-func compileCELModifierProgram(env *cel.Env, expression string) (cel.Program, error) {
+func compileCELModifierProgram(env *cel.Env, expression string) (cel.Program, *cel.Ast, error) {
 	ast, issues := env.Parse(expression)
 	if issues != nil && issues.Err() != nil {
-		return nil, fmt.Errorf("failed to parse CEL expression: %w", issues.Err())
+		return nil, nil, fmt.Errorf("failed to parse CEL expression: %w", issues.Err())
 	}
 
 	checkedAST, issues := env.Check(ast)
 	if issues != nil && issues.Err() != nil {
-		return nil, fmt.Errorf("failed to check CEL expression: %w", issues.Err())
+		return nil, nil, fmt.Errorf("failed to check CEL expression: %w", issues.Err())
 	}
 
 	if !checkedAST.OutputType().Equal(cel.MapType(cel.StringType, cel.DynType)).Value().(bool) {
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"CEL fetch expression must return map[string]dyn, got: %v",
 			checkedAST.OutputType(),
 		)
@@ -125,7 +213,7 @@ func compileCELModifierProgram(env *cel.Env, expression string) (cel.Program, er
 
 	prg, err := env.Program(checkedAST)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create CEL program: %w", err)
+		return nil, nil, fmt.Errorf("failed to create CEL program: %w", err)
 	}
-	return prg, nil
+	return prg, checkedAST, nil
 }
@@ -5,8 +5,10 @@ import (
 	"testing"
 
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage/mocks"
+	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestNewCELModifier_EmptyRules(t *testing.T) {
@@ -96,3 +98,75 @@ func TestCELModifier_Modify_MapWithNonStringValue(t *testing.T) {
 	err = mod.Modify(res)
 	assert.Error(t, err, "expected error for non-string key")
 }
+
+func TestCELModifier_Modify_RowSchema(t *testing.T) {
+	schema := cel_extensions.NewRowSchema([]cel_extensions.RowColumn{
+		{Name: "age", Type: "integer"},
+		{Name: "email", Type: "text"},
+	})
+	rules := map[string]string{
+		"age":   `row.age + 10`,
+		"email": `null`,
+	}
+
+	mod, err := NewCELModifier(rules, WithRowSchema(schema))
+	assert.NoError(t, err)
+
+	rec := mocks.NewRecordStore(t)
+	rec.On("GetColumnMapping").Return(map[string][]byte{
+		"age":   []byte("25"),
+		"email": []byte("john@example.com"),
+	})
+	rec.On("IsNull", mock.Anything).Return(false)
+	rec.On("SetVal", "age", []byte("35")).Return(nil)
+	rec.On("SetNull", "email").Return(nil)
+
+	err = mod.Modify(rec)
+	assert.NoError(t, err, "should not fail on valid evaluation")
+	rec.AssertExpectations(t)
+}
+
+func TestCELModifier_Modify_FakeFuncs(t *testing.T) {
+	rules := map[string]string{
+		"first_name": `fake.first_name(table.id)`,
+		"bio":        `fake.sentence(table.id, 3, "fr")`,
+	}
+
+	mod, err := NewCELModifier(rules)
+	assert.NoError(t, err)
+
+	// GIVEN two records with the same primary key
+	var values []string
+	for range 2 {
+		rec := mocks.NewRecordStore(t)
+		rec.On("GetColumnMapping").Return(map[string][]byte{
+			"id":         []byte("7"),
+			"first_name": []byte("John"),
+			"bio":        []byte("Born in Boston."),
+		})
+		rec.On("SetVal", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			values = append(values, args.String(0)+"="+string(args.Get(1).([]byte)))
+		}).Return(nil)
+
+		err = mod.Modify(rec)
+		assert.NoError(t, err)
+	}
+
+	// THEN the columns are rewritten with the same fake values
+	assert.Len(t, values, 4)
+	assert.ElementsMatch(t, values[:2], values[2:])
+	for _, value := range values {
+		assert.NotContains(t, []string{"first_name=John", "bio=Born in Boston."}, value)
+	}
+}
+
+func TestNewCELModifier_MissingSecret(t *testing.T) {
+	rules := map[string]string{
+		"email": `pseudo_email(table.email, "modifier_test_missing")`,
+	}
+
+	// A missing secret fails the modifier before any row is modified
+	mod, err := NewCELModifier(rules)
+	assert.ErrorContains(t, err, `secret "modifier_test_missing" is not set`)
+	assert.Nil(t, mod)
+}
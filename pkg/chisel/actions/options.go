@@ -0,0 +1,57 @@
+package actions
+
+import (
+	"github.com/google/cel-go/cel"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
+)
+
+type actionOptions struct {
+	row *cel_extensions.RowSchema
+}
+
+type ActionOption func(*actionOptions)
+
+// WithRowSchema exposes the typed row view of the table to CEL expressions.
+func WithRowSchema(schema *cel_extensions.RowSchema) ActionOption {
+	return func(o *actionOptions) {
+		o.row = schema
+	}
+}
+
+func newActionOptions(opts []ActionOption) actionOptions {
+	options := actionOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// envOptions returns the CEL declarations of the configured views.
+func (o *actionOptions) envOptions() []cel.EnvOption {
+	if o.row == nil {
+		return nil
+	}
+	return o.row.EnvOptions()
+}
+
+// useAST keeps the views of the columns read by the checked expression.
+func (o *actionOptions) useAST(ast *cel.Ast) {
+	if o.row != nil {
+		o.row = o.row.Referenced(ast)
+	}
+}
+
+// celInput prepares the input for CEL evaluation of the record.
+func (o *actionOptions) celInput(rec storage.RecordStore) (map[string]any, error) {
+	table := rec.GetColumnMapping()
+	input := map[string]any{
+		"table": table,
+	}
+	if o.row != nil {
+		if err := o.row.Bind(input, table, rec.IsNull); err != nil {
+			return nil, err
+		}
+	}
+	return input, nil
+}
@@ -2,6 +2,7 @@ package commands
 
 type CommandBase struct {
 	verboseName string
+	workers     int
 	// Any other optional fields...
 }
 
@@ -12,3 +13,12 @@ func WithVerboseName(name string) CommandBaseOption {
 		base.verboseName = name
 	}
 }
+
+// WithWorkers processes the records of the table by the given number of workers.
+// Filters and modifiers of the command must be safe for concurrent use,
+// fetchers must implement ForkableFetcher, otherwise records are processed one by one.
+func WithWorkers(workers int) CommandBaseOption {
+	return func(base *CommandBase) {
+		base.workers = workers
+	}
+}
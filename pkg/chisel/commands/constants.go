@@ -6,4 +6,6 @@ const (
 	UPDATE_CMD   = "update"
 	SYNC_CMD     = "sync"
 	TRUNCATE_CMD = "truncate"
+	DROP_CMD     = "drop"
+	SUBSET_CMD   = "subset"
 )
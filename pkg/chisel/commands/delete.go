@@ -1,11 +1,8 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"log"
-	"time"
 
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 
@@ -19,6 +16,11 @@ type DeleteCmd struct {
 	entity  *dump.Entity
 	handler dumpio.DumpHandler
 	filter  RecordFilter
+
+	read    int
+	deleted int
+
+	passStats
 }
 
 func NewDeleteCmd(
@@ -42,64 +44,71 @@ func NewDeleteCmd(
 func (c *DeleteCmd) Execute() error {
 	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "DeleteCmd"))
 
-	dumpReader := c.handler.GetReader()
-	if err := dumpReader.Open(); err != nil {
-		return fmt.Errorf("failed to open reader: %w", err)
-	}
-	defer dumpReader.Close()
-
-	dumpWriter := c.handler.GetWriter()
-	if err := dumpWriter.Open(); err != nil {
-		return fmt.Errorf("failed to open writer: %w", err)
-	}
-	defer dumpWriter.Close()
-
-	reader := bufio.NewReader(dumpReader)
-
-	start := time.Now()
-	lineCounter := 0
-	deletedCounter := 0
-
-	for {
-		rowLine, err := readNextLine(reader)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		lineCounter++
-		rec := storage.NewRecord(rowLine, c.entity.Table.SortedColumns)
-
-		matched, err := c.filter.IsMatched(rec)
-		if err != nil {
-			return fmt.Errorf("filter error: %w", err)
-		}
-
-		// Write only lines that do NOT match
-		if matched {
-			deletedCounter++
-			continue
-		}
-
-		if _, writeErr := dumpWriter.Write(rec.Row); writeErr != nil {
-			return fmt.Errorf("write error: %w", writeErr)
-		}
-	}
+	c.read = 0
+	c.deleted = 0
 
-	endMarker := []byte("\\.\n\n")
-	if _, err := dumpWriter.Write(endMarker); err != nil {
-		return fmt.Errorf("failed to write end marker to dump: %w", err)
+	stats, err := runPipeline(c.entity, c.handler, []RowStage{c}, c.workers)
+	if err != nil {
+		return err
 	}
 
 	// Stats
-	duration := time.Since(start)
-	efficiency := float64(lineCounter) / duration.Seconds()
+	efficiency := float64(stats.read) / stats.duration.Seconds()
 	log.Printf(
 		"[DEBUG] STATS read=%d deleted=%d time=%.2fs efficiency=%.2f items/sec",
-		lineCounter, deletedCounter, duration.Seconds(), efficiency,
+		stats.read, c.deleted, stats.duration.Seconds(), efficiency,
 	)
+	return nil
+}
+
+// Process drops the matching record.
+func (c *DeleteCmd) Process(rec storage.RecordStore) (bool, error) {
+	c.read++
+
+	matched, err := c.filter.IsMatched(rec)
+	if err != nil {
+		return false, fmt.Errorf("filter error: %w", err)
+	}
+
+	if matched {
+		c.deleted++
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c *DeleteCmd) Flush() error {
+	return nil
+}
+
+func (c *DeleteCmd) Mutates() bool {
+	return true
+}
+
+func (c *DeleteCmd) Fork() (RowStage, bool) {
+	return &DeleteCmd{
+		CommandBase: c.CommandBase,
+		entity:      c.entity,
+		handler:     c.handler,
+		filter:      c.filter,
+	}, true
+}
 
+func (c *DeleteCmd) Join(fork RowStage) error {
+	forked := fork.(*DeleteCmd)
+	c.read += forked.read
+	c.deleted += forked.deleted
 	return nil
 }
+
+func (c *DeleteCmd) Stats() Stats {
+	return Stats{
+		Read:     c.read,
+		Matched:  c.deleted,
+		Written:  c.read - c.deleted,
+		Deleted:  c.deleted,
+		BytesIn:  c.bytesIn,
+		BytesOut: c.bytesOut,
+		Duration: c.duration,
+	}
+}
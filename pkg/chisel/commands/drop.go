@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+)
+
+// DropCmd removes a table, its data and all dependent objects from the dump.
+type DropCmd struct {
+	CommandBase
+
+	dump  *dump.Dump
+	table string
+
+	stats Stats
+}
+
+func NewDropCmd(
+	dbDump *dump.Dump,
+	table string,
+	opts ...CommandBaseOption,
+) *DropCmd {
+	cmd := DropCmd{
+		dump:  dbDump,
+		table: table,
+	}
+
+	for _, opt := range opts {
+		opt(&cmd.CommandBase)
+	}
+	return &cmd
+}
+
+func (c *DropCmd) Execute() error {
+	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "DropCmd"))
+
+	start := time.Now()
+	if err := c.dump.DropTable(c.table); err != nil {
+		return fmt.Errorf("failed to drop table: %w", err)
+	}
+	c.stats = Stats{Duration: time.Since(start)}
+	return nil
+}
+
+func (c *DropCmd) Stats() Stats {
+	return c.stats
+}
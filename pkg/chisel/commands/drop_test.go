@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+)
+
+func TestDropCmd(t *testing.T) {
+	// GIVEN: A dump with a table, its data and an index
+	tableEntry := &dump.TocEntry{DumpId: 1, Desc: dump.TABLE, Namespace: "public", Tag: "user"}
+	dataEntry := &dump.TocEntry{
+		DumpId:       2,
+		Desc:         dump.TABLE_DATA,
+		Namespace:    "public",
+		Tag:          "user",
+		DataFile:     "2.dat",
+		Dependencies: []int{1},
+	}
+	indexEntry := &dump.TocEntry{DumpId: 3, Desc: dump.INDEX, Tag: "user_idx", Dependencies: []int{1}}
+
+	entity := newTestEntity(nil)
+	entity.Id = 2
+	entity.Meta = dump.EntityMeta{DumpId: 2, Desc: dump.TABLE_DATA, Schema: "public", Name: "user"}
+	entity.TocEntry = dataEntry
+
+	dbDump := &dump.Dump{
+		Entities: map[string]*dump.Entity{"user": &entity},
+		Toc:      &dump.Toc{Entries: []*dump.TocEntry{tableEntry, dataEntry, indexEntry}},
+	}
+
+	// WHEN: We execute the DropCmd.
+	err := NewDropCmd(dbDump, "user").Execute()
+
+	// THEN: The table and all dependent entries are dropped.
+	require.NoError(t, err)
+	assert.True(t, dbDump.IsDropped(1))
+	assert.True(t, dbDump.IsDropped(2))
+	assert.True(t, dbDump.IsDropped(3))
+	assert.Empty(t, dbDump.BuildToc().Entries)
+}
+
+func TestDropCmd_UnknownTable(t *testing.T) {
+	dbDump := &dump.Dump{Entities: map[string]*dump.Entity{}, Toc: &dump.Toc{}}
+
+	err := NewDropCmd(dbDump, "unknown").Execute()
+	assert.ErrorContains(t, err, "does not exist")
+}
@@ -14,3 +14,31 @@ type RecordFetcher interface {
 type RecordModifier interface {
 	Modify(rec storage.RecordStore) error
 }
+
+// RowStage processes the records of a table within a single pass over the table data.
+type RowStage interface {
+	// Process handles the record and reports whether it is kept in the table.
+	// A dropped record is neither passed to the next stages nor written.
+	Process(rec storage.RecordStore) (bool, error)
+	// Flush is called once all records are processed.
+	Flush() error
+	// Mutates reports whether the table is rewritten.
+	Mutates() bool
+}
+
+// ForkableStage is a RowStage able to process batches of records concurrently.
+type ForkableStage interface {
+	RowStage
+	// Fork returns a stage processing a single batch, false if the stage cannot be forked.
+	Fork() (RowStage, bool)
+	// Join merges the results of the forked stage, batches are joined in the row order.
+	Join(fork RowStage) error
+}
+
+// ForkableFetcher is a RecordFetcher able to fetch records of several batches concurrently.
+type ForkableFetcher interface {
+	RecordFetcher
+	// Fork returns the fetch function of a single batch, which buffers the records on its own,
+	// and the merge function appending the buffered records to the fetcher.
+	Fork() (fetch func(rec storage.RecordStore) error, merge func())
+}
@@ -0,0 +1,394 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+// PipelineCmd runs several row stages on the same table in a single read/write pass.
+// Every record goes through the stages in order, so the result is the same
+// as executing the stages one by one.
+type PipelineCmd struct {
+	CommandBase
+
+	entity  *dump.Entity
+	handler dumpio.DumpHandler
+	stages  []RowStage
+
+	stats pipelineStats
+}
+
+func NewPipelineCmd(
+	entity *dump.Entity,
+	handler dumpio.DumpHandler,
+	stages []RowStage,
+	opts ...CommandBaseOption,
+) *PipelineCmd {
+	cmd := PipelineCmd{
+		entity:  entity,
+		handler: handler,
+		stages:  stages,
+	}
+
+	for _, opt := range opts {
+		opt(&cmd.CommandBase)
+	}
+	return &cmd
+}
+
+func (c *PipelineCmd) Execute() error {
+	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "PipelineCmd"))
+
+	stats, err := runPipeline(c.entity, c.handler, c.stages, c.workers)
+	c.stats = stats
+	if err != nil {
+		return err
+	}
+
+	// Stats
+	efficiency := float64(stats.read) / stats.duration.Seconds()
+	log.Printf(
+		"[DEBUG] STATS read=%d written=%d stages=%d time=%.2fs efficiency=%.2f items/sec",
+		stats.read, stats.written, len(c.stages), stats.duration.Seconds(), efficiency,
+	)
+	return nil
+}
+
+// Stats returns the counters of the pass, the counters of the tasks are kept by the stages.
+func (c *PipelineCmd) Stats() Stats {
+	return Stats{
+		Read:     c.stats.read,
+		Written:  c.stats.written,
+		BytesIn:  c.stats.bytesIn,
+		BytesOut: c.stats.bytesOut,
+		Duration: c.stats.duration,
+	}
+}
+
+// PIPELINE_BATCH_SIZE is the number of records processed by a worker at once.
+const PIPELINE_BATCH_SIZE = 1024
+
+// pipelineStats are the counters of a pass over the table.
+type pipelineStats struct {
+	passStats
+
+	read    int
+	written int
+}
+
+// runPipeline reads the table once and passes every record through the stages.
+// The table is rewritten only if some of the stages mutate it.
+func runPipeline(
+	entity *dump.Entity,
+	handler dumpio.DumpHandler,
+	stages []RowStage,
+	workers int,
+) (pipelineStats, error) {
+	start := time.Now()
+	stats := pipelineStats{}
+
+	dumpReader := handler.GetReader()
+	if err := dumpReader.Open(); err != nil {
+		return stats, fmt.Errorf("failed to open reader: %w", err)
+	}
+	defer dumpReader.Close()
+
+	var dumpWriter dumpio.DumpWriter
+	writerClosed := false
+	if slices.ContainsFunc(stages, RowStage.Mutates) {
+		dumpWriter = handler.GetWriter()
+		if err := dumpWriter.Open(); err != nil {
+			return stats, fmt.Errorf("failed to open writer: %w", err)
+		}
+		// the partial data is discarded after errors, on success the writer is closed below
+		defer func() {
+			if writerClosed {
+				return
+			}
+			if err := dumpWriter.Abort(); err != nil {
+				log.Printf("[ERROR] Cannot discard written data of %s: %v", entity.Meta.Name, err)
+			}
+		}()
+	}
+
+	reader := bufio.NewReader(dumpReader)
+	write := func(row []byte) error {
+		if dumpWriter == nil {
+			return nil
+		}
+		if _, err := dumpWriter.Write(row); err != nil {
+			return fmt.Errorf("write error: %w", err)
+		}
+		stats.written++
+		stats.bytesOut += int64(len(row))
+		return nil
+	}
+
+	stageStats := make([]passStats, len(stages))
+	var err error
+	if workers > 1 && isForkable(stages) {
+		stats.read, err = processConcurrently(
+			reader, entity.Table.SortedColumns, stages, stageStats, workers, write,
+		)
+	} else {
+		stats.read, err = processSequentially(
+			reader, entity.Table.SortedColumns, stages, stageStats, write,
+		)
+	}
+	if len(stageStats) > 0 {
+		stats.bytesIn = stageStats[0].bytesIn
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	if dumpWriter != nil {
+		endMarker := []byte("\\.\n\n")
+		if _, err := dumpWriter.Write(endMarker); err != nil {
+			return stats, fmt.Errorf("failed to write end marker to dump: %w", err)
+		}
+		// the codecs flush their last frame on Close, so its error means a truncated dump
+		writerClosed = true
+		if err := dumpWriter.Close(); err != nil {
+			return stats, fmt.Errorf("failed to close writer: %w", err)
+		}
+	}
+
+	for _, stage := range stages {
+		if err := stage.Flush(); err != nil {
+			return stats, err
+		}
+	}
+
+	stats.duration = time.Since(start)
+	for idx, stage := range stages {
+		if recorder, ok := stage.(passRecorder); ok {
+			stageStats[idx].duration = stats.duration
+			recorder.recordPass(stageStats[idx])
+		}
+	}
+	return stats, nil
+}
+
+// processRecord passes the record through the stages and reports whether it is kept.
+// The sizes of the records passed to and kept by the stages are added to stats.
+func processRecord(rec *storage.Record, stages []RowStage, stats []passStats) (bool, error) {
+	for idx, stage := range stages {
+		stats[idx].bytesIn += int64(len(rec.Row))
+		keep, err := stage.Process(rec)
+		if err != nil || !keep {
+			return false, err
+		}
+		if stage.Mutates() {
+			stats[idx].bytesOut += int64(len(rec.Row))
+		}
+	}
+	return true, nil
+}
+
+func processSequentially(
+	reader *bufio.Reader,
+	columns []string,
+	stages []RowStage,
+	stats []passStats,
+	write func(row []byte) error,
+) (int, error) {
+	lineCounter := 0
+	for {
+		rowLine, err := readNextLine(reader)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return lineCounter, err
+		}
+
+		lineCounter++
+		rec := storage.NewRecord(rowLine, columns)
+
+		keep, err := processRecord(rec, stages, stats)
+		if err != nil {
+			return lineCounter, err
+		}
+		if keep {
+			if err := write(rec.Row); err != nil {
+				return lineCounter, err
+			}
+		}
+	}
+	return lineCounter, nil
+}
+
+// isForkable reports whether all the stages can process batches concurrently.
+func isForkable(stages []RowStage) bool {
+	for _, stage := range stages {
+		forkable, ok := stage.(ForkableStage)
+		if !ok {
+			return false
+		}
+		if _, ok := forkable.Fork(); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// rowBatch is a batch of records processed by a single worker.
+type rowBatch struct {
+	seq   int
+	lines [][]byte
+	rows  [][]byte    // processed rows, nil for the dropped ones
+	forks []RowStage  // stages forked for the batch
+	stats []passStats // counters of the forked stages
+	err   error
+}
+
+// processConcurrently reads batches of records, processes them by the workers
+// and writes the results in the order of the records.
+func processConcurrently(
+	reader *bufio.Reader,
+	columns []string,
+	stages []RowStage,
+	stats []passStats,
+	workers int,
+	write func(row []byte) error,
+) (int, error) {
+	batches := make(chan *rowBatch, workers)
+	results := make(chan *rowBatch, workers)
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	defer func() {
+		// stop and wait for the goroutines, the reader is closed by the caller
+		close(done)
+		for range results {
+		}
+		<-readerDone
+	}()
+
+	// reader
+	go func() {
+		defer close(readerDone)
+		defer close(batches)
+		for seq := 0; ; seq++ {
+			batch := &rowBatch{seq: seq, lines: make([][]byte, 0, PIPELINE_BATCH_SIZE)}
+			eof := false
+			for len(batch.lines) < PIPELINE_BATCH_SIZE {
+				rowLine, err := readNextLine(reader)
+				if err != nil {
+					if err != io.EOF {
+						batch.err = err
+					}
+					eof = true
+					break
+				}
+				batch.lines = append(batch.lines, rowLine)
+			}
+
+			select {
+			case batches <- batch:
+			case <-done:
+				return
+			}
+			if eof {
+				return
+			}
+		}
+	}()
+
+	// workers
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				processBatch(batch, columns, stages)
+				select {
+				case results <- batch:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// ordered writer
+	lineCounter := 0
+	pending := make(map[int]*rowBatch)
+	next := 0
+	for batch := range results {
+		pending[batch.seq] = batch
+		for {
+			batch, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			lineCounter += len(batch.rows)
+			if batch.err != nil {
+				return lineCounter, batch.err
+			}
+			for _, row := range batch.rows {
+				if row == nil {
+					continue
+				}
+				if err := write(row); err != nil {
+					return lineCounter, err
+				}
+			}
+			for idx, stage := range stages {
+				if err := stage.(ForkableStage).Join(batch.forks[idx]); err != nil {
+					return lineCounter, err
+				}
+				stats[idx].bytesIn += batch.stats[idx].bytesIn
+				stats[idx].bytesOut += batch.stats[idx].bytesOut
+			}
+		}
+	}
+	return lineCounter, nil
+}
+
+// processBatch passes the records of the batch through the stages forked for the batch.
+func processBatch(batch *rowBatch, columns []string, stages []RowStage) {
+	if batch.err != nil {
+		return
+	}
+
+	batch.stats = make([]passStats, len(stages))
+	batch.forks = make([]RowStage, 0, len(stages))
+	for _, stage := range stages {
+		fork, _ := stage.(ForkableStage).Fork()
+		batch.forks = append(batch.forks, fork)
+	}
+
+	batch.rows = make([][]byte, 0, len(batch.lines))
+	for _, line := range batch.lines {
+		rec := storage.NewRecord(line, columns)
+		keep, err := processRecord(rec, batch.forks, batch.stats)
+		if err != nil {
+			batch.err = err
+			return
+		}
+		if keep {
+			batch.rows = append(batch.rows, rec.Row)
+		} else {
+			batch.rows = append(batch.rows, nil)
+		}
+	}
+}
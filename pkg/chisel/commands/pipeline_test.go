@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/actions"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+func TestPipelineCmd(t *testing.T) {
+	// GIVEN: A dump with multiple lines
+	dumpHandler := dumpio.NewDummyDumpHandler([]byte(buildTestContent()))
+	entity := newTestEntity(dumpHandler)
+	store, _ := storage.NewMapStringStorage(map[string][]string{})
+
+	// Row 1 is deleted, the name of row 2 is changed and the names of rows 1-3 are fetched.
+	deleteCmd := NewDeleteCmd(&entity, dumpHandler, columnEquals("id", "1"))
+	modifier, err := actions.NewCELModifier(map[string]string{"name": `"Changed"`})
+	require.NoError(t, err)
+	updateCmd := NewUpdateCmd(&entity, dumpHandler, columnEquals("id", "2"), modifier)
+	selectCmd := NewSelectCmd(
+		&entity,
+		dumpHandler,
+		columnEquals("id", "1", "2", "3"),
+		actions.NewDummyFetcher(store, []string{"name"}),
+	)
+
+	// WHEN: We execute the stages as a single PipelineCmd.
+	cmd := NewPipelineCmd(&entity, dumpHandler, []RowStage{deleteCmd, updateCmd, selectCmd})
+	err = cmd.Execute()
+
+	// THEN: Every stage sees the result of the previous ones, as if they were executed one by one.
+	require.NoError(t, err)
+	expected := strings.Join(
+		[]string{
+			"2\tChanged\t2@test.com\t12",
+			"3\tName3\t3@test.com\t13",
+			"4\tName4\t4@test.com\t14",
+			"5\tName5\t5@test.com\t15",
+			"\\.",
+			"\n",
+		},
+		"\n",
+	)
+	assert.Equal(t, expected, dumpHandler.Writer.Buff.String())
+	assert.Equal(t, []string{"Changed", "Name3"}, store.Get("name"))
+
+	// Stages count the records and bytes they have seen, the duration of the pass is shared.
+	deleteStats, updateStats, selectStats := deleteCmd.Stats(), updateCmd.Stats(), selectCmd.Stats()
+	assert.Positive(t, deleteStats.Duration)
+	assert.Equal(t, deleteStats.Duration, updateStats.Duration)
+	assert.Equal(t, deleteStats.Duration, selectStats.Duration)
+	deleteStats.Duration, updateStats.Duration, selectStats.Duration = 0, 0, 0
+
+	assert.Equal(t, Stats{
+		Read: 5, Matched: 1, Written: 4, Deleted: 1, BytesIn: 110, BytesOut: 88,
+	}, deleteStats)
+	assert.Equal(t, Stats{
+		Read: 4, Matched: 1, Written: 4, Modified: 1, BytesIn: 88, BytesOut: 90,
+	}, updateStats)
+	assert.Equal(t, Stats{Read: 4, Matched: 2, Fetched: 2, BytesIn: 90}, selectStats)
+	assert.Equal(t, 4, cmd.Stats().Written)
+}
+
+func TestPipelineCmd_ReadOnly(t *testing.T) {
+	// GIVEN: A pipeline of selects only.
+	dumpHandler := dumpio.NewDummyDumpHandler([]byte(buildTestContent()))
+	entity := newTestEntity(dumpHandler)
+	store, _ := storage.NewMapStringStorage(map[string][]string{})
+
+	stages := []RowStage{
+		NewSelectCmd(&entity, dumpHandler, columnEquals("id", "1"),
+			actions.NewDummyFetcher(store, []string{"id"})),
+		NewSelectCmd(&entity, dumpHandler, columnEquals("id", "5"),
+			actions.NewDummyFetcher(store, []string{"email"})),
+	}
+
+	// WHEN: We execute the PipelineCmd.
+	err := NewPipelineCmd(&entity, dumpHandler, stages).Execute()
+
+	// THEN: Both selects fetch their rows and the table is not rewritten.
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, store.Get("id"))
+	assert.Equal(t, []string{"5@test.com"}, store.Get("email"))
+	assert.Nil(t, dumpHandler.Writer.Buff)
+}
+
+// buildLargeTestContent returns rows spanning several batches.
+func buildLargeTestContent(rows int) string {
+	lines := make([]string, 0, rows+2)
+	for id := 1; id <= rows; id++ {
+		lines = append(lines, fmt.Sprintf("%d\tName%d\t%d@test.com\t%d", id, id, id, id%100))
+	}
+	return strings.Join(append(lines, "\\.", "\n"), "\n")
+}
+
+// runTestPipeline deletes rows with ids divisible by 3, changes the names of even rows
+// and fetches the ids and names of rows with ages below 10.
+func runTestPipeline(t *testing.T, content string, workers int) (string, storage.Storage) {
+	dumpHandler := dumpio.NewDummyDumpHandler([]byte(content))
+	entity := newTestEntity(dumpHandler)
+	store, _ := storage.NewMapStringStorage(map[string][]string{})
+
+	columnFilter := func(column string, matched func(val int) bool) RecordFilter {
+		return actions.NewDummyFilter(func(rec storage.RecordStore) bool {
+			val, _ := strconv.Atoi(string(rec.GetColumnMapping()[column]))
+			return matched(val)
+		})
+	}
+	modifier, err := actions.NewCELModifier(map[string]string{"name": `"Even"`})
+	require.NoError(t, err)
+
+	stages := []RowStage{
+		NewDeleteCmd(&entity, dumpHandler, columnFilter("id", func(id int) bool { return id%3 == 0 })),
+		NewUpdateCmd(&entity, dumpHandler, columnFilter("id", func(id int) bool { return id%2 == 0 }),
+			modifier),
+		NewSelectCmd(&entity, dumpHandler, columnFilter("age", func(age int) bool { return age < 10 }),
+			actions.NewDummyFetcher(store, []string{"id", "name"})),
+	}
+
+	cmd := NewPipelineCmd(&entity, dumpHandler, stages, WithWorkers(workers))
+	require.NoError(t, cmd.Execute())
+	return dumpHandler.Writer.Buff.String(), store
+}
+
+func TestPipelineCmd_Workers(t *testing.T) {
+	// GIVEN: A table spanning several batches.
+	content := buildLargeTestContent(5*PIPELINE_BATCH_SIZE + 17)
+
+	// WHEN: We execute the same pipeline by one and by several workers.
+	expected, expectedStore := runTestPipeline(t, content, 1)
+	actual, actualStore := runTestPipeline(t, content, 4)
+
+	// THEN: The rows are written and fetched in the same order.
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, expectedStore.Get("id"), actualStore.Get("id"))
+	assert.Equal(t, expectedStore.Get("name"), actualStore.Get("name"))
+	assert.NotEmpty(t, actualStore.Get("id"))
+}
+
+type failingFilter struct {
+	id string
+}
+
+func (f *failingFilter) IsMatched(rec storage.RecordStore) (bool, error) {
+	if string(rec.GetColumnMapping()["id"]) == f.id {
+		return false, errors.New("broken row")
+	}
+	return false, nil
+}
+
+func TestPipelineCmd_WorkersError(t *testing.T) {
+	// GIVEN: A filter failing on a row in the middle of the table.
+	dumpHandler := dumpio.NewDummyDumpHandler([]byte(buildLargeTestContent(3 * PIPELINE_BATCH_SIZE)))
+	entity := newTestEntity(dumpHandler)
+	deleteCmd := NewDeleteCmd(&entity, dumpHandler, &failingFilter{id: "1500"})
+
+	// WHEN: We execute the pipeline by several workers.
+	err := NewPipelineCmd(&entity, dumpHandler, []RowStage{deleteCmd}, WithWorkers(4)).Execute()
+
+	// THEN: The error is returned and the written rows are discarded.
+	assert.ErrorContains(t, err, "broken row")
+	assert.Nil(t, dumpHandler.Writer.Buff)
+}
+
+// failingCloseWriter fails to flush the dump on Close, e.g. when the disk is full.
+type failingCloseWriter struct {
+	dumpio.DummyWriter
+}
+
+func (w *failingCloseWriter) Close() error {
+	return errors.New("no space left on device")
+}
+
+type failingCloseHandler struct {
+	*dumpio.DummyDumpHandler
+	writer failingCloseWriter
+}
+
+func (h *failingCloseHandler) GetWriter() dumpio.DumpWriter {
+	return &h.writer
+}
+
+func TestPipelineCmd_CloseError(t *testing.T) {
+	// GIVEN: A dump whose writer fails on Close.
+	dumpHandler := &failingCloseHandler{
+		DummyDumpHandler: dumpio.NewDummyDumpHandler([]byte(buildTestContent())),
+	}
+	entity := newTestEntity(dumpHandler)
+	deleteCmd := NewDeleteCmd(&entity, dumpHandler, columnEquals("id", "1"))
+
+	// WHEN: We execute the pipeline.
+	err := NewPipelineCmd(&entity, dumpHandler, []RowStage{deleteCmd}).Execute()
+
+	// THEN: The task fails instead of leaving a truncated dump behind.
+	assert.ErrorContains(t, err, "failed to close writer: no space left on device")
+}
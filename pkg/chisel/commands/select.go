@@ -1,11 +1,8 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"log"
-	"time"
 
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 
@@ -22,6 +19,11 @@ type SelectCmd struct {
 	handler dumpio.DumpHandler
 	filter  RecordFilter
 	fetcher RecordFetcher
+
+	read    int
+	fetched int
+
+	passStats
 }
 
 func NewSelectCmd(
@@ -47,54 +49,98 @@ func NewSelectCmd(
 func (c *SelectCmd) Execute() error {
 	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "SelectCmd"))
 
-	dumpReader := c.handler.GetReader()
-	if err := dumpReader.Open(); err != nil {
-		return fmt.Errorf("failed to open reader: %w", err)
-	}
-	defer dumpReader.Close()
-
-	reader := bufio.NewReader(dumpReader)
-
-	start := time.Now()
-	lineCounter := 0
-	fetchedCounter := 0
-
-	for {
-		// TODO: move readNextLine to GetReader with RecordStore returning
-		rowLine, err := readNextLine(reader)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		lineCounter++
-		rec := storage.NewRecord(rowLine, c.entity.Table.SortedColumns)
+	c.read = 0
+	c.fetched = 0
 
-		matched, err := c.filter.IsMatched(rec)
-		if err != nil {
-			return fmt.Errorf("filter error: %w", err)
-		}
-
-		if matched {
-			fetchedCounter++
-			if err := c.fetcher.Fetch(rec); err != nil {
-				return fmt.Errorf("fetcher error: %w", err)
-			}
-		}
+	stats, err := runPipeline(c.entity, c.handler, []RowStage{c}, c.workers)
+	if err != nil {
+		return err
 	}
 
 	// Stats
-	duration := time.Since(start)
-	efficiency := float64(lineCounter) / duration.Seconds()
+	efficiency := float64(stats.read) / stats.duration.Seconds()
 	log.Printf(
 		"[DEBUG] STATS read=%d fetched=%d time=%.2fs efficiency=%.2f items/sec",
-		lineCounter, fetchedCounter, duration.Seconds(), efficiency,
+		stats.read, c.fetched, stats.duration.Seconds(), efficiency,
 	)
+	return nil
+}
+
+// Process fetches the matching record, all records are kept.
+func (c *SelectCmd) Process(rec storage.RecordStore) (bool, error) {
+	c.read++
 
+	matched, err := c.filter.IsMatched(rec)
+	if err != nil {
+		return false, fmt.Errorf("filter error: %w", err)
+	}
+
+	if matched {
+		c.fetched++
+		if err := c.fetcher.Fetch(rec); err != nil {
+			return false, fmt.Errorf("fetcher error: %w", err)
+		}
+	}
+	return true, nil
+}
+
+func (c *SelectCmd) Flush() error {
 	if err := c.fetcher.Flush(); err != nil {
 		return fmt.Errorf("fetcher flush error: %w", err)
 	}
 	return nil
 }
+
+func (c *SelectCmd) Mutates() bool {
+	return false
+}
+
+// Fork returns a copy of the command fetching into a fork of the fetcher.
+func (c *SelectCmd) Fork() (RowStage, bool) {
+	fetcher, ok := c.fetcher.(ForkableFetcher)
+	if !ok {
+		return nil, false
+	}
+	fetch, merge := fetcher.Fork()
+
+	return &SelectCmd{
+		CommandBase: c.CommandBase,
+		entity:      c.entity,
+		handler:     c.handler,
+		filter:      c.filter,
+		fetcher:     &forkedFetcher{fetch: fetch, merge: merge},
+	}, true
+}
+
+func (c *SelectCmd) Join(fork RowStage) error {
+	forked := fork.(*SelectCmd)
+	c.read += forked.read
+	c.fetched += forked.fetched
+	forked.fetcher.(*forkedFetcher).merge()
+	return nil
+}
+
+// forkedFetcher fetches the records of a single batch.
+type forkedFetcher struct {
+	fetch func(rec storage.RecordStore) error
+	merge func()
+}
+
+func (f *forkedFetcher) Fetch(rec storage.RecordStore) error {
+	return f.fetch(rec)
+}
+
+// Flush does nothing, the records are merged when the batch is joined.
+func (f *forkedFetcher) Flush() error {
+	return nil
+}
+
+func (c *SelectCmd) Stats() Stats {
+	return Stats{
+		Read:     c.read,
+		Matched:  c.fetched,
+		Fetched:  c.fetched,
+		BytesIn:  c.bytesIn,
+		Duration: c.duration,
+	}
+}
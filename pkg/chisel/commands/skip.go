@@ -0,0 +1,31 @@
+package commands
+
+import "log"
+
+// SkipCmd stands for a task which is not executed, e.g. a sync in a dry run.
+type SkipCmd struct {
+	CommandBase
+
+	reason string
+}
+
+func NewSkipCmd(reason string, opts ...CommandBaseOption) *SkipCmd {
+	cmd := SkipCmd{
+		reason: reason,
+	}
+
+	for _, opt := range opts {
+		opt(&cmd.CommandBase)
+	}
+	return &cmd
+}
+
+func (c *SkipCmd) Execute() error {
+	log.Printf("[INFO] Skip: %s (%s)", defaultIfEmpty(c.verboseName, "SkipCmd"), c.reason)
+	return nil
+}
+
+// Stats returns zero counters, nothing is done.
+func (c *SkipCmd) Stats() Stats {
+	return Stats{}
+}
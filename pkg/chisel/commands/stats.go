@@ -0,0 +1,40 @@
+package commands
+
+import "time"
+
+// Stats are the counters of the last execution of a command.
+type Stats struct {
+	Read     int           `json:"read"`    // records processed by the command
+	Matched  int           `json:"matched"` // records matched by the filter
+	Written  int           `json:"written"` // records written to the table
+	Deleted  int           `json:"deleted"`
+	Modified int           `json:"modified"`
+	Fetched  int           `json:"fetched"`   // records passed to the fetcher
+	BytesIn  int64         `json:"bytes_in"`  // size of the read table data
+	BytesOut int64         `json:"bytes_out"` // size of the written data
+	Duration time.Duration `json:"duration_ns"`
+	// StorageKeys are the keys set by the command itself, e.g. by subset.
+	StorageKeys []string `json:"-"`
+}
+
+// StatsReporter is a command reporting the counters of its last execution.
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// passStats are the counters of a stage measured by the pipeline during the table pass.
+// Stages of a fused pipeline share the duration of the pass.
+type passStats struct {
+	bytesIn  int64
+	bytesOut int64
+	duration time.Duration
+}
+
+// passRecorder is a stage receiving the counters measured by the pipeline.
+type passRecorder interface {
+	recordPass(stats passStats)
+}
+
+func (s *passStats) recordPass(stats passStats) {
+	*s = stats
+}
@@ -0,0 +1,410 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+)
+
+type SubsetFollow string
+
+const (
+	// FOLLOW_PARENTS keeps the root rows and the rows they reference.
+	FOLLOW_PARENTS SubsetFollow = "parents"
+	// FOLLOW_BOTH also keeps the rows referencing the kept rows, and the rows they reference.
+	FOLLOW_BOTH SubsetFollow = "both"
+)
+
+// ParseSubsetFollow converts a string into a SubsetFollow constant.
+// An empty string means FOLLOW_PARENTS.
+func ParseSubsetFollow(s string) (SubsetFollow, error) {
+	switch s {
+	case "", string(FOLLOW_PARENTS):
+		return FOLLOW_PARENTS, nil
+	case string(FOLLOW_BOTH):
+		return FOLLOW_BOTH, nil
+	default:
+		return "", fmt.Errorf("invalid subset follow: %q", s)
+	}
+}
+
+// SubsetRoot selects the rows of a table the subset starts from.
+type SubsetRoot struct {
+	Entity *dump.Entity
+	Filter RecordFilter
+}
+
+// SubsetRelation is a foreign key between two table entities.
+type SubsetRelation struct {
+	Name       string
+	Child      *dump.Entity
+	Columns    []string
+	Parent     *dump.Entity
+	RefColumns []string
+}
+
+// SubsetCmd keeps a referentially consistent subset of the tables connected
+// to the root tables by foreign keys. Kept rows are found with repeated SelectCmd
+// passes until no new keys are found, then the other rows are removed with DeleteCmd.
+//
+// A row is kept if it matches a root filter, if it references a row kept by following
+// children (FOLLOW_BOTH only), or if it is referenced by a kept row.
+type SubsetCmd struct {
+	CommandBase
+
+	roots     []SubsetRoot
+	relations []SubsetRelation
+	follow    SubsetFollow
+	store     storage.Storage
+
+	stats Stats
+}
+
+func NewSubsetCmd(
+	roots []SubsetRoot,
+	relations []SubsetRelation,
+	follow SubsetFollow,
+	store storage.Storage,
+	opts ...CommandBaseOption,
+) *SubsetCmd {
+	cmd := SubsetCmd{
+		roots:     roots,
+		relations: relations,
+		follow:    follow,
+		store:     store,
+	}
+
+	for _, opt := range opts {
+		opt(&cmd.CommandBase)
+	}
+	return &cmd
+}
+
+// subsetTable is a table of the subset with its root filters and foreign keys.
+type subsetTable struct {
+	entity   *dump.Entity
+	roots    []RecordFilter
+	parents  []*subsetRelation // foreign keys of the table
+	children []*subsetRelation // foreign keys referencing the table
+
+	inputs int // number of keys the table was scanned with, -1 before the first scan
+}
+
+type subsetRelation struct {
+	SubsetRelation
+
+	// RefColumns values of parent rows kept by following children
+	downKeys map[string]struct{}
+	// Columns values of kept child rows
+	upKeys map[string]struct{}
+	// RefColumns values of kept parent rows
+	keptKeys map[string]struct{}
+}
+
+func (c *SubsetCmd) Execute() error {
+	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "SubsetCmd"))
+
+	start := time.Now()
+	c.stats = Stats{}
+	tables := c.buildTables()
+
+	for round := 1; ; round++ {
+		scanned := 0
+		for _, table := range tables {
+			inputs := table.countInputs(c.follow)
+			if table.inputs == inputs {
+				continue
+			}
+			table.inputs = inputs
+			scanned++
+
+			if err := c.scan(table); err != nil {
+				return fmt.Errorf("subset scan of %s error: %w", table.entity.Meta.Name, err)
+			}
+		}
+		if scanned == 0 {
+			break
+		}
+		log.Printf("[DEBUG] Subset round %d: %d tables scanned", round, scanned)
+	}
+
+	for _, table := range tables {
+		visitor := &subsetVisitor{table: table, follow: c.follow}
+		deleteCmd := NewDeleteCmd(
+			table.entity,
+			table.entity.DumpHandler,
+			&subsetDeleteFilter{visitor: visitor},
+			WithVerboseName(fmt.Sprintf("DELETE FROM %s NOT IN SUBSET", table.entity.Meta.Name)),
+		)
+		if err := deleteCmd.Execute(); err != nil {
+			return fmt.Errorf("subset delete from %s error: %w", table.entity.Meta.Name, err)
+		}
+		c.addStats(deleteCmd.Stats())
+	}
+
+	c.storeKeys(tables)
+	c.stats.Duration = time.Since(start)
+	return nil
+}
+
+// addStats sums up the counters of the delete pass over a table of the subset.
+func (c *SubsetCmd) addStats(stats Stats) {
+	c.stats.Read += stats.Read
+	c.stats.Matched += stats.Written
+	c.stats.Written += stats.Written
+	c.stats.Deleted += stats.Deleted
+	c.stats.BytesIn += stats.BytesIn
+	c.stats.BytesOut += stats.BytesOut
+}
+
+// Stats returns the counters of the delete passes, Matched counts the kept rows.
+func (c *SubsetCmd) Stats() Stats {
+	return c.stats
+}
+
+// buildTables returns the tables connected to the root tables by foreign keys.
+func (c *SubsetCmd) buildTables() []*subsetTable {
+	byId := make(map[int]*subsetTable)
+	var tables []*subsetTable
+	getTable := func(entity *dump.Entity) *subsetTable {
+		if table, ok := byId[entity.Id]; ok {
+			return table
+		}
+		table := &subsetTable{entity: entity, inputs: -1}
+		byId[entity.Id] = table
+		tables = append(tables, table)
+		return table
+	}
+
+	for _, root := range c.roots {
+		table := getTable(root.Entity)
+		table.roots = append(table.roots, root.Filter)
+	}
+
+	// add relations touching already added tables until nothing changes
+	added := make([]bool, len(c.relations))
+	for changed := true; changed; {
+		changed = false
+		for idx, relation := range c.relations {
+			if added[idx] {
+				continue
+			}
+			_, hasChild := byId[relation.Child.Id]
+			_, hasParent := byId[relation.Parent.Id]
+			if !hasChild && !hasParent {
+				continue
+			}
+
+			rel := &subsetRelation{
+				SubsetRelation: relation,
+				downKeys:       make(map[string]struct{}),
+				upKeys:         make(map[string]struct{}),
+				keptKeys:       make(map[string]struct{}),
+			}
+			child, parent := getTable(relation.Child), getTable(relation.Parent)
+			child.parents = append(child.parents, rel)
+			parent.children = append(parent.children, rel)
+			added[idx] = true
+			changed = true
+		}
+	}
+	return tables
+}
+
+// countInputs returns the number of keys the kept rows of the table depend on.
+func (t *subsetTable) countInputs(follow SubsetFollow) int {
+	inputs := 0
+	if follow == FOLLOW_BOTH {
+		for _, rel := range t.parents {
+			inputs += len(rel.downKeys)
+		}
+	}
+	for _, rel := range t.children {
+		inputs += len(rel.upKeys)
+	}
+	return inputs
+}
+
+// scan reads the table and collects the keys of its kept rows.
+func (c *SubsetCmd) scan(table *subsetTable) error {
+	visitor := &subsetVisitor{table: table, follow: c.follow}
+	selectCmd := NewSelectCmd(
+		table.entity,
+		table.entity.DumpHandler,
+		visitor,
+		visitor,
+		WithVerboseName(fmt.Sprintf("SELECT KEYS FROM %s FOR SUBSET", table.entity.Meta.Name)),
+	)
+	return selectCmd.Execute()
+}
+
+// storeKeys saves the kept keys of referenced tables to the storage
+// as "subset.<table>.<columns>", e.g. "subset.users.id".
+func (c *SubsetCmd) storeKeys(tables []*subsetTable) {
+	for _, table := range tables {
+		for _, rel := range table.children {
+			key := fmt.Sprintf(
+				"subset.%s.%s",
+				table.entity.Meta.Name,
+				strings.Join(rel.RefColumns, ","),
+			)
+			values := make([]string, 0, len(rel.keptKeys))
+			for value := range rel.keptKeys {
+				values = append(values, value)
+			}
+			c.store.Set(key, values)
+			if !slices.Contains(c.stats.StorageKeys, key) {
+				c.stats.StorageKeys = append(c.stats.StorageKeys, key)
+			}
+		}
+	}
+}
+
+// subsetVisitor decides whether rows of the table are kept. It is both the filter
+// and the fetcher of SelectCmd: the fetcher collects the keys of matched rows.
+type subsetVisitor struct {
+	table  *subsetTable
+	follow SubsetFollow
+
+	// the last checked record, SelectCmd fetches the record right after filtering
+	rec     storage.RecordStore
+	columns map[string][]byte
+	down    bool
+
+	downKeys map[*subsetRelation][]string
+	upKeys   map[*subsetRelation][]string
+}
+
+func (v *subsetVisitor) IsMatched(rec storage.RecordStore) (bool, error) {
+	v.rec = rec
+	v.columns = rec.GetColumnMapping()
+
+	down, err := v.isKeptDown()
+	if err != nil {
+		return false, err
+	}
+	v.down = down
+	if down {
+		return true, nil
+	}
+
+	for _, rel := range v.table.children {
+		if key, ok := v.key(rel.RefColumns); ok {
+			if _, exists := rel.upKeys[key]; exists {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// isKeptDown reports whether the row is a root row or, following children,
+// references a row kept the same way.
+func (v *subsetVisitor) isKeptDown() (bool, error) {
+	for _, filter := range v.table.roots {
+		matched, err := filter.IsMatched(v.rec)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+
+	if v.follow != FOLLOW_BOTH {
+		return false, nil
+	}
+	for _, rel := range v.table.parents {
+		if key, ok := v.key(rel.Columns); ok {
+			if _, exists := rel.downKeys[key]; exists {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// key joins the values of the columns, ok is false if any of them is NULL.
+func (v *subsetVisitor) key(columns []string) (string, bool) {
+	if len(columns) == 1 {
+		if v.rec.IsNull(columns[0]) {
+			return "", false
+		}
+		return string(v.columns[columns[0]]), true
+	}
+
+	values := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if v.rec.IsNull(column) {
+			return "", false
+		}
+		values = append(values, string(v.columns[column]))
+	}
+	// text values can not contain the zero byte
+	return strings.Join(values, "\x00"), true
+}
+
+func (v *subsetVisitor) Fetch(rec storage.RecordStore) error {
+	if rec != v.rec {
+		if _, err := v.IsMatched(rec); err != nil {
+			return err
+		}
+	}
+
+	if v.downKeys == nil {
+		v.downKeys = make(map[*subsetRelation][]string)
+		v.upKeys = make(map[*subsetRelation][]string)
+	}
+	if v.down {
+		for _, rel := range v.table.children {
+			if key, ok := v.key(rel.RefColumns); ok {
+				v.downKeys[rel] = append(v.downKeys[rel], key)
+			}
+		}
+	}
+	for _, rel := range v.table.parents {
+		if key, ok := v.key(rel.Columns); ok {
+			v.upKeys[rel] = append(v.upKeys[rel], key)
+		}
+	}
+	return nil
+}
+
+// Flush adds the fetched keys to the relations.
+func (v *subsetVisitor) Flush() error {
+	for rel, keys := range v.downKeys {
+		for _, key := range keys {
+			rel.downKeys[key] = struct{}{}
+		}
+	}
+	for rel, keys := range v.upKeys {
+		for _, key := range keys {
+			rel.upKeys[key] = struct{}{}
+		}
+	}
+	clear(v.downKeys)
+	clear(v.upKeys)
+	return nil
+}
+
+// subsetDeleteFilter matches the rows which are not kept
+// and collects the keys of the kept ones.
+type subsetDeleteFilter struct {
+	visitor *subsetVisitor
+}
+
+func (f *subsetDeleteFilter) IsMatched(rec storage.RecordStore) (bool, error) {
+	kept, err := f.visitor.IsMatched(rec)
+	if err != nil || !kept {
+		return !kept, err
+	}
+
+	for _, rel := range f.visitor.table.children {
+		if key, ok := f.visitor.key(rel.RefColumns); ok {
+			rel.keptKeys[key] = struct{}{}
+		}
+	}
+	return false, nil
+}
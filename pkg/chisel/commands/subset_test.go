@@ -0,0 +1,217 @@
+package commands
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/actions"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+func newSubsetTestEntity(id int, name string, columns []string, rows ...string) *dump.Entity {
+	content := strings.Join(append(rows, "\\.", "\n"), "\n")
+	table := &dump.TableMeta{
+		Name:          name,
+		Schema:        "public",
+		Columns:       make(map[string]*dump.ColumnMeta),
+		SortedColumns: columns,
+	}
+	for idx, column := range columns {
+		table.Columns[column] = &dump.ColumnMeta{Position: idx}
+	}
+	return &dump.Entity{
+		Id:          id,
+		Meta:        dump.EntityMeta{Name: name},
+		Table:       table,
+		DumpHandler: dumpio.NewDummyDumpHandler([]byte(content)),
+	}
+}
+
+// subsetTestSchema builds users with a self-referencing manager_id,
+// orders referencing users and products, and unrelated logs.
+func subsetTestSchema() (users, orders, products, logs *dump.Entity, relations []SubsetRelation) {
+	users = newSubsetTestEntity(1, "users", []string{"id", "manager_id"},
+		"1\t\\N",
+		"2\t1",
+		"3\t2",
+		"4\t\\N",
+		"5\t4",
+	)
+	orders = newSubsetTestEntity(2, "orders", []string{"id", "user_id", "product_id"},
+		"10\t1\t100",
+		"11\t2\t101",
+		"12\t3\t\\N",
+		"13\t1\t102",
+		"14\t5\t103",
+	)
+	products = newSubsetTestEntity(3, "products", []string{"id"},
+		"100",
+		"101",
+		"102",
+		"103",
+		"104",
+	)
+	logs = newSubsetTestEntity(4, "logs", []string{"id"}, "1", "2")
+
+	relation := func(child *dump.Entity, column string, parent *dump.Entity) SubsetRelation {
+		return SubsetRelation{
+			Name:       child.Meta.Name + "_" + column + "_fkey",
+			Child:      child,
+			Columns:    []string{column},
+			Parent:     parent,
+			RefColumns: []string{"id"},
+		}
+	}
+	relations = []SubsetRelation{
+		relation(users, "manager_id", users),
+		relation(orders, "user_id", users),
+		relation(orders, "product_id", products),
+	}
+	return users, orders, products, logs, relations
+}
+
+func columnEquals(column string, values ...string) RecordFilter {
+	return actions.NewDummyFilter(func(rec storage.RecordStore) bool {
+		return slices.Contains(values, string(rec.GetColumnMapping()[column]))
+	})
+}
+
+// subsetOutput returns the first column of the rewritten rows.
+func subsetOutput(t *testing.T, entity *dump.Entity) []string {
+	writer := entity.DumpHandler.(*dumpio.DummyDumpHandler).Writer
+	require.NotNil(t, writer.Buff, "table %s was not rewritten", entity.Meta.Name)
+
+	var ids []string
+	for _, line := range strings.Split(writer.Buff.String(), "\n") {
+		if line == "\\." {
+			break
+		}
+		ids = append(ids, strings.Split(line, "\t")[0])
+	}
+	return ids
+}
+
+func TestSubsetCmd_FollowParents(t *testing.T) {
+	// GIVEN: users, orders and products linked by foreign keys, and unrelated logs.
+	users, orders, products, logs, relations := subsetTestSchema()
+	store, _ := storage.NewMapStringStorage(map[string][]string{})
+
+	// The subset starts from the order of user 3, who is managed by 2, who is managed by 1.
+	roots := []SubsetRoot{{Entity: orders, Filter: columnEquals("id", "12")}}
+	cmd := NewSubsetCmd(roots, relations, FOLLOW_PARENTS, store)
+
+	// WHEN: We execute the SubsetCmd.
+	err := cmd.Execute()
+
+	// THEN: The order and all rows it references transitively are kept,
+	// NULL references are ignored.
+	require.NoError(t, err)
+	assert.Equal(t, []string{"12"}, subsetOutput(t, orders))
+	assert.Equal(t, []string{"1", "2", "3"}, subsetOutput(t, users))
+	assert.Empty(t, subsetOutput(t, products))
+	logsWriter := logs.DumpHandler.(*dumpio.DummyDumpHandler).Writer
+	assert.Nil(t, logsWriter.Buff, "unrelated table is untouched")
+
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, store.Get("subset.users.id"))
+	assert.Empty(t, store.Get("subset.products.id"))
+
+	// The delete passes are summed up, logs are not read.
+	stats := cmd.Stats()
+	assert.Equal(t, 15, stats.Read)
+	assert.Equal(t, 4, stats.Written)
+	assert.Equal(t, 11, stats.Deleted)
+	assert.ElementsMatch(t, []string{"subset.users.id", "subset.products.id"}, stats.StorageKeys)
+}
+
+func TestSubsetCmd_FollowBoth(t *testing.T) {
+	// GIVEN: users, orders and products linked by foreign keys.
+	users, orders, products, _, relations := subsetTestSchema()
+	store, _ := storage.NewMapStringStorage(map[string][]string{})
+
+	// The subset starts from user 1.
+	roots := []SubsetRoot{{Entity: users, Filter: columnEquals("id", "1")}}
+	cmd := NewSubsetCmd(roots, relations, FOLLOW_BOTH, store)
+
+	// WHEN: We execute the SubsetCmd.
+	err := cmd.Execute()
+
+	// THEN: Users managed by user 1 (transitively), their orders and the ordered products are kept.
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, subsetOutput(t, users))
+	assert.Equal(t, []string{"10", "11", "12", "13"}, subsetOutput(t, orders))
+	assert.Equal(t, []string{"100", "101", "102"}, subsetOutput(t, products))
+
+	assert.ElementsMatch(t, []string{"100", "101", "102"}, store.Get("subset.products.id"))
+}
+
+func TestSubsetCmd_SeveralRoots(t *testing.T) {
+	// GIVEN: users, orders and products linked by foreign keys.
+	users, orders, products, _, relations := subsetTestSchema()
+	store, _ := storage.NewMapStringStorage(map[string][]string{})
+
+	// The subset starts from user 4 and product 104.
+	roots := []SubsetRoot{
+		{Entity: users, Filter: columnEquals("id", "4")},
+		{Entity: products, Filter: columnEquals("id", "104")},
+	}
+	cmd := NewSubsetCmd(roots, relations, FOLLOW_BOTH, store)
+
+	// WHEN: We execute the SubsetCmd.
+	err := cmd.Execute()
+
+	// THEN: Rows reachable from both roots are kept.
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4", "5"}, subsetOutput(t, users))
+	assert.Equal(t, []string{"14"}, subsetOutput(t, orders))
+	assert.Equal(t, []string{"103", "104"}, subsetOutput(t, products))
+}
+
+func TestSubsetCmd_CompositeKey(t *testing.T) {
+	// GIVEN: items referencing orders by a composite key.
+	orders := newSubsetTestEntity(1, "orders", []string{"id", "shop"},
+		"1\ta",
+		"1\tb",
+		"2\ta",
+	)
+	items := newSubsetTestEntity(2, "items", []string{"id", "order_id", "shop"},
+		"1\t1\tb",
+		"2\t2\t\\N",
+	)
+	relations := []SubsetRelation{{
+		Child:      items,
+		Columns:    []string{"order_id", "shop"},
+		Parent:     orders,
+		RefColumns: []string{"id", "shop"},
+	}}
+	store, _ := storage.NewMapStringStorage(map[string][]string{})
+
+	roots := []SubsetRoot{{Entity: items, Filter: columnEquals("id", "1", "2")}}
+	cmd := NewSubsetCmd(roots, relations, FOLLOW_PARENTS, store)
+
+	// WHEN: We execute the SubsetCmd.
+	err := cmd.Execute()
+
+	// THEN: Only the order matching all key columns is kept.
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, subsetOutput(t, items))
+	assert.Equal(t, []string{"1"}, subsetOutput(t, orders))
+	assert.Equal(t, []string{"1\x00b"}, store.Get("subset.orders.id,shop"))
+}
+
+func TestParseSubsetFollow(t *testing.T) {
+	follow, err := ParseSubsetFollow("")
+	require.NoError(t, err)
+	assert.Equal(t, FOLLOW_PARENTS, follow)
+
+	follow, err = ParseSubsetFollow("both")
+	require.NoError(t, err)
+	assert.Equal(t, FOLLOW_BOTH, follow)
+
+	_, err = ParseSubsetFollow("children")
+	assert.Error(t, err)
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type SyncType string
@@ -37,6 +38,8 @@ type SyncDirCmd struct {
 	Type SyncType
 	Src  string
 	Dst  string
+
+	stats Stats
 }
 
 func NewSyncDirCmd(
@@ -62,6 +65,9 @@ func NewSyncDirCmd(
 func (c *SyncDirCmd) Execute() error {
 	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "SyncDirCmd"))
 
+	start := time.Now()
+	c.stats = Stats{}
+
 	// Validate that source exists and is a directory.
 	srcInfo, err := os.Stat(c.Src)
 	if err != nil {
@@ -80,9 +86,15 @@ func (c *SyncDirCmd) Execute() error {
 	if err != nil {
 		return fmt.Errorf("walk error: %w", err)
 	}
+	c.stats.Duration = time.Since(start)
 	return nil
 }
 
+// Stats returns the number of copied bytes, hard links are not counted.
+func (c *SyncDirCmd) Stats() Stats {
+	return c.stats
+}
+
 func (c *SyncDirCmd) syncFileVisitor(path string, info os.FileInfo, walkErr error) error {
 	// If the filepath.Walk encounters an error accessing a file/directory, walkErr will be non-nil.
 	if walkErr != nil {
@@ -155,9 +167,11 @@ func (c *SyncDirCmd) copyFileContents(src, dst string) (err error) {
 	}()
 
 	// Copy file data from source to destination.
-	if _, err = io.Copy(out, in); err != nil {
+	written, err := io.Copy(out, in)
+	if err != nil {
 		return fmt.Errorf("io copy error: %w", err)
 	}
+	c.stats.BytesOut += written
 
 	// Ensure the data is physically written to disk.
 	if err = out.Sync(); err != nil {
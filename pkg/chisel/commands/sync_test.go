@@ -45,6 +45,7 @@ func TestSyncDirCmd_Copy(t *testing.T) {
 		assert.NoError(t, err, "failed to read copied file")
 		assert.Equal(t, f.content, string(dstContent), "copied file content mismatch")
 	}
+	assert.Equal(t, int64(len("hello world")+len("golang testing")), cmd.Stats().BytesOut)
 }
 
 // TestSyncDirCmd_HardLink tests the HARD_LINK_SYNC functionality.
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/zwergpro/pg-chisel/pkg/dump"
 	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
@@ -13,6 +14,8 @@ type TruncateCmd struct {
 
 	entity  *dump.Entity
 	handler dumpio.DumpHandler
+
+	stats Stats
 }
 
 func NewTruncateCmd(
@@ -34,16 +37,30 @@ func NewTruncateCmd(
 func (c *TruncateCmd) Execute() error {
 	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "TruncateCmd"))
 
+	start := time.Now()
+	c.stats = Stats{}
+
 	dumpWriter := c.handler.GetWriter()
 	if err := dumpWriter.Open(); err != nil {
 		return fmt.Errorf("failed to open writer: %w", err)
 	}
-	defer dumpWriter.Close()
 
 	endMarker := []byte("\\.\n\n")
 	if _, err := dumpWriter.Write(endMarker); err != nil {
+		if abortErr := dumpWriter.Abort(); abortErr != nil {
+			log.Printf("[ERROR] Cannot discard written data of %s: %v", c.entity.Meta.Name, abortErr)
+		}
 		return fmt.Errorf("failed to write end marker to dump: %w", err)
 	}
+	if err := dumpWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close writer: %w", err)
+	}
 
+	c.stats.Duration = time.Since(start)
 	return nil
 }
+
+// Stats returns no record counters, the data of the table is not read.
+func (c *TruncateCmd) Stats() Stats {
+	return c.stats
+}
@@ -49,7 +49,7 @@ func TestTruncateCmd_Execute(t *testing.T) {
 		writer := mocks.NewDumpWriter(t)
 		writer.On("Open").Return(nil)
 		writer.On("Write", []byte("\\.\n\n")).Return(0, errors.New("write error"))
-		writer.On("Close").Return(nil)
+		writer.On("Abort").Return(nil)
 
 		handler := mocks.NewDumpHandler(t)
 		handler.On("GetWriter").Return(writer)
@@ -76,7 +76,7 @@ func TestTruncateCmd_Execute(t *testing.T) {
 		cmd := NewTruncateCmd(&dump.Entity{}, handler)
 
 		err := cmd.Execute()
-		require.NoError(t, err, "close errors should not fail execution")
+		require.ErrorContains(t, err, "failed to close writer: close error")
 
 		writer.AssertExpectations(t)
 		handler.AssertExpectations(t)
@@ -1,11 +1,8 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"log"
-	"time"
 
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 
@@ -20,6 +17,11 @@ type UpdateCmd struct {
 	handler  dumpio.DumpHandler
 	filter   RecordFilter
 	modifier RecordModifier
+
+	read     int
+	modified int
+
+	passStats
 }
 
 func NewUpdateCmd(
@@ -45,68 +47,77 @@ func NewUpdateCmd(
 func (c *UpdateCmd) Execute() error {
 	log.Printf("[INFO] Execute: %s", defaultIfEmpty(c.verboseName, "UpdateCmd"))
 
-	dumpReader := c.handler.GetReader()
-	if err := dumpReader.Open(); err != nil {
-		return fmt.Errorf("failed to open reader: %w", err)
-	}
-	defer dumpReader.Close()
+	c.read = 0
+	c.modified = 0
 
-	dumpWriter := c.handler.GetWriter()
-	if err := dumpWriter.Open(); err != nil {
-		return fmt.Errorf("failed to open writer: %w", err)
+	stats, err := runPipeline(c.entity, c.handler, []RowStage{c}, c.workers)
+	if err != nil {
+		return err
 	}
-	defer dumpWriter.Close()
-
-	reader := bufio.NewReader(dumpReader)
 
-	start := time.Now()
-	lineCounter := 0
-	modifiedCounter := 0
-
-	for {
-		rowLine, err := readNextLine(reader)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		lineCounter++
-		rec := storage.NewRecord(rowLine, c.entity.Table.SortedColumns)
+	// Stats
+	efficiency := float64(stats.read) / stats.duration.Seconds()
+	log.Printf(
+		"[DEBUG] STATS read=%d modified=%d time=%.2fs efficiency=%.2f items/sec",
+		stats.read, c.modified, stats.duration.Seconds(), efficiency,
+	)
+	return nil
+}
 
-		matched, err := c.filter.IsMatched(rec)
-		if err != nil {
-			return fmt.Errorf("filter error: %w", err)
-		}
+// Process modifies the matching record in place, all records are kept.
+func (c *UpdateCmd) Process(rec storage.RecordStore) (bool, error) {
+	c.read++
 
-		if matched {
-			modifiedCounter++
-			// Apply the modification in place
-			if err := c.modifier.Modify(rec); err != nil {
-				return fmt.Errorf("modifier error: %w", err)
-			}
-			// Refresh the raw Row from modified columns
-			rec.Refresh()
-		}
+	matched, err := c.filter.IsMatched(rec)
+	if err != nil {
+		return false, fmt.Errorf("filter error: %w", err)
+	}
 
-		if _, writeErr := dumpWriter.Write(rec.Row); writeErr != nil {
-			return fmt.Errorf("write error: %w", writeErr)
+	if matched {
+		c.modified++
+		// Apply the modification in place
+		if err := c.modifier.Modify(rec); err != nil {
+			return false, fmt.Errorf("modifier error: %w", err)
 		}
+		// Refresh the raw Row from modified columns
+		rec.Refresh()
 	}
+	return true, nil
+}
 
-	endMarker := []byte("\\.\n\n")
-	if _, err := dumpWriter.Write(endMarker); err != nil {
-		return fmt.Errorf("failed to write end marker to dump: %w", err)
-	}
+func (c *UpdateCmd) Flush() error {
+	return nil
+}
 
-	// Stats
-	duration := time.Since(start)
-	efficiency := float64(lineCounter) / duration.Seconds()
-	log.Printf(
-		"[DEBUG] STATS read=%d modified=%d time=%.2fs efficiency=%.2f items/sec",
-		lineCounter, modifiedCounter, duration.Seconds(), efficiency,
-	)
+func (c *UpdateCmd) Mutates() bool {
+	return true
+}
+
+func (c *UpdateCmd) Fork() (RowStage, bool) {
+	return &UpdateCmd{
+		CommandBase: c.CommandBase,
+		entity:      c.entity,
+		handler:     c.handler,
+		filter:      c.filter,
+		modifier:    c.modifier,
+	}, true
+}
 
+func (c *UpdateCmd) Join(fork RowStage) error {
+	forked := fork.(*UpdateCmd)
+	c.read += forked.read
+	c.modified += forked.modified
 	return nil
 }
+
+func (c *UpdateCmd) Stats() Stats {
+	return Stats{
+		Read:     c.read,
+		Matched:  c.modified,
+		Written:  c.read,
+		Modified: c.modified,
+		BytesIn:  c.bytesIn,
+		BytesOut: c.bytesOut,
+		Duration: c.duration,
+	}
+}
@@ -105,3 +105,29 @@ func TestModifyCmd(t *testing.T) {
 
 	assert.Equal(t, expected, actual, "output mismatch after applying CEL modifier")
 }
+
+// TestModifyLiteralNullStringCmd verifies that the NULL constant sets SQL NULL, also inside
+// an expression, and that a table column is copied as SQL NULL or as the literal \N string.
+func TestModifyLiteralNullStringCmd(t *testing.T) {
+	// GIVEN: A dump whose second row has the literal \N name and a NULL email.
+	inputContent := strings.Replace(buildTestContent(), "Name2\t2@test.com", "\\\\N\t\\N", 1)
+	dumpHandler := dumpio.NewDummyDumpHandler([]byte(inputContent))
+	entity := newTestEntity(dumpHandler)
+
+	filter := actions.NewDummyFilter(func(rec storage.RecordStore) bool {
+		return string(rec.GetColumnMapping()["id"]) == "2"
+	})
+	modifier, err := actions.NewCELModifier(map[string]string{
+		"name":  `table.name`,
+		"email": `table["email"]`,
+		"age":   `string(table.id) == "2" ? NULL : string(table.age)`,
+	})
+	assert.NoError(t, err, "unexpected error creating CEL modifier")
+
+	// WHEN: We execute the UpdateCmd.
+	err = NewUpdateCmd(&entity, dumpHandler, filter, modifier).Execute()
+
+	// THEN: The literal name is kept, the NULL email is copied and the age is set to NULL.
+	assert.NoError(t, err, "unexpected error executing updateCmd")
+	assert.Contains(t, dumpHandler.Writer.Buff.String(), "\n2\t\\\\N\t\\N\t\\N\n")
+}
@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"log"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// BloomFilter is an approximate set: it may report a value which was never added,
+// with the false-positive rate it was sized for, but never misses an added value.
+type BloomFilter struct {
+	bits     []uint64
+	m        uint64 // number of bits
+	k        uint64 // number of hash functions
+	seeds    [2]maphash.Seed
+	capacity int // number of values the filter is sized for
+	values   int
+}
+
+// NewBloomFilter sizes the filter for n values and the false-positive rate.
+func NewBloomFilter(n int, fpRate float64) *BloomFilter {
+	return newBloomFilter(n, fpRate, [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()})
+}
+
+func newBloomFilter(n int, fpRate float64, seeds [2]maphash.Seed) *BloomFilter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	// the optimal number of hashes of the sized filter, it does not depend on n
+	k := max(uint64(math.Round(-math.Log2(fpRate))), 1)
+	return &BloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		seeds:    seeds,
+		capacity: n,
+	}
+}
+
+// hashValue returns the two hashes the k bit positions are derived from.
+func hashValue(seeds [2]maphash.Seed, value string) (uint64, uint64) {
+	return maphash.String(seeds[0], value), maphash.String(seeds[1], value) | 1
+}
+
+func (f *BloomFilter) Add(value string) {
+	h1, h2 := hashValue(f.seeds, value)
+	f.addHashes(h1, h2)
+}
+
+func (f *BloomFilter) addHashes(h1, h2 uint64) {
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+	f.values++
+}
+
+// MayContain reports whether the value may have been added.
+func (f *BloomFilter) MayContain(value string) bool {
+	if f == nil {
+		return false
+	}
+	h1, h2 := hashValue(f.seeds, value)
+	return f.mayContainHashes(h1, h2)
+}
+
+func (f *BloomFilter) mayContainHashes(h1, h2 uint64) bool {
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Values returns the number of added values, duplicates included.
+func (f *BloomFilter) Values() int {
+	if f == nil {
+		return 0
+	}
+	return f.values
+}
+
+// EstimatedLen estimates the number of distinct added values from the number of set bits.
+func (f *BloomFilter) EstimatedLen() int {
+	if f == nil {
+		return 0
+	}
+	set := 0
+	for _, word := range f.bits {
+		set += bits.OnesCount64(word)
+	}
+	if uint64(set) >= f.m {
+		return f.values
+	}
+	m, k := float64(f.m), float64(f.k)
+	estimated := int(math.Round(-m / k * math.Log(1-float64(set)/m)))
+	return min(estimated, f.values)
+}
+
+// SizeInBytes returns the size of the bit array.
+func (f *BloomFilter) SizeInBytes() int {
+	return len(f.bits) * 8
+}
+
+// BLOOM_GROWTH is the capacity growth of the stages of a ScalableBloomFilter,
+// and BLOOM_TIGHTENING the ratio of their false-positive rates.
+const (
+	BLOOM_GROWTH     = 2
+	BLOOM_TIGHTENING = 0.5
+)
+
+// ScalableBloomFilter is a bloom filter growing with the added values: once a stage holds
+// the values it was sized for, a larger stage with a lower false-positive rate is added,
+// so the false-positive rate of the filter stays below its target whatever the number of
+// values. A filter sized for the actual number of values has a single stage.
+type ScalableBloomFilter struct {
+	stages []*BloomFilter
+	fpRate float64 // false-positive rate of the last stage
+	seeds  [2]maphash.Seed
+	values int
+}
+
+// NewScalableBloomFilter sizes the first stage for the expected number of values.
+func NewScalableBloomFilter(expected int, fpRate float64) *ScalableBloomFilter {
+	seeds := [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()}
+	// the rates of the stages are a geometric series summing up to fpRate
+	first := fpRate * (1 - BLOOM_TIGHTENING)
+	return &ScalableBloomFilter{
+		stages: []*BloomFilter{newBloomFilter(expected, first, seeds)},
+		fpRate: first,
+		seeds:  seeds,
+	}
+}
+
+// Add inserts the value in the last stage, unless some stage may already contain it,
+// so the duplicates do not grow the filter.
+func (f *ScalableBloomFilter) Add(value string) {
+	f.values++
+	h1, h2 := hashValue(f.seeds, value)
+	if f.mayContainHashes(h1, h2) {
+		return
+	}
+	last := f.stages[len(f.stages)-1]
+	if last.values >= last.capacity {
+		f.fpRate *= BLOOM_TIGHTENING
+		last = newBloomFilter(last.capacity*BLOOM_GROWTH, f.fpRate, f.seeds)
+		f.stages = append(f.stages, last)
+	}
+	last.addHashes(h1, h2)
+}
+
+// MayContain reports whether the value may have been added.
+func (f *ScalableBloomFilter) MayContain(value string) bool {
+	if f == nil {
+		return false
+	}
+	h1, h2 := hashValue(f.seeds, value)
+	return f.mayContainHashes(h1, h2)
+}
+
+func (f *ScalableBloomFilter) mayContainHashes(h1, h2 uint64) bool {
+	for _, stage := range f.stages {
+		if stage.mayContainHashes(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the number of added values, duplicates included.
+func (f *ScalableBloomFilter) Values() int {
+	if f == nil {
+		return 0
+	}
+	return f.values
+}
+
+// EstimatedLen estimates the number of distinct added values from the stages.
+func (f *ScalableBloomFilter) EstimatedLen() int {
+	if f == nil {
+		return 0
+	}
+	estimated := 0
+	for _, stage := range f.stages {
+		estimated += stage.EstimatedLen()
+	}
+	return estimated
+}
+
+// SizeInBytes returns the size of the bit arrays.
+func (f *ScalableBloomFilter) SizeInBytes() int {
+	size := 0
+	for _, stage := range f.stages {
+		size += stage.SizeInBytes()
+	}
+	return size
+}
+
+// Stages returns the number of stages of the filter.
+func (f *ScalableBloomFilter) Stages() int {
+	return len(f.stages)
+}
+
+// ErrApproximateKey is returned when a bloom key is read as an exact set.
+var ErrApproximateKey = errors.New("key is approximate, use maybe_in()")
+
+// BloomKey declares a storage key kept as a bloom filter.
+type BloomKey struct {
+	// FPRate is the target false-positive rate.
+	FPRate float64
+	// Expected is the expected number of values, the filter grows past it.
+	Expected int
+}
+
+// BloomStorage keeps the declared keys as bloom filters, the values of these keys are not kept,
+// so they can only be queried by MayContain. Other keys are kept by the wrapped storage.
+type BloomStorage struct {
+	Storage
+	mu      sync.RWMutex
+	keys    map[string]BloomKey
+	filters map[string]*ScalableBloomFilter
+}
+
+// NewBloomStorage wraps the storage, keys are the declarations of the bloom keys.
+func NewBloomStorage(store Storage, keys map[string]BloomKey) *BloomStorage {
+	return &BloomStorage{
+		Storage: store,
+		keys:    keys,
+		filters: make(map[string]*ScalableBloomFilter),
+	}
+}
+
+// IsApproximate reports whether the key is kept as a bloom filter.
+func (s *BloomStorage) IsApproximate(key string) bool {
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *BloomStorage) filter(key string) *ScalableBloomFilter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filters[key]
+}
+
+func (s *BloomStorage) Get(key string) []string {
+	if s.IsApproximate(key) {
+		log.Printf("[WARN] Values of bloom key %s are not kept: %v", key, ErrApproximateKey)
+		return nil
+	}
+	return s.Storage.Get(key)
+}
+
+func (s *BloomStorage) GetSet(key string) map[string]struct{} {
+	if s.IsApproximate(key) {
+		log.Printf("[WARN] Values of bloom key %s are not kept: %v", key, ErrApproximateKey)
+		return nil
+	}
+	return s.Storage.GetSet(key)
+}
+
+func (s *BloomStorage) Set(key string, values []string) {
+	if !s.IsApproximate(key) {
+		s.Storage.Set(key, values)
+		return
+	}
+	filter := NewScalableBloomFilter(len(values), s.keys[key].FPRate)
+	for _, value := range values {
+		filter.Add(value)
+	}
+	s.setFilter(key, filter)
+}
+
+func (s *BloomStorage) setFilter(key string, filter *ScalableBloomFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters[key] = filter
+	log.Printf(
+		"[DEBUG] Bloom key %s: %d values in %d bytes, %d stages",
+		key, filter.Values(), filter.SizeInBytes(), filter.Stages(),
+	)
+	if expected := s.keys[key].Expected; expected > 0 && filter.Stages() > 1 {
+		log.Printf(
+			"[INFO] Bloom key %s has more values than expected (%d), set a larger expected",
+			key, expected,
+		)
+	}
+}
+
+func (s *BloomStorage) Delete(key string) {
+	if !s.IsApproximate(key) {
+		s.Storage.Delete(key)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.filters, key)
+}
+
+// MayContain queries the filter of a bloom key, other keys are queried exactly.
+func (s *BloomStorage) MayContain(key, value string) (bool, error) {
+	if s.IsApproximate(key) {
+		return s.filter(key).MayContain(value), nil
+	}
+	return s.Contains(key, value)
+}
+
+// The optional interfaces of the wrapped storage are forwarded.
+
+func (s *BloomStorage) Contains(key, value string) (bool, error) {
+	if s.IsApproximate(key) {
+		return false, fmt.Errorf("%s: %w", key, ErrApproximateKey)
+	}
+	if sets, ok := s.Storage.(SetStorage); ok {
+		return sets.Contains(key, value)
+	}
+	_, found := s.Storage.GetSet(key)[value]
+	return found, nil
+}
+
+// Size of a bloom key returns the estimated number of distinct values.
+func (s *BloomStorage) Size(key string) (int, int) {
+	if s.IsApproximate(key) {
+		filter := s.filter(key)
+		return filter.Values(), filter.EstimatedLen()
+	}
+	if sets, ok := s.Storage.(SetStorage); ok {
+		return sets.Size(key)
+	}
+	return len(s.Storage.Get(key)), len(s.Storage.GetSet(key))
+}
+
+func (s *BloomStorage) Values(key string) ([]string, error) {
+	if s.IsApproximate(key) {
+		return nil, fmt.Errorf("%s: %w", key, ErrApproximateKey)
+	}
+	if sets, ok := s.Storage.(SetStorage); ok {
+		return sets.Values(key)
+	}
+	return s.Storage.Get(key), nil
+}
+
+func (s *BloomStorage) GetIntSet(key string) (*IntSet, error) {
+	if s.IsApproximate(key) {
+		return nil, fmt.Errorf("%s: %w", key, ErrApproximateKey)
+	}
+	if intSets, ok := s.Storage.(IntSetStorage); ok {
+		return intSets.GetIntSet(key)
+	}
+	values := s.Storage.Get(key)
+	if values == nil {
+		return nil, nil
+	}
+	return ParseIntSet(values)
+}
+
+// NewKeyWriter of a bloom key adds the values to a filter sized for the expected number
+// of values, which replaces the filter of the key on Close.
+func (s *BloomStorage) NewKeyWriter(key string) KeyWriter {
+	if bloomKey, ok := s.keys[key]; ok {
+		return &bloomKeyWriter{
+			storage: s,
+			key:     key,
+			filter:  NewScalableBloomFilter(bloomKey.Expected, bloomKey.FPRate),
+		}
+	}
+	if streams, ok := s.Storage.(StreamStorage); ok {
+		return streams.NewKeyWriter(key)
+	}
+	return &setKeyWriter{storage: s.Storage, key: key}
+}
+
+type bloomKeyWriter struct {
+	storage *BloomStorage
+	key     string
+	filter  *ScalableBloomFilter
+}
+
+func (w *bloomKeyWriter) Add(value string) error {
+	w.filter.Add(value)
+	return nil
+}
+
+func (w *bloomKeyWriter) Close() error {
+	w.storage.setFilter(w.key, w.filter)
+	w.filter = nil
+	return nil
+}
+
+// setKeyWriter collects the values and sets them on Close.
+type setKeyWriter struct {
+	storage Storage
+	key     string
+	values  []string
+}
+
+func (w *setKeyWriter) Add(value string) error {
+	w.values = append(w.values, value)
+	return nil
+}
+
+func (w *setKeyWriter) Close() error {
+	w.storage.Set(w.key, w.values)
+	w.values = nil
+	return nil
+}
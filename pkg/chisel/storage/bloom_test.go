@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// maxFalsePositives bounds the false positives of the queries at the target rate
+// six standard deviations above their mean, as the seeds of the filters are random.
+func maxFalsePositives(queries int, fpRate float64) int {
+	mean := float64(queries) * fpRate
+	return int(mean + 6*math.Sqrt(mean))
+}
+
+func TestBloomFilter(t *testing.T) {
+	// GIVEN: A filter sized for 10000 values with a 1% false-positive rate.
+	filter := NewBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.Add(fmt.Sprintf("user-%d", i))
+	}
+
+	// WHEN: Added and other values are queried.
+	for i := 0; i < 10000; i++ {
+		require.True(t, filter.MayContain(fmt.Sprintf("user-%d", i)), "added values are never missed")
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.MayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	// THEN: The false-positive rate is close to the target.
+	assert.LessOrEqual(t, falsePositives, maxFalsePositives(10000, 0.01))
+	assert.InDelta(t, 10000, filter.EstimatedLen(), 300)
+	assert.Less(t, filter.SizeInBytes(), 10000*2, "about 10 bits per value")
+}
+
+func TestScalableBloomFilter(t *testing.T) {
+	// GIVEN: A filter expecting 1000 values, which gets 20000 values and their duplicates.
+	filter := NewScalableBloomFilter(1000, 0.01)
+	for i := 0; i < 20000; i++ {
+		filter.Add(fmt.Sprintf("user-%d", i))
+		filter.Add(fmt.Sprintf("user-%d", i/2))
+	}
+
+	// WHEN: Added and other values are queried.
+	for i := 0; i < 20000; i++ {
+		require.True(t, filter.MayContain(fmt.Sprintf("user-%d", i)), "added values are never missed")
+	}
+	falsePositives := 0
+	for i := 0; i < 20000; i++ {
+		if filter.MayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	// THEN: The filter grew and keeps the false-positive rate below the target.
+	assert.Greater(t, filter.Stages(), 1)
+	assert.LessOrEqual(t, falsePositives, maxFalsePositives(20000, 0.01))
+	assert.Equal(t, 40000, filter.Values())
+	assert.InDelta(t, 20000, filter.EstimatedLen(), 600)
+
+	// AND: A filter sized for its values has a single stage.
+	exact := NewScalableBloomFilter(20000, 0.01)
+	for i := 0; i < 20000; i++ {
+		exact.Add(fmt.Sprintf("user-%d", i))
+	}
+	assert.Equal(t, 1, exact.Stages())
+}
+
+func TestBloomStorage(t *testing.T) {
+	// GIVEN: A storage keeping "stale" as a bloom filter.
+	inner, _ := NewMapStringStorage(map[string][]string{"ids": {"1", "2"}})
+	store := NewBloomStorage(inner, map[string]BloomKey{"stale": {FPRate: 0.01, Expected: 100}})
+
+	// WHEN: The bloom key is written through a writer, and an exact key with Set.
+	w := store.NewKeyWriter("stale")
+	for _, value := range []string{"a", "b", "a"} {
+		require.NoError(t, w.Add(value))
+	}
+	require.NoError(t, w.Close())
+	store.Set("ids", []string{"3"})
+
+	// THEN: The bloom key can only be queried approximately, the exact keys are forwarded.
+	found, err := store.MayContain("stale", "a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Nil(t, store.Get("stale"), "values of a bloom key are not kept")
+	_, err = store.Contains("stale", "a")
+	assert.ErrorIs(t, err, ErrApproximateKey)
+	_, err = store.GetIntSet("stale")
+	assert.ErrorIs(t, err, ErrApproximateKey)
+	values, distinct := store.Size("stale")
+	assert.Equal(t, 3, values)
+	assert.Equal(t, 2, distinct)
+
+	assert.Equal(t, []string{"3"}, inner.Get("ids"))
+	found, err = store.MayContain("ids", "3")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = store.MayContain("ids", "1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	store.Delete("stale")
+	found, _ = store.MayContain("stale", "a")
+	assert.False(t, found)
+}
@@ -0,0 +1,106 @@
+package storage
+
+import "bytes"
+
+// NULL_VALUE is the COPY text representation of SQL NULL.
+const NULL_VALUE = "\\N"
+
+// decodeCopyText decodes a single field of the COPY text format.
+// It follows the rules of PostgreSQL's CopyReadAttributesText: \b, \f, \n, \r, \t, \v
+// are control characters, \digits is an octal byte, \xdigits is a hex byte and
+// any other escaped character is taken literally.
+func decodeCopyText(raw []byte) []byte {
+	if bytes.IndexByte(raw, '\\') == -1 {
+		return raw
+	}
+
+	res := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i+1 == len(raw) {
+			res = append(res, c)
+			continue
+		}
+
+		i++
+		c = raw[i]
+		switch {
+		case isOctalDigit(c):
+			val := c - '0'
+			for n := 1; n < 3 && i+1 < len(raw) && isOctalDigit(raw[i+1]); n++ {
+				i++
+				val = val<<3 + raw[i] - '0'
+			}
+			res = append(res, val)
+		case c == 'x' && i+1 < len(raw) && isHexDigit(raw[i+1]):
+			i++
+			val := hexValue(raw[i])
+			if i+1 < len(raw) && isHexDigit(raw[i+1]) {
+				i++
+				val = val<<4 + hexValue(raw[i])
+			}
+			res = append(res, val)
+		case c == 'b':
+			res = append(res, '\b')
+		case c == 'f':
+			res = append(res, '\f')
+		case c == 'n':
+			res = append(res, '\n')
+		case c == 'r':
+			res = append(res, '\r')
+		case c == 't':
+			res = append(res, '\t')
+		case c == 'v':
+			res = append(res, '\v')
+		default:
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// encodeCopyText encodes a value as a field of the COPY text format,
+// the same way PostgreSQL's CopyAttributeOutText does.
+func encodeCopyText(val []byte) []byte {
+	res := make([]byte, 0, len(val))
+	for _, c := range val {
+		switch c {
+		case '\\':
+			res = append(res, '\\', '\\')
+		case '\b':
+			res = append(res, '\\', 'b')
+		case '\f':
+			res = append(res, '\\', 'f')
+		case '\n':
+			res = append(res, '\\', 'n')
+		case '\r':
+			res = append(res, '\\', 'r')
+		case '\t':
+			res = append(res, '\\', 't')
+		case '\v':
+			res = append(res, '\\', 'v')
+		default:
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func isOctalDigit(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
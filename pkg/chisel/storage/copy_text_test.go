@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCopyText(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{"plain", "hello", "hello"},
+		{"empty", "", ""},
+		{"backslash", `a\\b`, `a\b`},
+		{"control characters", `\b\f\n\r\t\v`, "\b\f\n\r\t\v"},
+		{"octal", `\101\0\12`, "A\x00\n"},
+		{"octal stops after three digits", `\1011`, "A1"},
+		{"octal stops at non octal digit", `\18`, "\x018"},
+		{"hex", `\x41\x4a\xA`, "AJ\n"},
+		{"hex stops after two digits", `\x414`, "A4"},
+		{"x without hex digits", `\xg`, "xg"},
+		{"unknown escape", `\a\.\N`, `a.N`},
+		{"trailing backslash", `abc\`, `abc\`},
+		{"utf8", `привет\tмир`, "привет\tмир"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, []byte(tt.expected), decodeCopyText([]byte(tt.raw)))
+		})
+	}
+}
+
+func TestEncodeCopyText(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      string
+		expected string
+	}{
+		{"plain", "hello", "hello"},
+		{"empty", "", ""},
+		{"backslash", `a\b`, `a\\b`},
+		{"control characters", "\b\f\n\r\t\v", `\b\f\n\r\t\v`},
+		{"literal null marker", `\N`, `\\N`},
+		{"end of data marker", `\.`, `\\.`},
+		{"utf8", "привет\tмир", `привет\tмир`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, []byte(tt.expected), encodeCopyText([]byte(tt.val)))
+		})
+	}
+}
+
+func TestCopyText_RoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"simple",
+		"tab\there",
+		"multi\nline\r\ntext",
+		`C:\path\to\file`,
+		`\N`,
+		`\\N`,
+		"\x00\x01\x7f",
+		"trailing backslash\\",
+		"{\"json\": \"a\\tb\"}",
+	}
+
+	for _, val := range values {
+		encoded := encodeCopyText([]byte(val))
+		assert.NotContains(t, string(encoded), "\t", "encoded value must not contain tabs")
+		assert.NotContains(t, string(encoded), "\n", "encoded value must not contain newlines")
+		assert.Equal(t, []byte(val), decodeCopyText(encoded), "round trip of %q", val)
+	}
+}
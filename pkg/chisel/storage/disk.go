@@ -0,0 +1,616 @@
+package storage
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DISK_BLOCK_SIZE is the size of the blocks of a set file indexed in memory.
+const DISK_BLOCK_SIZE = 4096
+
+// stringOverhead approximates the memory used by a string besides its bytes.
+const stringOverhead = 16
+
+// DiskStorage keeps the keys in memory while they fit in the memory limit. Larger keys
+// are spilled to files: the values in the written order, read back by Get, and the sorted
+// distinct values with a sparse in-memory index, which answer Contains.
+// Values are sorted in runs of the memory limit, which are merged on Close of the writer.
+type DiskStorage struct {
+	mu      sync.RWMutex
+	dir     string
+	limit   int64 // bytes of the in-memory keys and of the sort buffer of a writer
+	memory  *MapStringStorage
+	memSize map[string]int64 // bytes of the in-memory keys
+	used    int64
+	keys    map[string]*diskKey // spilled keys
+	seq     atomic.Int64
+}
+
+type diskKey struct {
+	valuesPath string
+	setPath    string
+	set        *os.File
+	setSize    int64
+	index      []diskBlock
+	values     int
+	distinct   int
+
+	warnOnce   sync.Once // warns once that the set is loaded in memory
+	intSetOnce sync.Once
+	intSet     *IntSet
+	intSetErr  error
+}
+
+// diskBlock is a block of the set file starting with the value.
+type diskBlock struct {
+	first  string
+	offset int64
+}
+
+// NewDiskStorage creates a storage spilling to a new temp directory in dir,
+// or in the default temp directory if dir is empty. memoryLimit is in bytes.
+func NewDiskStorage(
+	initial map[string][]string,
+	dir string,
+	memoryLimit int64,
+) (*DiskStorage, error) {
+	if memoryLimit <= 0 {
+		return nil, fmt.Errorf("memory limit must be positive, got %d", memoryLimit)
+	}
+	tmpDir, err := os.MkdirTemp(dir, "chisel-storage-")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create storage directory: %w", err)
+	}
+	memory, _ := NewMapStringStorage(nil)
+
+	s := &DiskStorage{
+		dir:     tmpDir,
+		limit:   memoryLimit,
+		memory:  memory,
+		memSize: make(map[string]int64),
+		keys:    make(map[string]*diskKey),
+	}
+	for key, values := range initial {
+		s.Set(key, values)
+	}
+	return s, nil
+}
+
+// Dir returns the directory of the storage files.
+func (s *DiskStorage) Dir() string {
+	return s.dir
+}
+
+// Close removes the files of the storage.
+func (s *DiskStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, k := range s.keys {
+		k.close()
+		delete(s.keys, key)
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("cannot remove storage directory: %w", err)
+	}
+	return nil
+}
+
+// Get returns the values of the key, a spilled key is read from its file on every call
+// and a read error is only logged: use Values or Contains instead.
+func (s *DiskStorage) Get(key string) []string {
+	values, err := s.Values(key)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		return nil
+	}
+	return values
+}
+
+// Values reads the values of a spilled key from its file.
+func (s *DiskStorage) Values(key string) ([]string, error) {
+	s.mu.RLock()
+	k, spilled := s.keys[key]
+	s.mu.RUnlock()
+	if !spilled {
+		return s.memory.Get(key), nil
+	}
+
+	values := make([]string, 0, k.values)
+	err := readValues(k.valuesPath, func(value string) {
+		values = append(values, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read values of %s: %w", key, err)
+	}
+	return values, nil
+}
+
+// GetSet loads the set of a spilled key in memory on every call, use Contains instead.
+func (s *DiskStorage) GetSet(key string) map[string]struct{} {
+	s.mu.RLock()
+	k, spilled := s.keys[key]
+	s.mu.RUnlock()
+	if !spilled {
+		return s.memory.GetSet(key)
+	}
+
+	k.warnOnce.Do(func() {
+		log.Printf("[WARN] Set of spilled key %s is loaded in memory", key)
+	})
+	set := make(map[string]struct{}, k.distinct)
+	err := readValues(k.setPath, func(value string) {
+		set[value] = struct{}{}
+	})
+	if err != nil {
+		log.Printf("[ERROR] Cannot read set of %s: %v", key, err)
+		return nil
+	}
+	return set
+}
+
+// Set replaces the values of the key, the key is kept in memory if it can not be spilled.
+func (s *DiskStorage) Set(key string, values []string) {
+	w := s.NewKeyWriter(key).(*diskKeyWriter)
+	for _, value := range values {
+		if err := w.Add(value); err != nil {
+			log.Printf("[WARN] Key %s is kept in memory: %v", key, err)
+			w.abort()
+			s.setMemory(key, values, valuesSize(values), true)
+			return
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("[WARN] Key %s is kept in memory: %v", key, err)
+		s.setMemory(key, values, valuesSize(values), true)
+	}
+}
+
+func (s *DiskStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteLocked(key)
+}
+
+func (s *DiskStorage) Contains(key, value string) (bool, error) {
+	s.mu.RLock()
+	k, spilled := s.keys[key]
+	s.mu.RUnlock()
+	if !spilled {
+		_, ok := s.memory.GetSet(key)[value]
+		return ok, nil
+	}
+	return k.contains(value)
+}
+
+func (s *DiskStorage) Size(key string) (int, int) {
+	s.mu.RLock()
+	k, spilled := s.keys[key]
+	s.mu.RUnlock()
+	if !spilled {
+		return len(s.memory.Get(key)), len(s.memory.GetSet(key))
+	}
+	return k.values, k.distinct
+}
+
+// GetIntSet builds the int set of a spilled key from its set file, without loading the values.
+func (s *DiskStorage) GetIntSet(key string) (*IntSet, error) {
+	s.mu.RLock()
+	k, spilled := s.keys[key]
+	s.mu.RUnlock()
+	if !spilled {
+		return s.memory.GetIntSet(key)
+	}
+
+	k.intSetOnce.Do(func() {
+		log.Printf("[DEBUG] Make int set of spilled key %s", key)
+		set := NewIntSet()
+		var parseErr error
+		err := readValues(k.setPath, func(value string) {
+			if parseErr == nil {
+				parseErr = set.AddString(value)
+			}
+		})
+		switch {
+		case err != nil:
+			k.intSetErr = fmt.Errorf("cannot read set of %s: %w", key, err)
+		case parseErr != nil:
+			k.intSetErr = fmt.Errorf("key %s: %w", key, parseErr)
+		default:
+			set.bitmap.RunOptimize()
+			k.intSet = set
+		}
+	})
+	return k.intSet, k.intSetErr
+}
+
+func (s *DiskStorage) NewKeyWriter(key string) KeyWriter {
+	return &diskKeyWriter{storage: s, key: key}
+}
+
+// setMemory replaces the key with the in-memory values. Unless force is set,
+// it fails if the values do not fit in the memory limit.
+func (s *DiskStorage) setMemory(key string, values []string, size int64, force bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !force && s.used-s.memSize[key]+size > s.limit {
+		return false
+	}
+	s.deleteLocked(key)
+	s.memory.Set(key, values)
+	s.memSize[key] = size
+	s.used += size
+	return true
+}
+
+func (s *DiskStorage) setDisk(key string, k *diskKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteLocked(key)
+	s.keys[key] = k
+	log.Printf("[DEBUG] Key %s is spilled to disk: %d values, %d distinct", key, k.values, k.distinct)
+}
+
+func (s *DiskStorage) deleteLocked(key string) {
+	if k, ok := s.keys[key]; ok {
+		k.close()
+		delete(s.keys, key)
+	}
+	if size, ok := s.memSize[key]; ok {
+		s.used -= size
+		delete(s.memSize, key)
+		s.memory.Delete(key)
+	}
+}
+
+func (s *DiskStorage) newPath(kind string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.%s", s.seq.Add(1), kind))
+}
+
+// diskKeyWriter buffers the values up to the memory limit, then writes them
+// to the values file and to a sorted run.
+type diskKeyWriter struct {
+	storage *DiskStorage
+	key     string
+
+	buffer []string
+	size   int64
+	values int
+
+	valuesPath string
+	valuesFile *os.File
+	valuesW    *bufio.Writer
+	runs       []string
+}
+
+func (w *diskKeyWriter) Add(value string) error {
+	w.buffer = append(w.buffer, value)
+	w.size += int64(len(value)) + stringOverhead
+	w.values++
+	if w.size > w.storage.limit {
+		return w.spill()
+	}
+	return nil
+}
+
+func (w *diskKeyWriter) Close() error {
+	if w.valuesFile == nil && w.storage.setMemory(w.key, w.buffer, w.size, false) {
+		return nil
+	}
+
+	if err := w.spill(); err != nil {
+		w.abort()
+		return err
+	}
+	err := w.valuesW.Flush()
+	if closeErr := w.valuesFile.Close(); err == nil {
+		err = closeErr
+	}
+	w.valuesFile = nil
+	if err != nil {
+		w.abort()
+		return fmt.Errorf("cannot write values: %w", err)
+	}
+
+	k, err := w.merge()
+	if err != nil {
+		w.abort()
+		return err
+	}
+	w.storage.setDisk(w.key, k)
+	return nil
+}
+
+// spill appends the buffer to the values file and writes it as a sorted run.
+func (w *diskKeyWriter) spill() error {
+	if w.valuesFile == nil {
+		w.valuesPath = w.storage.newPath("values")
+		file, err := os.Create(w.valuesPath)
+		if err != nil {
+			return fmt.Errorf("cannot create values file: %w", err)
+		}
+		w.valuesFile = file
+		w.valuesW = bufio.NewWriterSize(file, 64*1024)
+	}
+	for _, value := range w.buffer {
+		if err := writeValue(w.valuesW, value); err != nil {
+			return fmt.Errorf("cannot write values: %w", err)
+		}
+	}
+
+	slices.Sort(w.buffer)
+	w.buffer = slices.Compact(w.buffer)
+	runPath := w.storage.newPath("run")
+	w.runs = append(w.runs, runPath)
+	err := writeFile(runPath, func(bw *bufio.Writer) error {
+		for _, value := range w.buffer {
+			if err := writeValue(bw, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write sorted run: %w", err)
+	}
+
+	w.buffer = nil
+	w.size = 0
+	return nil
+}
+
+// merge merges the sorted runs into the set file and indexes its blocks.
+func (w *diskKeyWriter) merge() (*diskKey, error) {
+	k := &diskKey{
+		valuesPath: w.valuesPath,
+		setPath:    w.storage.newPath("set"),
+		values:     w.values,
+	}
+
+	runs := make(runHeap, 0, len(w.runs))
+	defer func() {
+		for _, run := range runs {
+			run.file.Close()
+		}
+	}()
+	for _, path := range w.runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open sorted run: %w", err)
+		}
+		run := &runReader{file: file, r: bufio.NewReaderSize(file, 64*1024)}
+		runs = append(runs, run)
+		if err := run.next(); err != nil {
+			return nil, err
+		}
+	}
+	heap.Init(&runs)
+
+	err := writeFile(k.setPath, func(bw *bufio.Writer) error {
+		var last string
+		var offset, blockStart int64
+		for len(runs) > 0 && !runs[0].done {
+			run := runs[0]
+			value := run.value
+			if k.distinct == 0 || value != last {
+				if k.distinct == 0 || offset-blockStart >= DISK_BLOCK_SIZE {
+					k.index = append(k.index, diskBlock{first: value, offset: offset})
+					blockStart = offset
+				}
+				if err := writeValue(bw, value); err != nil {
+					return err
+				}
+				offset += int64(valueSize(value))
+				k.distinct++
+				last = value
+			}
+			if err := run.next(); err != nil {
+				return err
+			}
+			heap.Fix(&runs, 0)
+		}
+		k.setSize = offset
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot merge sorted runs: %w", err)
+	}
+	for _, path := range w.runs {
+		_ = os.Remove(path)
+	}
+	w.runs = nil
+
+	if k.set, err = os.Open(k.setPath); err != nil {
+		return nil, fmt.Errorf("cannot open set file: %w", err)
+	}
+	return k, nil
+}
+
+// abort removes the files written so far.
+func (w *diskKeyWriter) abort() {
+	if w.valuesFile != nil {
+		w.valuesFile.Close()
+		w.valuesFile = nil
+	}
+	if w.valuesPath != "" {
+		_ = os.Remove(w.valuesPath)
+	}
+	for _, path := range w.runs {
+		_ = os.Remove(path)
+	}
+	w.runs = nil
+}
+
+var blockPool = sync.Pool{New: func() any { b := make([]byte, 2*DISK_BLOCK_SIZE); return &b }}
+
+// contains looks the value up in the only block which can hold it.
+func (k *diskKey) contains(value string) (bool, error) {
+	idx := sort.Search(len(k.index), func(i int) bool { return k.index[i].first > value }) - 1
+	if idx < 0 {
+		return false, nil
+	}
+	start, end := k.index[idx].offset, k.setSize
+	if idx+1 < len(k.index) {
+		end = k.index[idx+1].offset
+	}
+
+	bufPtr := blockPool.Get().(*[]byte)
+	defer blockPool.Put(bufPtr)
+	if int64(cap(*bufPtr)) < end-start {
+		*bufPtr = make([]byte, end-start)
+	}
+	block := (*bufPtr)[:end-start]
+	if _, err := k.set.ReadAt(block, start); err != nil {
+		return false, fmt.Errorf("cannot read set block: %w", err)
+	}
+
+	for len(block) > 0 {
+		length, n := binary.Uvarint(block)
+		if n <= 0 || uint64(len(block)-n) < length {
+			return false, errors.New("corrupted set block")
+		}
+		current := block[n : n+int(length)]
+		if string(current) == value {
+			return true, nil
+		}
+		if string(current) > value {
+			return false, nil
+		}
+		block = block[n+int(length):]
+	}
+	return false, nil
+}
+
+func (k *diskKey) close() {
+	if k.set != nil {
+		k.set.Close()
+	}
+	_ = os.Remove(k.valuesPath)
+	_ = os.Remove(k.setPath)
+}
+
+// runReader reads the values of a sorted run.
+type runReader struct {
+	file  *os.File
+	r     *bufio.Reader
+	value string
+	done  bool
+}
+
+func (r *runReader) next() error {
+	value, err := readValue(r.r)
+	if errors.Is(err, io.EOF) {
+		r.done = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read sorted run: %w", err)
+	}
+	r.value = value
+	return nil
+}
+
+// runHeap orders the runs by their current value, finished runs go last.
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].done != h[j].done {
+		return !h[i].done
+	}
+	return h[i].value < h[j].value
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
+
+// Values are written as their uvarint length followed by the bytes.
+
+func writeValue(w *bufio.Writer, value string) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(value)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.WriteString(value)
+	return err
+}
+
+func readValue(r *bufio.Reader) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func valueSize(value string) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], uint64(len(value))) + len(value)
+}
+
+func valuesSize(values []string) int64 {
+	size := int64(0)
+	for _, value := range values {
+		size += int64(len(value)) + stringOverhead
+	}
+	return size
+}
+
+func readValues(path string, fn func(value string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, 64*1024)
+	for {
+		value, err := readValue(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(value)
+	}
+}
+
+func writeFile(path string, write func(bw *bufio.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(file, 64*1024)
+	err = write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStorage_SmallKeysInMemory(t *testing.T) {
+	// GIVEN: A storage with a limit fitting the key.
+	dir := t.TempDir()
+	store, err := NewDiskStorage(map[string][]string{"fruits": {"apple", "banana"}}, dir, 1024)
+	require.NoError(t, err)
+	defer store.Close()
+
+	// WHEN: The key is read.
+	values := store.Get("fruits")
+	found, err := store.Contains("fruits", "banana")
+
+	// THEN: It is kept in memory.
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apple", "banana"}, values)
+	assert.True(t, found)
+	assert.Empty(t, store.keys)
+}
+
+func TestDiskStorage_SpilledKey(t *testing.T) {
+	// GIVEN: A key written in several runs, with duplicates across them.
+	dir := t.TempDir()
+	store, err := NewDiskStorage(nil, dir, 1024)
+	require.NoError(t, err)
+
+	var expected []string
+	w := store.NewKeyWriter("users.id")
+	for i := 0; i < 5000; i++ {
+		value := fmt.Sprintf("%d", (i*7919)%3000)
+		expected = append(expected, value)
+		require.NoError(t, w.Add(value))
+	}
+
+	// WHEN: The writer is closed.
+	require.NoError(t, w.Close())
+
+	// THEN: The key is spilled and keeps the array and set semantics.
+	require.Contains(t, store.keys, "users.id")
+	assert.Greater(t, len(store.keys["users.id"].index), 1)
+	assert.Equal(t, expected, store.Get("users.id"))
+	assert.Len(t, store.GetSet("users.id"), 3000)
+	values, distinct := store.Size("users.id")
+	assert.Equal(t, 5000, values)
+	assert.Equal(t, 3000, distinct)
+
+	for _, value := range []string{"0", "1", "2999", "1500"} {
+		found, err := store.Contains("users.id", value)
+		require.NoError(t, err)
+		assert.True(t, found, value)
+	}
+	for _, value := range []string{"", "3000", "-1", "15000", "zzz"} {
+		found, err := store.Contains("users.id", value)
+		require.NoError(t, err)
+		assert.False(t, found, value)
+	}
+
+	// The files are removed with the storage.
+	require.NoError(t, store.Close())
+	_, err = os.Stat(store.dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDiskStorage_ReplaceAndDelete(t *testing.T) {
+	// GIVEN: A spilled key.
+	dir := t.TempDir()
+	store, err := NewDiskStorage(nil, dir, 64)
+	require.NoError(t, err)
+	defer store.Close()
+	store.Set("key", []string{"a", "b", "c", "d", "e"})
+	require.Contains(t, store.keys, "key")
+
+	// WHEN: It is replaced by a small set.
+	store.Set("key", []string{"x"})
+
+	// THEN: The spilled files are dropped.
+	assert.Empty(t, store.keys)
+	assert.Equal(t, []string{"x"}, store.Get("key"))
+	files, err := os.ReadDir(store.dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	// A deleted key is gone.
+	store.Delete("key")
+	assert.Nil(t, store.Get("key"))
+	found, err := store.Contains("key", "x")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Zero(t, store.used)
+}
+
+func TestDiskStorage_ValuesReadError(t *testing.T) {
+	// GIVEN: A spilled key whose values file is lost.
+	store, err := NewDiskStorage(nil, t.TempDir(), 64)
+	require.NoError(t, err)
+	defer store.Close()
+	store.Set("ids", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"})
+	require.Contains(t, store.keys, "ids")
+	require.NoError(t, os.Remove(store.keys["ids"].valuesPath))
+
+	// WHEN: The values are read.
+	values, err := store.Values("ids")
+
+	// THEN: The error is returned, the set file still answers Contains.
+	assert.ErrorContains(t, err, "cannot read values of ids")
+	assert.Nil(t, values)
+	found, err := store.Contains("ids", "7")
+	require.NoError(t, err)
+	assert.True(t, found)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+)
+
+// IntSet is a compact set of integers backed by a roaring bitmap.
+// A nil IntSet is an empty set.
+type IntSet struct {
+	bitmap *roaring64.Bitmap
+}
+
+func NewIntSet() *IntSet {
+	return &IntSet{bitmap: roaring64.New()}
+}
+
+// ParseIntSet builds the set of the decimal integer values.
+func ParseIntSet(values []string) (*IntSet, error) {
+	set := NewIntSet()
+	for _, value := range values {
+		if err := set.AddString(value); err != nil {
+			return nil, err
+		}
+	}
+	set.bitmap.RunOptimize()
+	return set, nil
+}
+
+func (s *IntSet) Add(value int64) {
+	// negative values are kept as their two's complement
+	s.bitmap.Add(uint64(value))
+}
+
+// AddString adds the decimal integer value.
+func (s *IntSet) AddString(value string) error {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("value %q is not an integer", value)
+	}
+	s.Add(parsed)
+	return nil
+}
+
+func (s *IntSet) Contains(value int64) bool {
+	if s == nil {
+		return false
+	}
+	return s.bitmap.Contains(uint64(value))
+}
+
+func (s *IntSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return int(s.bitmap.GetCardinality())
+}
+
+// SizeInBytes returns the size of the serialized bitmap.
+func (s *IntSet) SizeInBytes() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.bitmap.GetSizeInBytes()
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIntSet(t *testing.T) {
+	set, err := ParseIntSet([]string{"1", "42", "-7", "9223372036854775807", "42"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, set.Len())
+	assert.True(t, set.Contains(42))
+	assert.True(t, set.Contains(-7))
+	assert.True(t, set.Contains(9223372036854775807))
+	assert.False(t, set.Contains(7))
+
+	_, err = ParseIntSet([]string{"1", "abc"})
+	assert.ErrorContains(t, err, `value "abc" is not an integer`)
+
+	var empty *IntSet
+	assert.False(t, empty.Contains(1))
+	assert.Zero(t, empty.Len())
+}
+
+func TestMapStringStorage_GetIntSet(t *testing.T) {
+	store, _ := NewMapStringStorage(map[string][]string{
+		"ids":   {"1", "2"},
+		"names": {"alice"},
+	})
+
+	set, err := store.GetIntSet("ids")
+	require.NoError(t, err)
+	assert.Equal(t, 2, set.Len())
+	cached, _ := store.GetIntSet("ids")
+	assert.Same(t, set, cached, "int set is cached")
+
+	// A new value of the key rebuilds the set.
+	store.Set("ids", []string{"3"})
+	set, err = store.GetIntSet("ids")
+	require.NoError(t, err)
+	assert.True(t, set.Contains(3))
+	assert.False(t, set.Contains(1))
+
+	set, err = store.GetIntSet("missing")
+	require.NoError(t, err)
+	assert.Nil(t, set)
+
+	_, err = store.GetIntSet("names")
+	assert.ErrorContains(t, err, "key names")
+}
+
+func TestDiskStorage_GetIntSet(t *testing.T) {
+	// GIVEN: A key spilled to disk.
+	store, err := NewDiskStorage(nil, t.TempDir(), 1024)
+	require.NoError(t, err)
+	defer store.Close()
+
+	values := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		values = append(values, fmt.Sprintf("%d", i*3))
+	}
+	store.Set("ids", values)
+	require.Contains(t, store.keys, "ids")
+
+	// WHEN: Its int set is built.
+	set, err := store.GetIntSet("ids")
+
+	// THEN: It holds the values of the key.
+	require.NoError(t, err)
+	assert.Equal(t, 1000, set.Len())
+	assert.True(t, set.Contains(2997))
+	assert.False(t, set.Contains(2998))
+}
@@ -29,11 +29,47 @@ func (_m *RecordStore) GetColumnMapping() map[string][]byte {
 	return r0
 }
 
+// IsNull provides a mock function with given fields: col
+func (_m *RecordStore) IsNull(col string) bool {
+	ret := _m.Called(col)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IsNull")
+	}
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(col)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // Refresh provides a mock function with no fields
 func (_m *RecordStore) Refresh() {
 	_m.Called()
 }
 
+// SetNull provides a mock function with given fields: col
+func (_m *RecordStore) SetNull(col string) error {
+	ret := _m.Called(col)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetNull")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(col)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SetVal provides a mock function with given fields: col, val
 func (_m *RecordStore) SetVal(col string, val []byte) error {
 	ret := _m.Called(col, val)
@@ -8,15 +8,22 @@ import (
 
 type RecordStore interface {
 	GetColumnMapping() map[string][]byte
+	IsNull(col string) bool
 	SetVal(col string, val []byte) error
+	SetNull(col string) error
 	Refresh()
 }
 
-// Record represents one line (Row) of data.
+// Record represents one line (Row) of data in the COPY text format.
+// Vals hold the decoded column values, SQL NULL is kept as NULL_VALUE.
 type Record struct {
 	Row  []byte
 	Cols []string
 	Vals [][]byte
+
+	raw      [][]byte // column values as they are written in Row
+	nulls    []bool
+	modified []bool
 }
 
 func NewRecord(row []byte, cols []string) *Record {
@@ -34,11 +41,25 @@ func NewRecord(row []byte, cols []string) *Record {
 	return &rec
 }
 
-// parseVals splits the raw line into columns by the '\t' character.
+// parseVals splits the raw line into columns by the '\t' character
+// and decodes the escape sequences of every column.
 func (r *Record) parseVals() {
 	columns := bytes.Split(bytes.TrimSuffix(r.Row, []byte{'\n'}), []byte{'\t'})
-	if len(columns) > 0 {
-		r.Vals = columns
+	if len(columns) == 0 {
+		return
+	}
+
+	r.raw = columns
+	r.Vals = make([][]byte, len(columns))
+	r.nulls = make([]bool, len(columns))
+	r.modified = make([]bool, len(columns))
+	for i, column := range columns {
+		if string(column) == NULL_VALUE {
+			r.nulls[i] = true
+			r.Vals[i] = column
+			continue
+		}
+		r.Vals[i] = decodeCopyText(column)
 	}
 }
 
@@ -54,18 +75,49 @@ func (r *Record) GetColumnMapping() map[string][]byte {
 	return columnMapping
 }
 
+// IsNull reports whether the column holds SQL NULL rather than the literal \N string.
+func (r *Record) IsNull(col string) bool {
+	position := slices.Index(r.Cols, col)
+	return position != -1 && position < len(r.nulls) && r.nulls[position]
+}
+
 // Refresh reconstructs the raw line from the columns.
 // This is useful after any in-place modifications to the columns.
+// Unmodified columns are written back exactly as they were read.
 func (r *Record) Refresh() {
-	line := bytes.Join(r.Vals, []byte{'\t'})
+	columns := make([][]byte, len(r.Vals))
+	for i, val := range r.Vals {
+		switch {
+		case !r.modified[i]:
+			columns[i] = r.raw[i]
+		case r.nulls[i]:
+			columns[i] = []byte(NULL_VALUE)
+		default:
+			columns[i] = encodeCopyText(val)
+		}
+	}
+	line := bytes.Join(columns, []byte{'\t'})
 	r.Row = append(line, byte('\n'))
 }
 
+// SetVal sets the decoded value of the column, the value is always written as text,
+// so NULL_VALUE is written as the literal \N string. SQL NULL is set by SetNull.
 func (r *Record) SetVal(col string, val []byte) error {
+	return r.set(col, val, false)
+}
+
+// SetNull sets the column to SQL NULL.
+func (r *Record) SetNull(col string) error {
+	return r.set(col, []byte(NULL_VALUE), true)
+}
+
+func (r *Record) set(col string, val []byte, null bool) error {
 	position := slices.Index(r.Cols, col)
-	if position == -1 {
+	if position == -1 || position >= len(r.Vals) {
 		return fmt.Errorf("can not find column %s", col)
 	}
 	r.Vals[position] = val
+	r.nulls[position] = null
+	r.modified[position] = true
 	return nil
 }
@@ -138,3 +138,111 @@ func TestRecord_EdgeCaseSingleColumn(t *testing.T) {
 	rec.Refresh()
 	assert.Equal(t, []byte("modified\n"), rec.Row, "Should reflect the updated single column")
 }
+
+func TestNewRecord_DecodesEscapes(t *testing.T) {
+	row := []byte("1\tfirst\\tsecond\tline\\nbreak\tC:\\\\dir\t\\x41\\102\n")
+	cols := []string{"id", "tab", "newline", "backslash", "bytes"}
+
+	rec := NewRecord(row, cols)
+	mapping := rec.GetColumnMapping()
+
+	assert.Equal(t, []byte("first\tsecond"), mapping["tab"])
+	assert.Equal(t, []byte("line\nbreak"), mapping["newline"])
+	assert.Equal(t, []byte(`C:\dir`), mapping["backslash"])
+	assert.Equal(t, []byte("AB"), mapping["bytes"])
+}
+
+func TestNewRecord_NullAndLiteral(t *testing.T) {
+	row := []byte("\\N\t\\\\N\n")
+	cols := []string{"null", "literal"}
+
+	rec := NewRecord(row, cols)
+
+	assert.True(t, rec.IsNull("null"), "\\N should be SQL NULL")
+	assert.False(t, rec.IsNull("literal"), "escaped \\\\N should be the literal string")
+	assert.False(t, rec.IsNull("nonexistent"))
+	assert.Equal(t, []byte(NULL_VALUE), rec.GetColumnMapping()["null"])
+	assert.Equal(t, []byte(`\N`), rec.GetColumnMapping()["literal"])
+}
+
+func TestRefresh_KeepsUnmodifiedColumns(t *testing.T) {
+	// octal and hex escapes are not canonical and must be written back as is
+	row := []byte("\\101\t\\x42\t\\N\t\\\\N\n")
+	cols := []string{"a", "b", "c", "d"}
+
+	rec := NewRecord(row, cols)
+	rec.Refresh()
+
+	assert.Equal(t, row, rec.Row)
+}
+
+func TestRefresh_EncodesModifiedColumns(t *testing.T) {
+	row := []byte("1\told\t2\n")
+	cols := []string{"id", "text", "num"}
+
+	tests := []struct {
+		name     string
+		val      string
+		expected string
+	}{
+		{"tab", "a\tb", "1\ta\\tb\t2\n"},
+		{"newline", "a\nb", "1\ta\\nb\t2\n"},
+		{"carriage return", "a\r\nb", "1\ta\\r\\nb\t2\n"},
+		{"backslash", `a\b`, "1\ta\\\\b\t2\n"},
+		{"literal \\N", NULL_VALUE, "1\t\\\\N\t2\n"},
+		{"empty string", "", "1\t\t2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := NewRecord(row, cols)
+			assert.NoError(t, rec.SetVal("text", []byte(tt.val)))
+			rec.Refresh()
+
+			assert.Equal(t, []byte(tt.expected), rec.Row)
+			assert.False(t, rec.IsNull("text"), "SetVal never sets SQL NULL")
+
+			// the written row is read back to the same value
+			reread := NewRecord(rec.Row, cols)
+			assert.Equal(t, []byte(tt.val), reread.GetColumnMapping()["text"])
+			assert.Equal(t, []byte("2"), reread.GetColumnMapping()["num"])
+		})
+	}
+}
+
+func TestSetVal_NullToValue(t *testing.T) {
+	row := []byte("1\t\\N\n")
+	cols := []string{"id", "name"}
+
+	rec := NewRecord(row, cols)
+	assert.True(t, rec.IsNull("name"))
+
+	assert.NoError(t, rec.SetVal("name", []byte("bob")))
+	rec.Refresh()
+
+	assert.False(t, rec.IsNull("name"))
+	assert.Equal(t, []byte("1\tbob\n"), rec.Row)
+}
+
+func TestSetNull(t *testing.T) {
+	row := []byte("1\t\\\\N\tbob\n")
+	cols := []string{"id", "text", "name"}
+
+	// GIVEN: A literal \N string and a value.
+	rec := NewRecord(row, cols)
+	assert.False(t, rec.IsNull("text"))
+	assert.Equal(t, []byte(NULL_VALUE), rec.GetColumnMapping()["text"])
+
+	// WHEN: The name is set to SQL NULL and the literal is written back.
+	assert.NoError(t, rec.SetVal("text", rec.GetColumnMapping()["text"]))
+	assert.NoError(t, rec.SetNull("name"))
+	assert.Error(t, rec.SetNull("nonexistent"))
+	rec.Refresh()
+
+	// THEN: The literal \N survives the round trip and only the name is SQL NULL.
+	assert.Equal(t, []byte("1\t\\\\N\t\\N\n"), rec.Row)
+	reread := NewRecord(rec.Row, cols)
+	assert.False(t, reread.IsNull("text"))
+	assert.True(t, reread.IsNull("name"))
+	assert.Equal(t, []byte(NULL_VALUE), reread.GetColumnMapping()["text"])
+}
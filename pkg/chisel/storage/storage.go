@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"log"
 	"sync"
 )
@@ -12,16 +13,52 @@ type Storage interface {
 	Delete(key string)
 }
 
+// KeyWriter receives the values of a key one by one, so they do not have to be held
+// in memory at once. Close replaces the key with the written values.
+type KeyWriter interface {
+	Add(value string) error
+	Close() error
+}
+
+// StreamStorage is a storage accepting the values of a key through a KeyWriter.
+type StreamStorage interface {
+	Storage
+	NewKeyWriter(key string) KeyWriter
+}
+
+// SetStorage is a storage answering membership queries without building the set of a key.
+type SetStorage interface {
+	Storage
+	Contains(key, value string) (bool, error)
+	// Size returns the number of values and distinct values of the key.
+	Size(key string) (values, distinct int)
+	// Values returns the values of the key like Get, or the error of a key which can not be read.
+	Values(key string) ([]string, error)
+}
+
+// IntSetStorage is a storage building compact integer sets of its keys.
+type IntSetStorage interface {
+	Storage
+	// GetIntSet returns nil if the key does not exist,
+	// and an error if some value of the key is not an integer.
+	GetIntSet(key string) (*IntSet, error)
+}
+
 type MapStringStorage struct {
-	mu   sync.RWMutex // Mutex for thread-safe access.
-	data map[string][]string
-	sets map[string]map[string]struct{}
+	mu      sync.RWMutex // Mutex for thread-safe access.
+	data    map[string][]string
+	sets    map[string]map[string]struct{}
+	intSets map[string]*IntSet
 }
 
 func NewMapStringStorage(initial map[string][]string) (*MapStringStorage, error) {
+	if initial == nil {
+		initial = make(map[string][]string)
+	}
 	return &MapStringStorage{
-		data: initial,
-		sets: make(map[string]map[string]struct{}),
+		data:    initial,
+		sets:    make(map[string]map[string]struct{}),
+		intSets: make(map[string]*IntSet),
 	}, nil
 }
 
@@ -68,6 +105,34 @@ func (s *MapStringStorage) GetSet(key string) map[string]struct{} {
 	return mapVal
 }
 
+func (s *MapStringStorage) GetIntSet(key string) (*IntSet, error) {
+	s.mu.RLock()
+	if set, ok := s.intSets[key]; ok {
+		s.mu.RUnlock()
+		return set, nil
+	}
+	s.mu.RUnlock()
+
+	// have to build set, once
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if set, ok := s.intSets[key]; ok {
+		return set, nil
+	}
+	values, exists := s.data[key]
+	if !exists {
+		return nil, nil
+	}
+
+	log.Printf("[DEBUG] Make int set '%s'", key)
+	set, err := ParseIntSet(values)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", key, err)
+	}
+	s.intSets[key] = set
+	return set, nil
+}
+
 func (s *MapStringStorage) Set(key string, values []string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -75,10 +140,13 @@ func (s *MapStringStorage) Set(key string, values []string) {
 	s.data[key] = values
 
 	delete(s.sets, key)
+	delete(s.intSets, key)
 }
 
 func (s *MapStringStorage) Delete(key string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.data, key)
+	delete(s.sets, key)
+	delete(s.intSets, key)
 }
@@ -24,6 +24,14 @@ func TestNewMapStringStorage(t *testing.T) {
 	assert.Equal(t, []string{"one", "two"}, store.Get("numbers"))
 }
 
+func TestNewMapStringStorage_NilInitial(t *testing.T) {
+	store, err := NewMapStringStorage(nil)
+	assert.NoError(t, err, "constructing MapStringStorage should not fail")
+
+	store.Set("fruits", []string{"apple"})
+	assert.Equal(t, []string{"apple"}, store.Get("fruits"))
+}
+
 func TestMapStringStorage_Get_ExistingKey(t *testing.T) {
 	initial := map[string][]string{
 		"greetings": {"hello", "hi"},
@@ -1,13 +1,16 @@
 package strategies
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"strings"
 
 	"github.com/zwergpro/pg-chisel/pkg/chisel/actions"
 	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
 	"github.com/zwergpro/pg-chisel/pkg/dump"
 )
 
@@ -15,35 +18,38 @@ type Cmd interface {
 	Execute() error
 }
 
+// buildCommands builds the commands of the config tasks,
+// consecutive tasks on the same table are fused into a single command.
 func buildCommands(
 	conf *config.Config,
 	meta *dump.Dump,
 	storage storage.Storage,
-) ([]Cmd, error) {
+	options strategyOptions,
+) ([]plannedCmd, error) {
 	cmds := make([]Cmd, 0, len(conf.Tasks))
 
 	for idx, cmdCfg := range conf.Tasks {
 		switch cmdCfg.Cmd {
 		case commands.SELECT_CMD:
-			cmd, err := createSelectCmd(&cmdCfg, meta, storage)
+			cmd, err := createSelectCmd(&cmdCfg, meta, storage, options.workers)
 			if err != nil {
 				return nil, fmt.Errorf("can't create select cmd[%d]: %w", idx, err)
 			}
 			cmds = append(cmds, cmd)
 		case commands.DELETE_CMD:
-			cmd, err := createDeleteCmd(&cmdCfg, meta, storage)
+			cmd, err := createDeleteCmd(&cmdCfg, meta, storage, options.workers)
 			if err != nil {
 				return nil, fmt.Errorf("can't create delete cmd[%d]: %w", idx, err)
 			}
 			cmds = append(cmds, cmd)
 		case commands.UPDATE_CMD:
-			cmd, err := createUpdateCmd(&cmdCfg, meta, storage)
+			cmd, err := createUpdateCmd(&cmdCfg, meta, storage, options.workers)
 			if err != nil {
 				return nil, fmt.Errorf("can't create update cmd[%d]: %w", idx, err)
 			}
 			cmds = append(cmds, cmd)
 		case commands.SYNC_CMD:
-			cmd, err := createSyncCmd(conf, &cmdCfg)
+			cmd, err := createSyncCmd(conf, &cmdCfg, options.dryRun)
 			if err != nil {
 				return nil, fmt.Errorf("can't create sync cmd[%d]: %w", idx, err)
 			}
@@ -54,30 +60,48 @@ func buildCommands(
 				return nil, fmt.Errorf("can't create truncate cmd[%d]: %w", idx, err)
 			}
 			cmds = append(cmds, cmd)
+		case commands.DROP_CMD:
+			cmd, err := createDropCmd(&cmdCfg, meta)
+			if err != nil {
+				return nil, fmt.Errorf("can't create drop cmd[%d]: %w", idx, err)
+			}
+			cmds = append(cmds, cmd)
+		case commands.SUBSET_CMD:
+			cmd, err := createSubsetCmd(&cmdCfg, meta, storage)
+			if err != nil {
+				return nil, fmt.Errorf("can't create subset cmd[%d]: %w", idx, err)
+			}
+			cmds = append(cmds, cmd)
 		default:
 			return nil, fmt.Errorf("unknown command: %s", cmdCfg.Cmd)
 		}
 	}
 
-	return cmds, nil
+	planned, err := fuseTableTasks(conf.Tasks, cmds, meta, options.workers)
+	if err != nil || options.journal == nil {
+		return planned, err
+	}
+	return journalCommands(conf, planned, storage, options.journal)
 }
 
 func createSelectCmd(
 	task *config.Task,
 	meta *dump.Dump,
 	storage storage.Storage,
+	workers int,
 ) (Cmd, error) {
 	entity, err := meta.GetTable(task.Table)
 	if err != nil {
 		return nil, fmt.Errorf("can't find %s entity in meta", task.Table)
 	}
 
-	filter, err := actions.NewCELFilter(task.Where, storage)
+	row := actions.WithRowSchema(rowSchema(entity.Table))
+	filter, err := actions.NewCELFilter(task.Where, storage, row)
 	if err != nil {
 		return nil, err
 	}
 
-	fetcher, err := actions.NewCELFetcher(task.Fetch, storage)
+	fetcher, err := actions.NewCELFetcher(task.Fetch, storage, row)
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +116,7 @@ func createSelectCmd(
 		entity.DumpHandler,
 		filter,
 		fetcher,
+		commands.WithWorkers(workers),
 		commands.WithVerboseName(
 			fmt.Sprintf(
 				"SELECT %s FROM %s AS table WHERE %s",
@@ -108,13 +133,18 @@ func createDeleteCmd(
 	task *config.Task,
 	meta *dump.Dump,
 	storage storage.Storage,
+	workers int,
 ) (Cmd, error) {
 	entity, err := meta.GetTable(task.Table)
 	if err != nil {
 		return nil, fmt.Errorf("can't find %s entity in meta", task.Table)
 	}
 
-	filter, err := actions.NewCELFilter(task.Where, storage)
+	filter, err := actions.NewCELFilter(
+		task.Where,
+		storage,
+		actions.WithRowSchema(rowSchema(entity.Table)),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -123,6 +153,7 @@ func createDeleteCmd(
 		entity,
 		entity.DumpHandler,
 		filter,
+		commands.WithWorkers(workers),
 		commands.WithVerboseName(
 			fmt.Sprintf("DELETE FROM %s AS table WHERE %s", task.Table, task.Where),
 		),
@@ -134,18 +165,20 @@ func createUpdateCmd(
 	task *config.Task,
 	meta *dump.Dump,
 	storage storage.Storage,
+	workers int,
 ) (Cmd, error) {
 	entity, err := meta.GetTable(task.Table)
 	if err != nil {
 		return nil, fmt.Errorf("can't find %s entity in meta", task.Table)
 	}
 
-	filter, err := actions.NewCELFilter(task.Where, storage)
+	row := actions.WithRowSchema(rowSchema(entity.Table))
+	filter, err := actions.NewCELFilter(task.Where, storage, row)
 	if err != nil {
 		return nil, err
 	}
 
-	modifier, err := actions.NewCELModifier(task.Set)
+	modifier, err := actions.NewCELModifier(task.Set, row)
 	if err != nil {
 		return nil, err
 	}
@@ -160,6 +193,7 @@ func createUpdateCmd(
 		entity.DumpHandler,
 		filter,
 		modifier,
+		commands.WithWorkers(workers),
 		commands.WithVerboseName(
 			fmt.Sprintf(
 				"UPDATE %s AS table SET %s WHERE %s",
@@ -172,12 +206,22 @@ func createUpdateCmd(
 	return updateCmd, nil
 }
 
-func createSyncCmd(conf *config.Config, task *config.Task) (Cmd, error) {
+func createSyncCmd(conf *config.Config, task *config.Task, dryRun bool) (Cmd, error) {
 	syncType, err := commands.ParseSyncType(task.Type)
 	if err != nil {
 		return nil, err
 	}
 
+	if dryRun {
+		skipCmd := commands.NewSkipCmd(
+			"dry run",
+			commands.WithVerboseName(
+				fmt.Sprintf("SYNC FROM %s TO %s", conf.Source, conf.Destination),
+			),
+		)
+		return skipCmd, nil
+	}
+
 	syncCmd := commands.NewSyncDirCmd(
 		syncType,
 		conf.Source,
@@ -202,3 +246,92 @@ func createTruncateCmd(task *config.Task, meta *dump.Dump) (Cmd, error) {
 	)
 	return truncateCmd, nil
 }
+
+func createDropCmd(task *config.Task, meta *dump.Dump) (Cmd, error) {
+	if _, err := meta.GetTable(task.Table); err != nil {
+		return nil, fmt.Errorf("can't find %s entity in meta", task.Table)
+	}
+
+	dropCmd := commands.NewDropCmd(
+		meta,
+		task.Table,
+		commands.WithVerboseName(fmt.Sprintf("DROP TABLE %s", task.Table)),
+	)
+	return dropCmd, nil
+}
+
+func createSubsetCmd(
+	task *config.Task,
+	meta *dump.Dump,
+	storage storage.Storage,
+) (Cmd, error) {
+	follow, err := commands.ParseSubsetFollow(task.Follow)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make([]commands.SubsetRoot, 0, len(task.Roots))
+	names := make([]string, 0, len(task.Roots))
+	for _, root := range task.Roots {
+		entity, err := meta.GetTable(root.Table)
+		if err != nil {
+			return nil, fmt.Errorf("can't find %s entity in meta", root.Table)
+		}
+
+		filter, err := actions.NewCELFilter(
+			root.Where,
+			storage,
+			actions.WithRowSchema(rowSchema(entity.Table)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, commands.SubsetRoot{Entity: entity, Filter: filter})
+		names = append(names, fmt.Sprintf("%s WHERE %s", root.Table, root.Where))
+	}
+
+	var relations []commands.SubsetRelation
+	for _, fk := range meta.GetForeignKeys() {
+		child, parent, err := meta.GetForeignKeyTables(fk)
+		if errors.Is(err, dump.ErrSchemaMismatch) {
+			log.Printf("[WARN] Skip foreign key %s: %v", fk.Name, err)
+			continue
+		}
+		if err != nil {
+			log.Printf("[DEBUG] Skip foreign key %s: %v", fk.Name, err)
+			continue
+		}
+		relations = append(relations, commands.SubsetRelation{
+			Name:       fk.Name,
+			Child:      child,
+			Columns:    fk.Columns,
+			Parent:     parent,
+			RefColumns: fk.RefColumns,
+		})
+	}
+
+	subsetCmd := commands.NewSubsetCmd(
+		roots,
+		relations,
+		follow,
+		storage,
+		commands.WithVerboseName(
+			fmt.Sprintf("SUBSET %s FOLLOW %s", strings.Join(names, ", "), follow),
+		),
+	)
+	return subsetCmd, nil
+}
+
+// rowSchema exposes the table columns to CEL expressions typed by the table definition.
+func rowSchema(table *dump.TableMeta) *cel_extensions.RowSchema {
+	columns := make([]cel_extensions.RowColumn, 0, len(table.SortedColumns))
+	for _, name := range table.SortedColumns {
+		column := table.Columns[name]
+		columns = append(columns, cel_extensions.RowColumn{
+			Name:    name,
+			Type:    column.Type,
+			NotNull: column.NotNull,
+		})
+	}
+	return cel_extensions.NewRowSchema(columns)
+}
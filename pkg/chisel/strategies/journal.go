@@ -0,0 +1,478 @@
+package strategies
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+// JOURNAL_FILE is the name of the checkpoint journal in the destination directory.
+const JOURNAL_FILE = ".chisel_journal.jsonl"
+
+// Journal records the tasks completed by a run, so a failed run can be resumed.
+// Every completed task is appended as a line with the hash of its config, the files
+// it produced in the destination and the values of the storage keys it wrote.
+type Journal struct {
+	mu      sync.Mutex
+	dir     string // destination directory
+	entries map[int]*journalEntry
+}
+
+type journalEntry struct {
+	Task int `json:"task"`
+	// Hash of the task config chained with the hashes of the previous tasks,
+	// so a changed task invalidates the following ones.
+	Hash    string               `json:"hash"`
+	Files   map[string]fileStamp `json:"files,omitempty"`
+	Storage map[string][]string  `json:"storage,omitempty"`
+}
+
+// fileStamp identifies the content of a file written to the destination.
+type fileStamp struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+}
+
+// OpenJournal starts the journal in the destination directory.
+// The journal of the previous run is kept if resume is set, otherwise it is removed.
+func OpenJournal(dir string, resume bool) (*Journal, error) {
+	j := &Journal{dir: dir, entries: make(map[int]*journalEntry)}
+	if !resume {
+		if err := j.Remove(); err != nil {
+			return nil, err
+		}
+		return j, nil
+	}
+
+	file, err := os.Open(j.path())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("[WARN] No journal found in %s, nothing to resume", dir)
+			return j, nil
+		}
+		return nil, fmt.Errorf("cannot open journal: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for scanner.Scan() {
+		entry := journalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// the last line is incomplete if the run was killed while writing it
+			log.Printf("[WARN] Journal line is skipped: %v", err)
+			continue
+		}
+		j.entries[entry.Task] = &entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read journal: %w", err)
+	}
+	return j, nil
+}
+
+// Completed returns the number of completed tasks.
+func (j *Journal) Completed() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.entries)
+}
+
+// Remove deletes the journal file and forgets the completed tasks, e.g. once the run succeeded.
+func (j *Journal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := os.Remove(j.path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot remove journal: %w", err)
+	}
+	clear(j.entries)
+	return nil
+}
+
+// MoveTo points the journal to the directory its file was moved to,
+// e.g. the destination the staging directory was committed to.
+func (j *Journal) MoveTo(dir string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.dir = dir
+}
+
+func (j *Journal) path() string {
+	return filepath.Join(j.dir, JOURNAL_FILE)
+}
+
+// resume returns the index of the first task to execute. Tasks before it are completed
+// with the same config, the other files of the destination are removed
+// and the journal is rewritten with the completed tasks only.
+func (j *Journal) resume(hashes []string) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	first := 0
+	for first < len(hashes) {
+		entry, ok := j.entries[first]
+		if !ok || entry.Hash != hashes[first] {
+			break
+		}
+		first++
+	}
+
+	current, err := j.listFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	// A file written by a task to execute or changed since the run has to be rebuilt
+	// by every task producing it, so the first of them is executed again.
+	producers := make(map[string]int)
+	stamps := make(map[string]fileStamp)
+	for task := len(hashes) - 1; task >= 0; task-- {
+		if entry, ok := j.entries[task]; ok {
+			for name, stamp := range entry.Files {
+				producers[name] = task
+				if _, ok := stamps[name]; !ok {
+					stamps[name] = stamp
+				}
+			}
+		}
+	}
+	for name, stamp := range stamps {
+		if current[name] != stamp {
+			first = min(first, producers[name])
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for task, entry := range j.entries {
+			if task < first {
+				continue
+			}
+			for name := range entry.Files {
+				if producers[name] < first {
+					first = producers[name]
+					changed = true
+				}
+			}
+		}
+	}
+
+	// Only the files of the completed tasks are kept, the others are partially
+	// written by the failed run or have to be rebuilt.
+	kept := make(map[string]struct{})
+	for task, entry := range j.entries {
+		if task >= first {
+			delete(j.entries, task)
+			continue
+		}
+		for name := range entry.Files {
+			kept[name] = struct{}{}
+		}
+	}
+	for name := range current {
+		if _, ok := kept[name]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(j.dir, name)); err != nil {
+			return 0, fmt.Errorf("cannot remove file of uncompleted task: %w", err)
+		}
+		log.Printf("[DEBUG] Removed file of uncompleted task: %s", name)
+	}
+
+	if err := j.rewrite(); err != nil {
+		return 0, err
+	}
+	return first, nil
+}
+
+// restore sets the storage keys written by the completed tasks in the task order.
+func (j *Journal) restore(store storage.Storage) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	tasks := make([]int, 0, len(j.entries))
+	for task := range j.entries {
+		tasks = append(tasks, task)
+	}
+	slices.Sort(tasks)
+	for _, task := range tasks {
+		for key, values := range j.entries[task].Storage {
+			store.Set(key, values)
+		}
+	}
+}
+
+// complete appends the completed tasks of a command to the journal.
+func (j *Journal) complete(entries []*journalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	file, err := os.OpenFile(j.path(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot open journal: %w", err)
+	}
+	if err = writeJournalEntries(file, entries); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("cannot close journal: %w", err)
+	}
+
+	for _, entry := range entries {
+		j.entries[entry.Task] = entry
+	}
+	return nil
+}
+
+// rewrite replaces the journal file with the current entries.
+func (j *Journal) rewrite() error {
+	entries := make([]*journalEntry, 0, len(j.entries))
+	for _, entry := range j.entries {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b *journalEntry) int { return a.Task - b.Task })
+
+	tmpPath := j.path() + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("cannot create journal: %w", err)
+	}
+	if err = writeJournalEntries(file, entries); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("cannot close journal: %w", err)
+	}
+	if err = os.Rename(tmpPath, j.path()); err != nil {
+		return fmt.Errorf("cannot replace journal: %w", err)
+	}
+	return nil
+}
+
+func writeJournalEntries(file *os.File, entries []*journalEntry) error {
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("cannot write journal: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("cannot write journal: %w", err)
+	}
+	return file.Sync()
+}
+
+// listFiles returns the stamps of the files in the destination, except the journal.
+func (j *Journal) listFiles() (map[string]fileStamp, error) {
+	files, err := os.ReadDir(j.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]fileStamp{}, nil
+		}
+		return nil, fmt.Errorf("cannot list destination: %w", err)
+	}
+
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		if !file.Type().IsRegular() || strings.HasPrefix(file.Name(), JOURNAL_FILE) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue // replaced by a concurrent task
+			}
+			return nil, fmt.Errorf("cannot stat %s: %w", file.Name(), err)
+		}
+		stamps[file.Name()] = fileStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	}
+	return stamps, nil
+}
+
+// taskHashes returns the chained hashes of the task configs. The first hash
+// depends on the source and the initial storage as well.
+func taskHashes(conf *config.Config) ([]string, error) {
+	seed, err := json.Marshal(struct {
+		Source      string
+		Format      string
+		Compression string
+		Output      config.Output
+		Storage     config.StorageSection
+	}{conf.Source, conf.Format, conf.Compression, conf.Output, conf.Storage})
+	if err != nil {
+		return nil, err
+	}
+	prev := sha256.Sum256(seed)
+
+	hashes := make([]string, 0, len(conf.Tasks))
+	for _, task := range conf.Tasks {
+		data, err := json.Marshal(task)
+		if err != nil {
+			return nil, err
+		}
+		prev = sha256.Sum256(append(prev[:], data...))
+		hashes = append(hashes, hex.EncodeToString(prev[:]))
+	}
+	return hashes, nil
+}
+
+// journaledCmd records the tasks of a command in the journal once it is executed.
+type journaledCmd struct {
+	Cmd
+
+	journal *Journal
+	tasks   []int
+	// storageKeys returns the storage keys written by the task
+	storageKeys func(task int) []string
+	hashes      []string
+	storage     storage.Storage
+}
+
+func (c *journaledCmd) Execute() error {
+	before, err := c.journal.listFiles()
+	if err != nil {
+		return err
+	}
+	if err = c.Cmd.Execute(); err != nil {
+		return err
+	}
+	after, err := c.journal.listFiles()
+	if err != nil {
+		return err
+	}
+
+	// Files changed by concurrent commands are recorded as well,
+	// a resumed run rebuilds more files then, but never less.
+	files := make(map[string]fileStamp)
+	for name, stamp := range after {
+		if before[name] != stamp {
+			files[name] = stamp
+		}
+	}
+
+	entries := make([]*journalEntry, 0, len(c.tasks))
+	for _, task := range c.tasks {
+		if c.approximate(task) {
+			// the values of a bloom key are not kept, so the task is executed again
+			log.Printf("[DEBUG] Task[%d] writes a bloom key, it is not journaled", task)
+			continue
+		}
+		entry := &journalEntry{Task: task, Hash: c.hashes[task], Files: files}
+		for _, key := range c.storageKeys(task) {
+			if entry.Storage == nil {
+				entry.Storage = make(map[string][]string)
+			}
+			values, err := storageValues(c.storage, key)
+			if err != nil {
+				return fmt.Errorf("cannot journal task[%d]: %w", task, err)
+			}
+			entry.Storage[key] = values
+		}
+		entries = append(entries, entry)
+	}
+	return c.journal.complete(entries)
+}
+
+// storageValues returns the values of the key, with the read error of a SetStorage.
+func storageValues(store storage.Storage, key string) ([]string, error) {
+	if sets, ok := store.(storage.SetStorage); ok {
+		return sets.Values(key)
+	}
+	return store.Get(key), nil
+}
+
+// approximate reports whether the task writes a storage key kept as a bloom filter.
+func (c *journaledCmd) approximate(task int) bool {
+	bloom, ok := c.storage.(interface{ IsApproximate(key string) bool })
+	if !ok {
+		return false
+	}
+	for _, key := range c.storageKeys(task) {
+		if bloom.IsApproximate(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// journalCommands skips the commands completed by the previous run
+// and makes the others record their tasks in the journal.
+func journalCommands(
+	conf *config.Config,
+	planned []plannedCmd,
+	store storage.Storage,
+	journal *Journal,
+) ([]plannedCmd, error) {
+	hashes, err := taskHashes(conf)
+	if err != nil {
+		return nil, fmt.Errorf("can't hash tasks: %w", err)
+	}
+	first, err := journal.resume(hashes)
+	if err != nil {
+		return nil, err
+	}
+	if first > 0 {
+		log.Printf("[INFO] Resume from task[%d], %d tasks are completed", first, first)
+		journal.restore(store)
+	}
+
+	storageKeys := func(task int) []string {
+		var keys []string
+		for key := range conf.Tasks[task].Fetch {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	resumed := make([]plannedCmd, 0, len(planned))
+	for _, p := range planned {
+		// fused commands are executed again as a whole
+		if p.tasks[len(p.tasks)-1] >= first || conf.Tasks[p.tasks[0]].Cmd == commands.DROP_CMD {
+			p.cmd = &journaledCmd{
+				Cmd:     p.cmd,
+				journal: journal,
+				tasks:   p.tasks,
+				storageKeys: func(task int) []string {
+					keys := storageKeys(task)
+					cmd := p.taskCmds[slices.Index(p.tasks, task)]
+					if reporter, ok := cmd.(commands.StatsReporter); ok {
+						keys = append(keys, reporter.Stats().StorageKeys...)
+					}
+					return keys
+				},
+				hashes:  hashes,
+				storage: store,
+			}
+			resumed = append(resumed, p)
+			continue
+		}
+
+		skipCmd := commands.NewSkipCmd(
+			"completed by the previous run",
+			commands.WithVerboseName(fmt.Sprintf("tasks%v", p.tasks)),
+		)
+		p.cmd = skipCmd
+		p.taskCmds = make([]Cmd, len(p.tasks))
+		for idx := range p.taskCmds {
+			p.taskCmds[idx] = skipCmd
+		}
+		resumed = append(resumed, p)
+	}
+	return resumed, nil
+}
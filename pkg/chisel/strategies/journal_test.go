@@ -0,0 +1,245 @@
+package strategies
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+func TestTaskHashes(t *testing.T) {
+	conf := &config.Config{Source: "src", Tasks: []config.Task{
+		{Cmd: commands.DELETE_CMD, Table: "users", Where: "false"},
+		{Cmd: commands.DELETE_CMD, Table: "orders", Where: "false"},
+		{Cmd: commands.DELETE_CMD, Table: "logs", Where: "false"},
+	}}
+	hashes, err := taskHashes(conf)
+	require.NoError(t, err)
+
+	// A changed task invalidates itself and the following tasks.
+	conf.Tasks[1].Where = "true"
+	changed, err := taskHashes(conf)
+	require.NoError(t, err)
+	assert.Equal(t, hashes[0], changed[0])
+	assert.NotEqual(t, hashes[1], changed[1])
+	assert.NotEqual(t, hashes[2], changed[2])
+
+	// So does a changed source.
+	conf.Source = "other"
+	changed, err = taskHashes(conf)
+	require.NoError(t, err)
+	assert.NotEqual(t, hashes[0], changed[0])
+}
+
+// writeTestFile writes a destination file with a distinct modification time.
+func writeTestFile(t *testing.T, dir, name, content string) {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	mtime := time.Now().Add(time.Duration(len(content)) * time.Second)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+}
+
+// runJournaled executes the tasks writing the given files as journaled commands.
+func runJournaled(
+	t *testing.T,
+	journal *Journal,
+	store storage.Storage,
+	hashes []string,
+	files map[int]map[string]string,
+	keys map[int][]string,
+) {
+	for task := range hashes {
+		cmd := &journaledCmd{
+			Cmd: funcCmd(func() error {
+				for name, content := range files[task] {
+					writeTestFile(t, journal.dir, name, content)
+				}
+				for _, key := range keys[task] {
+					store.Set(key, []string{key})
+				}
+				return nil
+			}),
+			journal:     journal,
+			tasks:       []int{task},
+			storageKeys: func(task int) []string { return keys[task] },
+			hashes:      hashes,
+			storage:     store,
+		}
+		require.NoError(t, cmd.Execute())
+	}
+}
+
+func TestJournal_Resume(t *testing.T) {
+	// GIVEN: A run which completed two tasks out of three, and left a partial file.
+	dir := t.TempDir()
+	store, _ := storage.NewMapStringStorage(nil)
+	journal, err := OpenJournal(dir, false)
+	require.NoError(t, err)
+	hashes := []string{"h0", "h1", "h2"}
+	runJournaled(t, journal, store, hashes[:2],
+		map[int]map[string]string{0: {"1.dat": "a"}, 1: {"2.dat": "bb"}},
+		map[int][]string{1: {"users.id"}},
+	)
+	writeTestFile(t, dir, "3.dat", "partial")
+
+	// WHEN: The run is resumed.
+	resumed, err := OpenJournal(dir, true)
+	require.NoError(t, err)
+	first, err := resumed.resume(hashes)
+	require.NoError(t, err)
+	restored, _ := storage.NewMapStringStorage(nil)
+	resumed.restore(restored)
+
+	// THEN: It starts with the third task, with the files and the storage of the completed ones.
+	assert.Equal(t, 2, first)
+	assert.Equal(t, 2, resumed.Completed())
+	assert.FileExists(t, filepath.Join(dir, "1.dat"))
+	assert.FileExists(t, filepath.Join(dir, "2.dat"))
+	assert.NoFileExists(t, filepath.Join(dir, "3.dat"))
+	assert.Equal(t, []string{"users.id"}, restored.Get("users.id"))
+}
+
+func TestJournal_ResumeInvalidated(t *testing.T) {
+	tests := []struct {
+		name   string
+		hashes []string
+		change func(t *testing.T, dir string)
+		first  int
+	}{
+		{
+			name:   "changed task",
+			hashes: []string{"h0", "changed", "changed", "changed"},
+			first:  1,
+		},
+		{
+			name:   "changed task sharing a file with a previous one",
+			hashes: []string{"h0", "h1", "h2", "changed"},
+			// the orders file of task 3 is produced by task 2 as well
+			first: 2,
+		},
+		{
+			name:   "changed file",
+			hashes: []string{"h0", "h1", "h2", "h3"},
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, dir, "logs.dat", "changed")
+			},
+			first: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN: A completed run of four tasks.
+			dir := t.TempDir()
+			store, _ := storage.NewMapStringStorage(nil)
+			journal, err := OpenJournal(dir, false)
+			require.NoError(t, err)
+			runJournaled(t, journal, store, []string{"h0", "h1", "h2", "h3"},
+				map[int]map[string]string{
+					0: {"logs.dat": "l"},
+					1: {"users.dat": "u"},
+					2: {"orders.dat": "o"},
+					3: {"orders.dat": "oo"},
+				},
+				nil,
+			)
+			if tt.change != nil {
+				tt.change(t, dir)
+			}
+
+			// WHEN: The run is resumed.
+			resumed, err := OpenJournal(dir, true)
+			require.NoError(t, err)
+			first, err := resumed.resume(tt.hashes)
+
+			// THEN: The invalidated tasks and the files they produced are dropped.
+			require.NoError(t, err)
+			assert.Equal(t, tt.first, first)
+			assert.Equal(t, tt.first, resumed.Completed())
+			files, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, file := range files {
+				names = append(names, file.Name())
+			}
+			expected := []string{"logs.dat", "users.dat", "orders.dat"}[:tt.first]
+			assert.ElementsMatch(t, append(expected, JOURNAL_FILE), names)
+		})
+	}
+}
+
+func TestJournal_BloomKey(t *testing.T) {
+	// GIVEN: A run whose first task fetches a bloom key.
+	dir := t.TempDir()
+	inner, _ := storage.NewMapStringStorage(nil)
+	store := storage.NewBloomStorage(inner, map[string]storage.BloomKey{"stale": {FPRate: 0.01, Expected: 100}})
+	journal, err := OpenJournal(dir, false)
+	require.NoError(t, err)
+	hashes := []string{"h0", "h1"}
+	runJournaled(t, journal, store, hashes,
+		map[int]map[string]string{0: {"1.dat": "a"}, 1: {"2.dat": "bb"}},
+		map[int][]string{0: {"stale"}},
+	)
+
+	// WHEN: The run is resumed.
+	resumed, err := OpenJournal(dir, true)
+	require.NoError(t, err)
+	first, err := resumed.resume(hashes)
+
+	// THEN: The task is executed again, as the values of the bloom key are not kept.
+	require.NoError(t, err)
+	assert.Equal(t, 1, journal.Completed())
+	assert.Equal(t, 0, first)
+}
+
+func TestJournalCommands(t *testing.T) {
+	// GIVEN: A journal with the first two tasks completed.
+	dir := t.TempDir()
+	conf := &config.Config{Tasks: []config.Task{
+		{Cmd: commands.SELECT_CMD, Table: "users", Fetch: map[string]string{"users.id": "table.id"}},
+		{Cmd: commands.DROP_CMD, Table: "logs"},
+		{Cmd: commands.DELETE_CMD, Table: "orders"},
+	}}
+	hashes, err := taskHashes(conf)
+	require.NoError(t, err)
+
+	journal, err := OpenJournal(dir, false)
+	require.NoError(t, err)
+	require.NoError(t, journal.complete([]*journalEntry{
+		{Task: 0, Hash: hashes[0], Storage: map[string][]string{"users.id": {"1", "2"}}},
+		{Task: 1, Hash: hashes[1]},
+	}))
+
+	var executed []int
+	planned := make([]plannedCmd, 0, len(conf.Tasks))
+	for idx := range conf.Tasks {
+		cmd := funcCmd(func() error {
+			executed = append(executed, idx)
+			return nil
+		})
+		planned = append(planned, plannedCmd{cmd: cmd, tasks: []int{idx}, taskCmds: []Cmd{cmd}})
+	}
+
+	// WHEN: The commands are resumed.
+	resumed, err := OpenJournal(dir, true)
+	require.NoError(t, err)
+	restored, _ := storage.NewMapStringStorage(nil)
+	planned, err = journalCommands(conf, planned, restored, resumed)
+	require.NoError(t, err)
+	for _, p := range planned {
+		require.NoError(t, p.cmd.Execute())
+	}
+
+	// THEN: The completed select is skipped, its keys are restored, the drop is replayed
+	// as it only changes the dump in memory.
+	assert.Equal(t, []int{1, 2}, executed)
+	assert.IsType(t, &commands.SkipCmd{}, planned[0].taskCmds[0])
+	assert.Equal(t, []string{"1", "2"}, restored.Get("users.id"))
+	assert.Equal(t, 3, resumed.Completed())
+}
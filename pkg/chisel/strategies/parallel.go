@@ -0,0 +1,229 @@
+package strategies
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+)
+
+// ParallelStrategy runs independent commands concurrently, similar to pg_restore -j.
+// A command waits for the previous commands using the same tables or storage keys.
+type ParallelStrategy struct {
+	*taskReport
+
+	nodes []*dagNode
+	jobs  int
+}
+
+// dagNode is a command with its dependencies.
+type dagNode struct {
+	cmd        Cmd
+	deps       int   // number of commands to wait for
+	dependents []int // commands waiting for this one
+}
+
+type cmdResult struct {
+	idx int
+	err error
+}
+
+func (s *ParallelStrategy) Execute() error {
+	pending := make([]int, len(s.nodes))
+	var ready []int
+	for idx, node := range s.nodes {
+		pending[idx] = node.deps
+		if node.deps == 0 {
+			ready = append(ready, idx)
+		}
+	}
+
+	results := make(chan cmdResult)
+	running := 0
+	var execErr error
+
+	for {
+		// Commands are started in the config order once their dependencies are done
+		for execErr == nil && running < s.jobs && len(ready) > 0 {
+			idx := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- cmdResult{idx: idx, err: s.nodes[idx].cmd.Execute()}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		if res.err != nil {
+			if execErr == nil {
+				execErr = fmt.Errorf("command execution error: %w", res.err)
+			}
+			continue
+		}
+		for _, dependent := range s.nodes[res.idx].dependents {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		slices.Sort(ready)
+	}
+	return execErr
+}
+
+func BuildParallelStrategy(
+	conf *config.Config,
+	meta *dump.Dump,
+	storage storage.Storage,
+	jobs int,
+	opts ...StrategyOption,
+) (*ParallelStrategy, error) {
+	if jobs < 1 {
+		return nil, fmt.Errorf("jobs must be positive, got %d", jobs)
+	}
+
+	planned, err := buildCommands(conf, meta, storage, newStrategyOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	footprints := make([]*taskFootprint, 0, len(conf.Tasks))
+	for idx := range conf.Tasks {
+		footprint, err := newTaskFootprint(&conf.Tasks[idx], meta)
+		if err != nil {
+			return nil, fmt.Errorf("can't analyze task[%d]: %w", idx, err)
+		}
+		footprints = append(footprints, footprint)
+	}
+
+	log.Printf("[DEBUG] Tasks created: %d, jobs: %d", len(planned), jobs)
+
+	return &ParallelStrategy{
+		taskReport: newTaskReport(conf.Tasks, planned, storage),
+		nodes:      buildDAG(planned, footprints),
+		jobs:       jobs,
+	}, nil
+}
+
+// buildDAG links every command to the previous commands it depends on.
+// footprints are indexed by the task.
+func buildDAG(planned []plannedCmd, footprints []*taskFootprint) []*dagNode {
+	nodes := make([]*dagNode, 0, len(planned))
+	merged := make([]*taskFootprint, 0, len(planned))
+	for idx, p := range planned {
+		footprint := newEmptyFootprint()
+		for _, task := range p.tasks {
+			footprint.merge(footprints[task])
+		}
+
+		node := &dagNode{cmd: p.cmd}
+		for prev := range idx {
+			if footprint.dependsOn(merged[prev]) {
+				node.deps++
+				nodes[prev].dependents = append(nodes[prev].dependents, idx)
+			}
+		}
+		log.Printf("[DEBUG] Task %d depends on %d previous tasks", idx, node.deps)
+
+		nodes = append(nodes, node)
+		merged = append(merged, footprint)
+	}
+	return nodes
+}
+
+// taskFootprint describes the tables and storage keys used by a task.
+type taskFootprint struct {
+	barrier bool // the task changes the whole dump and runs alone
+	tables  map[int]struct{}
+	reads   map[string]struct{}
+	anyRead bool // some storage key is computed by the expression
+	writes  map[string]struct{}
+}
+
+func newEmptyFootprint() *taskFootprint {
+	return &taskFootprint{
+		tables: make(map[int]struct{}),
+		reads:  make(map[string]struct{}),
+		writes: make(map[string]struct{}),
+	}
+}
+
+func newTaskFootprint(task *config.Task, meta *dump.Dump) (*taskFootprint, error) {
+	footprint := newEmptyFootprint()
+
+	switch task.Cmd {
+	case commands.SELECT_CMD, commands.UPDATE_CMD, commands.DELETE_CMD, commands.TRUNCATE_CMD:
+		entity, err := meta.GetTable(task.Table)
+		if err != nil {
+			return nil, fmt.Errorf("can't find %s entity in meta", task.Table)
+		}
+		footprint.tables[entity.Id] = struct{}{}
+
+		if task.Where != "" {
+			keys, dynamic, err := cel_extensions.StorageKeys(task.Where)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				footprint.reads[key] = struct{}{}
+			}
+			footprint.anyRead = dynamic
+		}
+		for key := range task.Fetch {
+			footprint.writes[key] = struct{}{}
+		}
+	default:
+		// sync, drop and subset change the files, the tables or the storage keys of the whole dump
+		footprint.barrier = true
+	}
+	return footprint, nil
+}
+
+func (f *taskFootprint) merge(other *taskFootprint) {
+	f.barrier = f.barrier || other.barrier
+	f.anyRead = f.anyRead || other.anyRead
+	for id := range other.tables {
+		f.tables[id] = struct{}{}
+	}
+	for key := range other.reads {
+		f.reads[key] = struct{}{}
+	}
+	for key := range other.writes {
+		f.writes[key] = struct{}{}
+	}
+}
+
+// dependsOn reports whether the task has to wait for the previous one:
+// they use the same table, or one of them writes a storage key the other one uses.
+func (f *taskFootprint) dependsOn(prev *taskFootprint) bool {
+	if f.barrier || prev.barrier {
+		return true
+	}
+	if intersects(f.tables, prev.tables) {
+		return true
+	}
+	if f.anyRead && len(prev.writes) > 0 || prev.anyRead && len(f.writes) > 0 {
+		return true
+	}
+	return intersects(f.reads, prev.writes) ||
+		intersects(f.writes, prev.reads) ||
+		intersects(f.writes, prev.writes)
+}
+
+func intersects[K comparable](a, b map[K]struct{}) bool {
+	for key := range a {
+		if _, ok := b[key]; ok {
+			return true
+		}
+	}
+	return false
+}
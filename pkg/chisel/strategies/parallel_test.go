@@ -0,0 +1,129 @@
+package strategies
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+)
+
+type funcCmd func() error
+
+func (f funcCmd) Execute() error {
+	return f()
+}
+
+func TestBuildDAG(t *testing.T) {
+	meta := &dump.Dump{Entities: map[string]*dump.Entity{
+		"public.users":    {Id: 1, Table: &dump.TableMeta{Name: "users"}},
+		"public.orders":   {Id: 2, Table: &dump.TableMeta{Name: "orders"}},
+		"public.products": {Id: 3, Table: &dump.TableMeta{Name: "products"}},
+	}}
+	tasks := []config.Task{
+		{
+			Cmd: commands.SELECT_CMD, Table: "public.users", Where: "true",
+			Fetch: map[string]string{"users.id": "table.id"},
+		},
+		{Cmd: commands.DELETE_CMD, Table: "public.products", Where: "true"},
+		{Cmd: commands.DELETE_CMD, Table: "public.orders", Where: `table.user_id in set("users.id")`},
+		{Cmd: commands.UPDATE_CMD, Table: "public.products", Where: "true"},
+		{Cmd: commands.TRUNCATE_CMD, Table: "public.users"},
+		{Cmd: commands.DROP_CMD, Table: "public.users"},
+		{Cmd: commands.TRUNCATE_CMD, Table: "public.orders"},
+	}
+
+	planned := make([]plannedCmd, 0, len(tasks))
+	footprints := make([]*taskFootprint, 0, len(tasks))
+	for idx := range tasks {
+		footprint, err := newTaskFootprint(&tasks[idx], meta)
+		require.NoError(t, err)
+		footprints = append(footprints, footprint)
+		planned = append(planned, plannedCmd{tasks: []int{idx}})
+	}
+
+	nodes := buildDAG(planned, footprints)
+
+	deps := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		deps = append(deps, node.deps)
+	}
+	// orders wait for the fetched users.id, products and users are ordered by the table,
+	// drop waits for everything and everything after drop waits for it.
+	assert.Equal(t, []int{0, 0, 1, 1, 1, 5, 2}, deps)
+	assert.Equal(t, []int{2, 4, 5}, nodes[0].dependents)
+	assert.Equal(t, []int{6}, nodes[5].dependents)
+}
+
+func TestParallelStrategy_Execute(t *testing.T) {
+	// GIVEN: two independent commands and a command depending on both.
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+
+	started := make(chan struct{})
+	first := funcCmd(func() error {
+		record("first")
+		// the second command must run at the same time
+		select {
+		case <-started:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("commands are not run concurrently")
+		}
+	})
+	second := funcCmd(func() error {
+		close(started)
+		record("second")
+		return nil
+	})
+	last := funcCmd(func() error {
+		record("last")
+		return nil
+	})
+
+	strategy := &ParallelStrategy{
+		nodes: []*dagNode{
+			{cmd: first, dependents: []int{2}},
+			{cmd: second, dependents: []int{2}},
+			{cmd: last, deps: 2},
+		},
+		jobs: 2,
+	}
+
+	// WHEN: We execute the strategy.
+	err := strategy.Execute()
+
+	// THEN: The dependent command runs last.
+	require.NoError(t, err)
+	assert.Len(t, order, 3)
+	assert.Equal(t, "last", order[2])
+}
+
+func TestParallelStrategy_ExecuteError(t *testing.T) {
+	// GIVEN: a failing command with a dependent one.
+	executed := false
+	strategy := &ParallelStrategy{
+		nodes: []*dagNode{
+			{cmd: funcCmd(func() error { return errors.New("boom") }), dependents: []int{1}},
+			{cmd: funcCmd(func() error { executed = true; return nil }), deps: 1},
+		},
+		jobs: 4,
+	}
+
+	// WHEN: We execute the strategy.
+	err := strategy.Execute()
+
+	// THEN: The error is returned and the dependent command is not run.
+	assert.ErrorContains(t, err, "boom")
+	assert.False(t, executed)
+}
@@ -0,0 +1,135 @@
+package strategies
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/contrib/cel_extensions"
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+)
+
+// tableGroup collects consecutive row tasks on the same table.
+type tableGroup struct {
+	table   string
+	entity  *dump.Entity
+	first   int
+	cmds    []Cmd
+	fetched map[string]struct{} // storage keys set by the selects of the group
+}
+
+// dependsOn reports whether the task reads a storage key set within the group.
+// The keys are stored once the table pass is finished, so such a task has to
+// wait for the next pass.
+func (g *tableGroup) dependsOn(task *config.Task) (bool, error) {
+	keys, dynamic, err := cel_extensions.StorageKeys(task.Where)
+	if err != nil {
+		return false, err
+	}
+	if dynamic {
+		return len(g.fetched) > 0, nil
+	}
+	for _, key := range keys {
+		if _, ok := g.fetched[key]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// plannedCmd is a command executing one or several consecutive tasks.
+type plannedCmd struct {
+	cmd      Cmd
+	tasks    []int // indexes of the tasks in the config
+	taskCmds []Cmd // commands built for the tasks, stages of a fused command
+}
+
+// fuseTableTasks replaces consecutive select, update and delete tasks on the same table
+// with a single PipelineCmd, unless a task reads the storage keys fetched by a previous one.
+// cmds must hold the commands built for the tasks.
+func fuseTableTasks(
+	tasks []config.Task,
+	cmds []Cmd,
+	meta *dump.Dump,
+	workers int,
+) ([]plannedCmd, error) {
+	fused := make([]plannedCmd, 0, len(cmds))
+	var group *tableGroup
+
+	closeGroup := func() {
+		if group == nil {
+			return
+		}
+		indexes := make([]int, 0, len(group.cmds))
+		for idx := range group.cmds {
+			indexes = append(indexes, group.first+idx)
+		}
+		if len(group.cmds) == 1 {
+			fused = append(fused, plannedCmd{cmd: group.cmds[0], tasks: indexes, taskCmds: group.cmds})
+			group = nil
+			return
+		}
+
+		stages := make([]commands.RowStage, 0, len(group.cmds))
+		for _, cmd := range group.cmds {
+			stages = append(stages, cmd.(commands.RowStage))
+		}
+		name := fmt.Sprintf(
+			"PIPELINE tasks[%d..%d] ON %s",
+			group.first, group.first+len(group.cmds)-1, group.table,
+		)
+		log.Printf("[DEBUG] Fuse %d tasks into %s", len(group.cmds), name)
+		pipelineCmd := commands.NewPipelineCmd(
+			group.entity,
+			group.entity.DumpHandler,
+			stages,
+			commands.WithWorkers(workers),
+			commands.WithVerboseName(name),
+		)
+		fused = append(fused, plannedCmd{cmd: pipelineCmd, tasks: indexes, taskCmds: group.cmds})
+		group = nil
+	}
+
+	for idx := range tasks {
+		task := &tasks[idx]
+		if _, ok := cmds[idx].(commands.RowStage); !ok {
+			closeGroup()
+			fused = append(fused, plannedCmd{cmd: cmds[idx], tasks: []int{idx}, taskCmds: cmds[idx : idx+1]})
+			continue
+		}
+
+		entity, err := meta.GetTable(task.Table)
+		if err != nil {
+			return nil, fmt.Errorf("can't find %s entity in meta", task.Table)
+		}
+
+		if group != nil && group.entity == entity {
+			dependent, err := group.dependsOn(task)
+			if err != nil {
+				return nil, fmt.Errorf("can't analyze task[%d]: %w", idx, err)
+			}
+			if dependent {
+				closeGroup()
+			}
+		} else {
+			closeGroup()
+		}
+
+		if group == nil {
+			group = &tableGroup{
+				table:   task.Table,
+				entity:  entity,
+				first:   idx,
+				fetched: make(map[string]struct{}),
+			}
+		}
+		group.cmds = append(group.cmds, cmds[idx])
+		for key := range task.Fetch {
+			group.fetched[key] = struct{}{}
+		}
+	}
+	closeGroup()
+
+	return fused, nil
+}
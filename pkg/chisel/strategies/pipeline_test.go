@@ -0,0 +1,56 @@
+package strategies
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump"
+)
+
+func TestFuseTableTasks(t *testing.T) {
+	users := &dump.Entity{Id: 1, Table: &dump.TableMeta{Name: "users"}}
+	orders := &dump.Entity{Id: 2, Table: &dump.TableMeta{Name: "orders"}}
+	meta := &dump.Dump{Entities: map[string]*dump.Entity{
+		"public.users":  users,
+		"public.orders": orders,
+	}}
+
+	tasks := []config.Task{
+		{
+			Cmd: commands.SELECT_CMD, Table: "public.users", Where: "true",
+			Fetch: map[string]string{"users.id": "table.id"},
+		},
+		{Cmd: commands.DELETE_CMD, Table: "public.users", Where: "false"},
+		{Cmd: commands.UPDATE_CMD, Table: "public.users", Where: `string(table.id) in set("users.id")`},
+		{Cmd: commands.DELETE_CMD, Table: "public.users", Where: "true"},
+		{Cmd: commands.SELECT_CMD, Table: "public.orders", Where: "true"},
+		{Cmd: commands.SYNC_CMD},
+		{Cmd: commands.DELETE_CMD, Table: "public.orders", Where: "true"},
+	}
+	cmds := []Cmd{
+		commands.NewSelectCmd(users, nil, nil, nil),
+		commands.NewDeleteCmd(users, nil, nil),
+		commands.NewUpdateCmd(users, nil, nil, nil),
+		commands.NewDeleteCmd(users, nil, nil),
+		commands.NewSelectCmd(orders, nil, nil, nil),
+		commands.NewSyncDirCmd(commands.COPY_SYNC, "", ""),
+		commands.NewDeleteCmd(orders, nil, nil),
+	}
+
+	fused, err := fuseTableTasks(tasks, cmds, meta, 1)
+
+	// The update reads the key fetched by the first select, so it starts a new pass.
+	require.NoError(t, err)
+	require.Len(t, fused, 5)
+	assert.IsType(t, &commands.PipelineCmd{}, fused[0].cmd)
+	assert.Equal(t, []int{0, 1}, fused[0].tasks)
+	assert.IsType(t, &commands.PipelineCmd{}, fused[1].cmd)
+	assert.Equal(t, []int{2, 3}, fused[1].tasks)
+	assert.Same(t, cmds[4], fused[2].cmd)
+	assert.Same(t, cmds[5], fused[3].cmd)
+	assert.Same(t, cmds[6], fused[4].cmd)
+	assert.Equal(t, []int{6}, fused[4].tasks)
+}
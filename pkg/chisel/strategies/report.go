@@ -0,0 +1,86 @@
+package strategies
+
+import (
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+// TaskStats are the statistics of a task execution.
+type TaskStats struct {
+	Task  int    `json:"task"` // index of the task in the config
+	Cmd   string `json:"cmd"`
+	Table string `json:"table,omitempty"`
+	// Stats are nil if the command does not report them.
+	Stats *commands.Stats `json:"stats,omitempty"`
+	// StorageKeys are the storage keys written by the task, either fetched
+	// or set by the command, measured once all tasks are executed.
+	StorageKeys map[string]KeyStats `json:"storage_keys,omitempty"`
+}
+
+// KeyStats are the sizes of a storage key.
+type KeyStats struct {
+	Values      int `json:"values"`      // number of stored values
+	Cardinality int `json:"cardinality"` // number of distinct values
+}
+
+// taskReport collects the statistics of the commands built for the tasks.
+type taskReport struct {
+	tasks   []config.Task
+	cmds    []Cmd // commands indexed by the task
+	storage storage.Storage
+}
+
+func newTaskReport(tasks []config.Task, planned []plannedCmd, storage storage.Storage) *taskReport {
+	cmds := make([]Cmd, len(tasks))
+	for _, p := range planned {
+		for idx, task := range p.tasks {
+			cmds[task] = p.taskCmds[idx]
+		}
+	}
+	return &taskReport{
+		tasks:   tasks,
+		cmds:    cmds,
+		storage: storage,
+	}
+}
+
+func (r *taskReport) Stats() []TaskStats {
+	stats := make([]TaskStats, 0, len(r.tasks))
+	for idx, task := range r.tasks {
+		taskStats := TaskStats{
+			Task:  idx,
+			Cmd:   task.Cmd,
+			Table: task.Table,
+		}
+		var keys []string
+		for key := range task.Fetch {
+			keys = append(keys, key)
+		}
+		if reporter, ok := r.cmds[idx].(commands.StatsReporter); ok {
+			cmdStats := reporter.Stats()
+			taskStats.Stats = &cmdStats
+			keys = append(keys, cmdStats.StorageKeys...)
+		}
+		if len(keys) > 0 {
+			taskStats.StorageKeys = make(map[string]KeyStats, len(keys))
+			for _, key := range keys {
+				taskStats.StorageKeys[key] = r.keyStats(key)
+			}
+		}
+		stats = append(stats, taskStats)
+	}
+	return stats
+}
+
+// keyStats does not load the key if the storage knows its sizes.
+func (r *taskReport) keyStats(key string) KeyStats {
+	if sized, ok := r.storage.(storage.SetStorage); ok {
+		values, distinct := sized.Size(key)
+		return KeyStats{Values: values, Cardinality: distinct}
+	}
+	return KeyStats{
+		Values:      len(r.storage.Get(key)),
+		Cardinality: len(r.storage.GetSet(key)),
+	}
+}
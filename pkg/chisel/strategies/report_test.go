@@ -0,0 +1,74 @@
+package strategies
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/commands"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+type statsCmd struct {
+	stats commands.Stats
+}
+
+func (c *statsCmd) Execute() error {
+	return nil
+}
+
+func (c *statsCmd) Stats() commands.Stats {
+	return c.stats
+}
+
+func TestTaskReport_Stats(t *testing.T) {
+	store, err := storage.NewMapStringStorage(map[string][]string{"users.id": {"1", "2", "2"}})
+	require.NoError(t, err)
+
+	tasks := []config.Task{
+		{Cmd: commands.SELECT_CMD, Table: "users", Fetch: map[string]string{"users.id": "table.id"}},
+		{Cmd: commands.DELETE_CMD, Table: "users"},
+		{Cmd: commands.SYNC_CMD},
+	}
+	selectCmd := &statsCmd{stats: commands.Stats{Read: 3, Matched: 2, Fetched: 2}}
+	deleteCmd := &statsCmd{stats: commands.Stats{Read: 3, Matched: 1, Deleted: 1}}
+	syncCmd := commands.NewSkipCmd("dry run")
+	planned := []plannedCmd{
+		{cmd: funcCmd(nil), tasks: []int{0, 1}, taskCmds: []Cmd{selectCmd, deleteCmd}},
+		{cmd: syncCmd, tasks: []int{2}, taskCmds: []Cmd{syncCmd}},
+	}
+
+	stats := newTaskReport(tasks, planned, store).Stats()
+
+	// Stages of a fused command are reported by the task.
+	require.Len(t, stats, 3)
+	assert.Equal(t, TaskStats{
+		Task:        0,
+		Cmd:         commands.SELECT_CMD,
+		Table:       "users",
+		Stats:       &selectCmd.stats,
+		StorageKeys: map[string]KeyStats{"users.id": {Values: 3, Cardinality: 2}},
+	}, stats[0])
+	assert.Equal(t, &deleteCmd.stats, stats[1].Stats)
+	assert.Nil(t, stats[1].StorageKeys)
+	assert.Equal(t, &commands.Stats{}, stats[2].Stats, "sync is skipped")
+}
+
+func TestTaskReport_CmdStorageKeys(t *testing.T) {
+	store, err := storage.NewMapStringStorage(map[string][]string{"subset.users.id": {"1", "2"}})
+	require.NoError(t, err)
+
+	tasks := []config.Task{{Cmd: commands.SUBSET_CMD}}
+	subsetCmd := &statsCmd{stats: commands.Stats{StorageKeys: []string{"subset.users.id"}}}
+	planned := []plannedCmd{{cmd: subsetCmd, tasks: []int{0}, taskCmds: []Cmd{subsetCmd}}}
+
+	stats := newTaskReport(tasks, planned, store).Stats()
+
+	// Keys set by the command itself are reported with the fetched ones.
+	require.Len(t, stats, 1)
+	assert.Equal(t,
+		map[string]KeyStats{"subset.users.id": {Values: 2, Cardinality: 2}},
+		stats[0].StorageKeys,
+	)
+}
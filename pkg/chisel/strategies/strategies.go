@@ -9,7 +9,54 @@ import (
 	"github.com/zwergpro/pg-chisel/pkg/dump"
 )
 
+type Strategy interface {
+	Execute() error
+	// Stats returns the statistics of the executed tasks.
+	Stats() []TaskStats
+}
+
+type strategyOptions struct {
+	workers int
+	dryRun  bool
+	journal *Journal
+}
+
+type StrategyOption func(*strategyOptions)
+
+// WithWorkers evaluates the expressions of a table by the given number of workers.
+func WithWorkers(workers int) StrategyOption {
+	return func(o *strategyOptions) {
+		o.workers = workers
+	}
+}
+
+// WithDryRun skips the tasks writing outside of the dump tables, e.g. sync.
+// Table data is expected to be discarded by the dump handlers.
+func WithDryRun() StrategyOption {
+	return func(o *strategyOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithJournal records the completed tasks in the journal and skips
+// the tasks completed by the previous run.
+func WithJournal(journal *Journal) StrategyOption {
+	return func(o *strategyOptions) {
+		o.journal = journal
+	}
+}
+
+func newStrategyOptions(opts []StrategyOption) strategyOptions {
+	options := strategyOptions{workers: 1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
 type ConsistentStrategy struct {
+	*taskReport
+
 	cmds []Cmd
 }
 
@@ -26,15 +73,21 @@ func BuildConsistentStrategy(
 	conf *config.Config,
 	meta *dump.Dump,
 	storage storage.Storage,
+	opts ...StrategyOption,
 ) (*ConsistentStrategy, error) {
-	cmds, err := buildCommands(conf, meta, storage)
+	planned, err := buildCommands(conf, meta, storage, newStrategyOptions(opts))
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("[DEBUG] Tasks created: %d", len(cmds))
+	log.Printf("[DEBUG] Tasks created: %d", len(planned))
 
+	cmds := make([]Cmd, 0, len(planned))
+	for _, p := range planned {
+		cmds = append(cmds, p.cmd)
+	}
 	return &ConsistentStrategy{
-		cmds: cmds,
+		taskReport: newTaskReport(conf.Tasks, planned, storage),
+		cmds:       cmds,
 	}, nil
 }
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 	"github.com/zwergpro/pg-chisel/pkg/contrib/fs"
 	"gopkg.in/yaml.v3"
 )
@@ -17,6 +18,104 @@ type Task struct {
 	Set   map[string]string `yaml:"set"`
 	Fetch map[string]string `yaml:"fetch"`
 	Type  string            `yaml:"type"`
+
+	// subset command options
+	Roots  []SubsetRoot `yaml:"roots"`
+	Follow string       `yaml:"follow"`
+}
+
+// SubsetRoot selects the rows of a table the subset starts from.
+type SubsetRoot struct {
+	Table string `yaml:"table"`
+	Where string `yaml:"where"`
+}
+
+// Output describes how the destination dump is written.
+type Output struct {
+	// Compression of the written data, the source compression is kept if empty.
+	Compression string `yaml:"compression"`
+	// Compression level, 0 for the default level of the compression method.
+	Level int `yaml:"level"`
+}
+
+// StorageSection holds the predefined datasets, lists of values, and the declarations
+// of the keys kept in another form, mappings with their kind:
+//
+//	storage:
+//	  profile_ids: [1, 2, 3]
+//	  stale_users: {kind: bloom, fp_rate: 0.001, expected: 1000000}
+type StorageSection struct {
+	Values map[string][]string
+	Kinds  map[string]StorageKind
+}
+
+// StorageKind declares a storage key kept in another form than a list of strings.
+type StorageKind struct {
+	// Kind of the key: bloom.
+	Kind string `yaml:"kind"`
+	// False-positive rate of a bloom key.
+	FPRate float64 `yaml:"fp_rate"`
+	// Expected number of values of a bloom key, its filter is sized for them.
+	Expected int `yaml:"expected"`
+}
+
+func (s *StorageSection) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: storage must be a mapping", node.Line)
+	}
+	s.Values = make(map[string][]string)
+	for i := 0; i < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+
+		if valueNode.Kind != yaml.MappingNode {
+			var values []string
+			if err := valueNode.Decode(&values); err != nil {
+				return fmt.Errorf("storage key %s: %w", key, err)
+			}
+			s.Values[key] = values
+			continue
+		}
+
+		// the decoder of a node does not fail on unknown fields
+		for j := 0; j < len(valueNode.Content); j += 2 {
+			field := valueNode.Content[j].Value
+			if field != "kind" && field != "fp_rate" && field != "expected" {
+				return fmt.Errorf("line %d: storage key %s has unknown field %s",
+					valueNode.Content[j].Line, key, field)
+			}
+		}
+		var kind StorageKind
+		if err := valueNode.Decode(&kind); err != nil {
+			return fmt.Errorf("storage key %s: %w", key, err)
+		}
+		if s.Kinds == nil {
+			s.Kinds = make(map[string]StorageKind)
+		}
+		s.Kinds[key] = kind
+	}
+	return nil
+}
+
+// BloomKeys returns the declarations of the bloom keys.
+func (s StorageSection) BloomKeys() map[string]storage.BloomKey {
+	keys := make(map[string]storage.BloomKey)
+	for key, kind := range s.Kinds {
+		if kind.Kind == BLOOM_STORAGE_KIND {
+			keys[key] = storage.BloomKey{FPRate: kind.FPRate, Expected: kind.Expected}
+		}
+	}
+	return keys
+}
+
+// StorageBackend selects where the fetched keys are kept.
+type StorageBackend struct {
+	// Type is memory (the default) or disk.
+	Type string `yaml:"type"`
+	// Directory of the disk storage files, the system temp directory if empty.
+	Dir string `yaml:"dir"`
+	// Memory used by the disk storage before spilling keys to disk.
+	MemoryMB int `yaml:"memory_mb"`
 }
 
 type Config struct {
@@ -28,13 +127,16 @@ type Config struct {
 	TocFile string `yaml:"toc"`
 
 	// List the table of contents of the archive.
+	// Deprecated: the TOC file is parsed natively, the list file is ignored.
 	ListFile string `yaml:"listFile"`
 
 	Format      string `yaml:"format"`
 	Compression string `yaml:"compression"`
+	Output      Output `yaml:"output"`
 
-	Storage map[string][]string `yaml:"storage"`
-	Tasks   []Task              `yaml:"tasks"`
+	Storage        StorageSection `yaml:"storage"`
+	StorageBackend StorageBackend `yaml:"storage_backend"`
+	Tasks          []Task         `yaml:"tasks"`
 }
 
 func New(fname string) (*Config, error) {
@@ -50,6 +152,8 @@ func New(fname string) (*Config, error) {
 		return nil, fmt.Errorf("unmarshaling error: %s", err)
 	}
 
+	c.setDefaults()
+
 	if err := c.convertPaths(); err != nil {
 		return nil, fmt.Errorf("paths converting error: %w", err)
 	}
@@ -70,6 +174,33 @@ func unmarshalConfigFile(fname string, data []byte, res *Config) error {
 	return nil
 }
 
+func (c *Config) setDefaults() {
+	if c.TocFile == "" {
+		c.TocFile = DEFAULT_TOC_FILE
+	}
+	for key, kind := range c.Storage.Kinds {
+		if kind.Kind != BLOOM_STORAGE_KIND {
+			continue
+		}
+		if kind.FPRate == 0 {
+			kind.FPRate = DEFAULT_BLOOM_FP_RATE
+		}
+		if kind.Expected == 0 {
+			kind.Expected = DEFAULT_BLOOM_EXPECTED
+		}
+		c.Storage.Kinds[key] = kind
+	}
+	if c.StorageBackend.Type == "" {
+		c.StorageBackend.Type = MEMORY_STORAGE
+	}
+	if c.StorageBackend.MemoryMB == 0 {
+		c.StorageBackend.MemoryMB = DEFAULT_STORAGE_MEMORY_MB
+	}
+	if c.ListFile != "" {
+		log.Printf("[WARN] 'listFile' is deprecated and ignored, the TOC is read from %s", c.TocFile)
+	}
+}
+
 func (c *Config) convertPaths() error {
 	sourcePath, err := fs.GetAbsolutePath(c.Source)
 	if err != nil {
@@ -82,6 +213,14 @@ func (c *Config) convertPaths() error {
 		return fmt.Errorf("destination path converting error: %w", err)
 	}
 	c.Destination = destinationPath
+
+	if c.StorageBackend.Dir != "" {
+		storageDir, err := fs.GetAbsolutePath(c.StorageBackend.Dir)
+		if err != nil {
+			return fmt.Errorf("storage directory path converting error: %w", err)
+		}
+		c.StorageBackend.Dir = storageDir
+	}
 	return nil
 }
 
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalConfigFile_Storage(t *testing.T) {
+	data := []byte(`
+storage:
+  profile_ids: [1, 2, 3]
+  empty:
+  stale_users:
+    kind: bloom
+    fp_rate: 0.001
+    expected: 5000
+  old_orders: {kind: bloom}
+`)
+
+	var conf Config
+	require.NoError(t, unmarshalConfigFile("chisel.yml", data, &conf))
+	conf.setDefaults()
+
+	assert.Equal(t,
+		map[string][]string{"profile_ids": {"1", "2", "3"}, "empty": nil},
+		conf.Storage.Values,
+	)
+	assert.Equal(t, map[string]StorageKind{
+		"stale_users": {Kind: BLOOM_STORAGE_KIND, FPRate: 0.001, Expected: 5000},
+		"old_orders": {
+			Kind: BLOOM_STORAGE_KIND, FPRate: DEFAULT_BLOOM_FP_RATE, Expected: DEFAULT_BLOOM_EXPECTED,
+		},
+	}, conf.Storage.Kinds)
+	assert.Equal(t, map[string]storage.BloomKey{
+		"stale_users": {FPRate: 0.001, Expected: 5000},
+		"old_orders":  {FPRate: 0.01, Expected: 1_000_000},
+	}, conf.Storage.BloomKeys())
+}
+
+func TestUnmarshalConfigFile_StorageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"unknown field", "storage:\n  users: {kind: bloom, rate: 0.1}\n", "unknown field rate"},
+		{"scalar value", "storage:\n  users: abc\n", "storage key users"},
+		{"not a mapping", "storage: [1, 2]\n", "storage must be a mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conf Config
+			err := unmarshalConfigFile("chisel.yml", []byte(tt.data), &conf)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
@@ -2,10 +2,39 @@ package config
 
 // Compression types
 const (
+	NONE_COMPRESSION = "none"
 	GZIP_COMPRESSION = "gzip"
+	LZ4_COMPRESSION  = "lz4"
+	ZSTD_COMPRESSION = "zstd"
 )
 
 // Dump formats
 const (
 	DIRECTORY_FORMAT = "directory"
+	CUSTOM_FORMAT    = "custom"
+	TAR_FORMAT       = "tar"
+	PLAIN_FORMAT     = "plain"
+)
+
+// Storage backends
+const (
+	MEMORY_STORAGE = "memory"
+	DISK_STORAGE   = "disk"
+)
+
+// DEFAULT_STORAGE_MEMORY_MB is the memory the disk storage uses before spilling keys to disk.
+const DEFAULT_STORAGE_MEMORY_MB = 256
+
+// BLOOM_STORAGE_KIND is the kind of the storage keys kept as bloom filters.
+const BLOOM_STORAGE_KIND = "bloom"
+
+// DEFAULT_BLOOM_FP_RATE is the false-positive rate of a bloom key without fp_rate.
+const DEFAULT_BLOOM_FP_RATE = 0.01
+
+// DEFAULT_BLOOM_EXPECTED is the expected number of values of a bloom key without expected.
+const DEFAULT_BLOOM_EXPECTED = 1_000_000
+
+// Default file names
+const (
+	DEFAULT_TOC_FILE = "toc.dat"
 )
@@ -16,7 +16,9 @@ func ValidateConfig(conf *Config) error {
 		validatePaths,
 		validateFormat,
 		validateCompression,
+		validateOutput,
 		validateStorage,
+		validateStorageBackend,
 		validateTasks,
 	}
 
@@ -40,21 +42,103 @@ func validatePaths(conf *Config) error {
 }
 
 func validateFormat(conf *Config) error {
-	if conf.Format != DIRECTORY_FORMAT {
+	formats := []string{DIRECTORY_FORMAT, CUSTOM_FORMAT, TAR_FORMAT, PLAIN_FORMAT}
+	if !slices.Contains(formats, conf.Format) {
 		return fmt.Errorf("unsupported format: %s", conf.Format)
 	}
 	return nil
 }
 
 func validateCompression(conf *Config) error {
-	if conf.Compression != GZIP_COMPRESSION {
+	// Compression of data files is detected from their extensions,
+	// the option is only checked against the detected one.
+	if conf.Compression == "" {
+		return nil
+	}
+	compressions := []string{NONE_COMPRESSION, GZIP_COMPRESSION, LZ4_COMPRESSION, ZSTD_COMPRESSION}
+	if !slices.Contains(compressions, conf.Compression) {
 		return fmt.Errorf("unsupported compression: %s", conf.Compression)
 	}
 	return nil
 }
 
+// maxCompressionLevels lists the maximum level of each compression method.
+var maxCompressionLevels = map[string]int{
+	NONE_COMPRESSION: 0,
+	GZIP_COMPRESSION: 9,
+	LZ4_COMPRESSION:  9,
+	ZSTD_COMPRESSION: 22,
+}
+
+func validateOutput(conf *Config) error {
+	out := conf.Output
+	if out.Compression == "" {
+		if out.Level != 0 {
+			return fmt.Errorf("output level requires output compression")
+		}
+		return nil
+	}
+
+	maxLevel, exists := maxCompressionLevels[out.Compression]
+	if !exists {
+		return fmt.Errorf("unsupported output compression: %s", out.Compression)
+	}
+	if out.Level < 0 || out.Level > maxLevel {
+		return fmt.Errorf(
+			"output level %d is out of range [0, %d] for %s",
+			out.Level,
+			maxLevel,
+			out.Compression,
+		)
+	}
+
+	// pg_dump compresses data of single-file archives with gzip only
+	// (tar members are never compressed)
+	formatCompressions := map[string][]string{
+		CUSTOM_FORMAT: {NONE_COMPRESSION, GZIP_COMPRESSION},
+		PLAIN_FORMAT:  {NONE_COMPRESSION, GZIP_COMPRESSION},
+		TAR_FORMAT:    {NONE_COMPRESSION},
+	}
+	allowed, ok := formatCompressions[conf.Format]
+	if ok && !slices.Contains(allowed, out.Compression) {
+		return fmt.Errorf(
+			"output compression %s is not supported by %s format",
+			out.Compression,
+			conf.Format,
+		)
+	}
+	return nil
+}
+
 func validateStorage(conf *Config) error {
-	// No specific validation implemented.
+	for key, kind := range conf.Storage.Kinds {
+		if kind.Kind != BLOOM_STORAGE_KIND {
+			return fmt.Errorf("storage key %s has unsupported kind: %s", key, kind.Kind)
+		}
+		if kind.FPRate <= 0 || kind.FPRate >= 1 {
+			return fmt.Errorf("storage key %s fp_rate %v is out of range (0, 1)", key, kind.FPRate)
+		}
+		if kind.Expected <= 0 {
+			return fmt.Errorf("storage key %s expected must be positive, got %d", key, kind.Expected)
+		}
+	}
+	return nil
+}
+
+func validateStorageBackend(conf *Config) error {
+	backend := conf.StorageBackend
+	switch backend.Type {
+	case "", MEMORY_STORAGE:
+		if backend.Dir != "" {
+			return fmt.Errorf("storage_backend dir requires the %s type", DISK_STORAGE)
+		}
+	case DISK_STORAGE:
+	default:
+		return fmt.Errorf("unsupported storage_backend type: %s", backend.Type)
+	}
+	if backend.MemoryMB < 0 {
+		return fmt.Errorf("storage_backend memory_mb can not be negative: %d", backend.MemoryMB)
+	}
 	return nil
 }
 
@@ -69,6 +153,8 @@ func validateTasks(conf *Config) error {
 		"delete":   validateDeleteCmd,
 		"sync":     validateSyncCmd,
 		"truncate": validateTruncateCmd,
+		"drop":     validateDropCmd,
+		"subset":   validateSubsetCmd,
 	}
 
 	for idx, task := range conf.Tasks {
@@ -84,6 +170,18 @@ func validateTasks(conf *Config) error {
 		if err := validator(task); err != nil {
 			return fmt.Errorf("task[%d] error: %w", idx, err)
 		}
+
+		if task.Cmd == "sync" && conf.Format != DIRECTORY_FORMAT {
+			return fmt.Errorf(
+				"task[%d] error: sync is supported by %s format only",
+				idx,
+				DIRECTORY_FORMAT,
+			)
+		}
+
+		if task.Cmd == "drop" && conf.Format == PLAIN_FORMAT {
+			return fmt.Errorf("task[%d] error: drop is not supported by %s format", idx, PLAIN_FORMAT)
+		}
 	}
 
 	return nil
@@ -134,6 +232,28 @@ func validateTruncateCmd(task Task) error {
 	return nil
 }
 
+func validateDropCmd(task Task) error {
+	if task.Table == "" {
+		return fmt.Errorf("'table' cannot be empty")
+	}
+	return nil
+}
+
+func validateSubsetCmd(task Task) error {
+	if len(task.Roots) == 0 {
+		return fmt.Errorf("'roots' cannot be empty")
+	}
+	for idx, root := range task.Roots {
+		if err := validateTableAndWhere(Task{Table: root.Table, Where: root.Where}); err != nil {
+			return fmt.Errorf("root[%d] error: %w", idx, err)
+		}
+	}
+	if !slices.Contains([]string{"", "parents", "both"}, task.Follow) {
+		return fmt.Errorf("'follow' has invalid value: %s", task.Follow)
+	}
+	return nil
+}
+
 func validateTableAndWhere(task Task) error {
 	if task.Table == "" {
 		return fmt.Errorf("'table' cannot be empty")
@@ -142,13 +262,16 @@ func validateTableAndWhere(task Task) error {
 		return fmt.Errorf("'where' expression cannot be empty")
 	}
 
-	// Include GetArrayFunc and GetSetFunc for the CEL validation.
+	// Include the storage and sampling functions for the CEL validation.
 	mockStorage, _ := storage.NewMapStringStorage(map[string][]string{})
-	return validateCELExpression(
-		task.Where,
+	opts := []cel.EnvOption{
 		cel_extensions.GetArrayFunc(mockStorage),
 		cel_extensions.GetSetFunc(mockStorage),
-	)
+		cel_extensions.GetIntSetFunc(mockStorage),
+		cel_extensions.GetMaybeInFunc(mockStorage),
+	}
+	opts = append(opts, cel_extensions.SampleFuncs()...)
+	return validateCELExpression(task.Where, opts...)
 }
 
 func validateExpressionMap(exprMap map[string]string, context string) error {
@@ -161,6 +284,9 @@ func validateExpressionMap(exprMap map[string]string, context string) error {
 }
 
 func validateCELExpression(expr string, opts ...cel.EnvOption) error {
+	// Column types are unknown until the dump is loaded, the typed row
+	// is checked when the tasks are built.
+	opts = append(opts, cel.Variable(cel_extensions.ROW_VAR, cel.MapType(cel.StringType, cel.DynType)))
 	env, err := cel_extensions.NewEnv(opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create CEL environment: %w", err)
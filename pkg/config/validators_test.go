@@ -113,6 +113,44 @@ func TestValidateConfig_SelectCmd(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("typed row", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:   "select",
+					Table: "users",
+					Where: "row.id > 0 && row.name != null",
+					Fetch: map[string]string{"id": "row.id"},
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.NoError(t, err)
+	})
+
+	t.Run("sampled rows", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:   "select",
+					Table: "users",
+					Where: `sample(table.id, 0.05) || sample_seeded(table.id, 0.01, "admins")`,
+					Fetch: map[string]string{"id": "table.id"},
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.NoError(t, err)
+	})
+
 	t.Run("missing table in task", func(t *testing.T) {
 		conf := &Config{
 			Source:      "src",
@@ -506,3 +544,349 @@ func TestValidateConfig_TruncateCmd(t *testing.T) {
 		require.Contains(t, err.Error(), "'table' cannot be empty")
 	})
 }
+
+func TestValidateConfig_DropCmd(t *testing.T) {
+	t.Run("valid config", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Compression: GZIP_COMPRESSION,
+			Tasks: []Task{
+				{
+					Cmd:   "drop",
+					Table: "users",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.NoError(t, err)
+	})
+
+	t.Run("missing table in task", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Compression: GZIP_COMPRESSION,
+			Tasks: []Task{
+				{
+					Cmd: "drop",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'table' cannot be empty")
+	})
+}
+
+func TestValidateConfig_SubsetCmd(t *testing.T) {
+	t.Run("valid config", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:    "subset",
+					Roots:  []SubsetRoot{{Table: "users", Where: "row.id < 100"}},
+					Follow: "both",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.NoError(t, err)
+	})
+
+	t.Run("missing roots", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd: "subset",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'roots' cannot be empty")
+	})
+
+	t.Run("invalid root", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:   "subset",
+					Roots: []SubsetRoot{{Table: "users"}},
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "root[0] error: 'where' expression cannot be empty")
+	})
+
+	t.Run("invalid follow", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:    "subset",
+					Roots:  []SubsetRoot{{Table: "users", Where: "true"}},
+					Follow: "children",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'follow' has invalid value: children")
+	})
+}
+
+func TestValidateConfig_CustomFormat(t *testing.T) {
+	t.Run("valid config without compression", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src.dump",
+			Destination: "dest.dump",
+			Format:      CUSTOM_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:   "truncate",
+					Table: "users",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.NoError(t, err)
+	})
+
+	t.Run("sync is not supported", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src.dump",
+			Destination: "dest.dump",
+			Format:      CUSTOM_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:  "sync",
+					Type: "copy",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "sync is supported by directory format only")
+	})
+}
+
+func TestValidateConfig_PlainFormat(t *testing.T) {
+	t.Run("valid config without compression", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src.sql.gz",
+			Destination: "dest.sql.gz",
+			Format:      PLAIN_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:   "truncate",
+					Table: "users",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.NoError(t, err)
+	})
+
+	t.Run("drop is not supported", func(t *testing.T) {
+		conf := &Config{
+			Source:      "src.sql",
+			Destination: "dest.sql",
+			Format:      PLAIN_FORMAT,
+			Tasks: []Task{
+				{
+					Cmd:   "drop",
+					Table: "users",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "drop is not supported by plain format")
+	})
+}
+
+func TestValidateConfig_Compression(t *testing.T) {
+	for _, compression := range []string{
+		"",
+		NONE_COMPRESSION,
+		GZIP_COMPRESSION,
+		LZ4_COMPRESSION,
+		ZSTD_COMPRESSION,
+	} {
+		conf := &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Compression: compression,
+			Tasks: []Task{
+				{
+					Cmd:   "truncate",
+					Table: "users",
+				},
+			},
+		}
+
+		err := ValidateConfig(conf)
+		require.NoError(t, err, compression)
+	}
+}
+
+func TestValidateConfig_Output(t *testing.T) {
+	newConf := func(format string, output Output) *Config {
+		return &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      format,
+			Output:      output,
+			Tasks: []Task{
+				{
+					Cmd:   "truncate",
+					Table: "users",
+				},
+			},
+		}
+	}
+
+	t.Run("valid output", func(t *testing.T) {
+		err := ValidateConfig(newConf(DIRECTORY_FORMAT, Output{Compression: ZSTD_COMPRESSION, Level: 19}))
+		require.NoError(t, err)
+	})
+
+	t.Run("unsupported compression", func(t *testing.T) {
+		err := ValidateConfig(newConf(DIRECTORY_FORMAT, Output{Compression: "brotli"}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported output compression")
+	})
+
+	t.Run("level out of range", func(t *testing.T) {
+		err := ValidateConfig(newConf(DIRECTORY_FORMAT, Output{Compression: GZIP_COMPRESSION, Level: 10}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "out of range")
+	})
+
+	t.Run("level without compression", func(t *testing.T) {
+		err := ValidateConfig(newConf(DIRECTORY_FORMAT, Output{Level: 5}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "requires output compression")
+	})
+
+	t.Run("compression not supported by format", func(t *testing.T) {
+		err := ValidateConfig(newConf(CUSTOM_FORMAT, Output{Compression: ZSTD_COMPRESSION}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not supported by custom format")
+	})
+}
+
+func TestValidateConfig_StorageBackend(t *testing.T) {
+	newConf := func(backend StorageBackend) *Config {
+		return &Config{
+			Source:         "src",
+			Destination:    "dest",
+			Format:         DIRECTORY_FORMAT,
+			StorageBackend: backend,
+			Tasks: []Task{
+				{
+					Cmd:   "truncate",
+					Table: "users",
+				},
+			},
+		}
+	}
+
+	t.Run("valid backends", func(t *testing.T) {
+		require.NoError(t, ValidateConfig(newConf(StorageBackend{})))
+		require.NoError(t, ValidateConfig(newConf(StorageBackend{Type: MEMORY_STORAGE})))
+		require.NoError(t, ValidateConfig(newConf(StorageBackend{
+			Type:     DISK_STORAGE,
+			Dir:      "/tmp",
+			MemoryMB: 64,
+		})))
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		err := ValidateConfig(newConf(StorageBackend{Type: "redis"}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported storage_backend type")
+	})
+
+	t.Run("dir of memory storage", func(t *testing.T) {
+		err := ValidateConfig(newConf(StorageBackend{Type: MEMORY_STORAGE, Dir: "/tmp"}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "requires the disk type")
+	})
+
+	t.Run("negative memory", func(t *testing.T) {
+		err := ValidateConfig(newConf(StorageBackend{Type: DISK_STORAGE, MemoryMB: -1}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "can not be negative")
+	})
+}
+
+func TestValidateConfig_StorageKinds(t *testing.T) {
+	newConf := func(kind StorageKind) *Config {
+		return &Config{
+			Source:      "src",
+			Destination: "dest",
+			Format:      DIRECTORY_FORMAT,
+			Storage:     StorageSection{Kinds: map[string]StorageKind{"users": kind}},
+			Tasks: []Task{
+				{
+					Cmd:   "truncate",
+					Table: "users",
+				},
+			},
+		}
+	}
+
+	t.Run("bloom key", func(t *testing.T) {
+		require.NoError(t, ValidateConfig(newConf(
+			StorageKind{Kind: BLOOM_STORAGE_KIND, FPRate: 0.01, Expected: 1000},
+		)))
+	})
+
+	t.Run("negative expected", func(t *testing.T) {
+		err := ValidateConfig(newConf(
+			StorageKind{Kind: BLOOM_STORAGE_KIND, FPRate: 0.01, Expected: -1},
+		))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "expected must be positive")
+	})
+
+	t.Run("unsupported kind", func(t *testing.T) {
+		err := ValidateConfig(newConf(StorageKind{Kind: "hll", FPRate: 0.01}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported kind: hll")
+	})
+
+	t.Run("fp_rate out of range", func(t *testing.T) {
+		err := ValidateConfig(newConf(StorageKind{Kind: BLOOM_STORAGE_KIND, FPRate: 1}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "out of range")
+	})
+}
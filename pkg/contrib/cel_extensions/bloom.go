@@ -0,0 +1,68 @@
+package cel_extensions
+
+import (
+	"strconv"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// BloomStorage is a storage answering approximate membership queries.
+type BloomStorage interface {
+	MayContain(key, value string) (bool, error)
+}
+
+// GetMaybeInFunc adds maybe_in(key, value), which is true if the value may be in the key:
+// a bloom key may report a value which was never fetched, other keys are queried exactly.
+// Integer values are compared with their decimal text, as they are fetched.
+func GetMaybeInFunc(store Storage) cel.EnvOption {
+	mayContain := func(key, value string) (bool, error) {
+		_, found := store.GetSet(key)[value]
+		return found, nil
+	}
+	if bloom, ok := store.(BloomStorage); ok {
+		mayContain = bloom.MayContain
+	} else if sets, ok := store.(SetStorage); ok {
+		mayContain = sets.Contains
+	}
+
+	binding := func(lhs, rhs ref.Val) ref.Val {
+		key, ok := lhs.(types.String)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(lhs)
+		}
+		var value string
+		switch v := rhs.(type) {
+		case types.String:
+			value = string(v)
+		case types.Bytes:
+			value = string(v)
+		case types.Int:
+			value = strconv.FormatInt(int64(v), 10)
+		default:
+			return types.MaybeNoSuchOverloadErr(rhs)
+		}
+
+		found, err := mayContain(string(key), value)
+		if err != nil {
+			return types.NewErr("maybe_in(%q): %v", string(key), err)
+		}
+		return types.Bool(found)
+	}
+
+	return cel.Function("maybe_in",
+		cel.Overload("maybe_in_string",
+			[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+			cel.BinaryBinding(binding),
+		),
+		cel.Overload("maybe_in_bytes",
+			[]*cel.Type{cel.StringType, cel.BytesType}, cel.BoolType,
+			cel.BinaryBinding(binding),
+		),
+		cel.Overload("maybe_in_int",
+			[]*cel.Type{cel.StringType, cel.IntType}, cel.BoolType,
+			cel.BinaryBinding(binding),
+		),
+	)
+}
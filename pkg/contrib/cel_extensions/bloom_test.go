@@ -0,0 +1,52 @@
+package cel_extensions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+)
+
+func TestCustomFunctions_MaybeIn(t *testing.T) {
+	inner, _ := storage.NewMapStringStorage(map[string][]string{"ids": {"1", "2"}})
+	bloom := storage.NewBloomStorage(inner, map[string]storage.BloomKey{"stale": {FPRate: 0.001, Expected: 100}})
+	bloom.Set("stale", []string{"10", "20"})
+	// a spilled key is queried by the disk storage, its set is not loaded
+	disk, err := storage.NewDiskStorage(nil, t.TempDir(), 16)
+	require.NoError(t, err)
+	defer disk.Close()
+	disk.Set("ids", []string{"1", "2", "3", "4", "5", "6", "7", "8"})
+
+	tests := []struct {
+		name     string
+		store    Storage
+		expr     string
+		expected bool
+	}{
+		{"bloom key bytes", bloom, `maybe_in("stale", table.id)`, true},
+		{"bloom key int", bloom, `maybe_in("stale", 20)`, true},
+		{"bloom key string", bloom, `maybe_in("stale", "30")`, false},
+		{"exact key of bloom storage", bloom, `maybe_in("ids", 2)`, true},
+		{"disk storage", disk, `maybe_in("ids", 8) && !maybe_in("ids", table.id)`, true},
+		{"exact storage", inner, `maybe_in("ids", "1") && !maybe_in("ids", table.id)`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := NewEnv(GetMaybeInFunc(tt.store))
+			require.NoError(t, err)
+			ast, issues := env.Compile(tt.expr)
+			require.NoError(t, issues.Err())
+			prg, err := env.Program(ast)
+			require.NoError(t, err)
+
+			out, _, err := prg.Eval(map[string]interface{}{
+				"table": map[string][]byte{"id": []byte("10")},
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out.Value())
+		})
+	}
+}
@@ -19,11 +19,19 @@ func NewEnv(opts ...cel.EnvOption) (*cel.Env, error) {
 	opts = append(opts,
 		cel.Constant("NULL", cel.StringType, types.String(PG_NULL)),
 		cel.Variable("table", cel.MapType(cel.StringType, cel.BytesType)),
+		bytesToIntFunc(),
 	)
+	opts = append(opts, pseudoFuncs()...)
+	opts = append(opts, maskFuncs()...)
+	opts = append(opts, fakeFuncs()...)
+	opts = append(opts, shiftFuncs()...)
 	return cel.NewEnv(opts...)
 }
 
+// GetArrayFunc adds array(), the values of a SetStorage are read lazily.
 func GetArrayFunc(storage Storage) cel.EnvOption {
+	setStorage, lazy := storage.(SetStorage)
+
 	return cel.Function("array",
 		cel.Overload("store_array_strings",
 			[]*cel.Type{cel.StringType},
@@ -34,13 +42,19 @@ func GetArrayFunc(storage Storage) cel.EnvOption {
 				}
 
 				key := args[0].Value().(string)
+				if lazy {
+					return &storageArray{storage: setStorage, key: key}
+				}
 				return types.DefaultTypeAdapter.NativeToValue(storage.Get(key))
 			}),
 		),
 	)
 }
 
+// GetSetFunc adds set(), the set of a SetStorage is queried lazily.
 func GetSetFunc(storage Storage) cel.EnvOption {
+	setStorage, lazy := storage.(SetStorage)
+
 	return cel.Function("set",
 		cel.Overload("store_set_strings",
 			[]*cel.Type{cel.StringType},
@@ -51,6 +65,9 @@ func GetSetFunc(storage Storage) cel.EnvOption {
 				}
 
 				key := args[0].Value().(string)
+				if lazy {
+					return &storageSet{storage: setStorage, key: key}
+				}
 				return types.DefaultTypeAdapter.NativeToValue(storage.GetSet(key))
 			}),
 		),
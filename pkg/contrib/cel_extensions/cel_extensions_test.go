@@ -1,11 +1,17 @@
 package cel_extensions
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/google/cel-go/common/types/ref"
+
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
 	"github.com/zwergpro/pg-chisel/pkg/chisel/storage/mocks"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCustomFunctions_Array(t *testing.T) {
@@ -93,3 +99,67 @@ func TestCustomFunctions_Set_InvalidInput(t *testing.T) {
 	assert.Error(t, err, "evaluation should fail")
 	assert.ErrorContains(t, err, "no such overload")
 }
+
+func TestCustomFunctions_Set_SpilledKey(t *testing.T) {
+	// GIVEN: A disk storage with a key spilled to disk.
+	store, err := storage.NewDiskStorage(nil, t.TempDir(), 64)
+	require.NoError(t, err)
+	defer store.Close()
+	store.Set("testKey", []string{"value1", "value2", "value1", "value3", "value4"})
+
+	env, err := NewEnv(GetSetFunc(store))
+	require.NoError(t, err)
+
+	// WHEN: The set is queried.
+	ast, issues := env.Compile(
+		`"value2" in set("testKey") && !("value5" in set("testKey")) && size(set("testKey")) == 4`,
+	)
+	require.NoError(t, issues.Err())
+	prg, err := env.Program(ast)
+	require.NoError(t, err)
+	out, _, err := prg.Eval(map[string]interface{}{})
+
+	// THEN: It keeps the semantics of the in-memory set.
+	require.NoError(t, err)
+	assert.Equal(t, true, out.Value())
+}
+
+func TestCustomFunctions_Array_SpilledKey(t *testing.T) {
+	// GIVEN: A disk storage with a key spilled to disk.
+	store, err := storage.NewDiskStorage(nil, t.TempDir(), 64)
+	require.NoError(t, err)
+	defer store.Close()
+	store.Set("testKey", []string{"value1", "value2", "value1", "value3", "value4"})
+
+	env, err := NewEnv(GetArrayFunc(store))
+	require.NoError(t, err)
+	eval := func(expr string) (ref.Val, error) {
+		ast, issues := env.Compile(expr)
+		require.NoError(t, issues.Err())
+		prg, err := env.Program(ast)
+		require.NoError(t, err)
+		out, _, err := prg.Eval(map[string]interface{}{})
+		return out, err
+	}
+
+	// WHEN: The array is queried.
+	out, err := eval(`"value2" in array("testKey") && !("value5" in array("testKey")) && ` +
+		`size(array("testKey")) == 5 && array("testKey")[1] == "value2" && ` +
+		`dyn(array("testKey")).exists(v, v == "value4")`)
+
+	// THEN: It keeps the semantics of the in-memory list.
+	require.NoError(t, err)
+	assert.Equal(t, true, out.Value())
+
+	// WHEN: The values file can not be read.
+	files, err := filepath.Glob(filepath.Join(store.Dir(), "*.values"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.NoError(t, os.Remove(files[0]))
+
+	// THEN: Reading the values fails the expression.
+	_, err = eval(`dyn(array("testKey")).exists(v, v == "value4")`)
+	assert.ErrorContains(t, err, "cannot read values of testKey")
+	_, err = eval(`array("testKey")[0] == "value1"`)
+	assert.ErrorContains(t, err, "cannot read values of testKey")
+}
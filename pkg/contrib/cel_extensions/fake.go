@@ -0,0 +1,142 @@
+package cel_extensions
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// fakeFuncs adds the fake.* functions generating realistic values from the word lists.
+// The output only depends on the seed, usually the primary key of the row, and on the
+// locale, so regenerating a dump gives the same values.
+func fakeFuncs() []cel.EnvOption {
+	return []cel.EnvOption{
+		fakeFunc("fake.first_name", nil, fakeWord("first_names")),
+		fakeFunc("fake.last_name", nil, fakeWord("last_names")),
+		fakeFunc("fake.name", nil, fakeName),
+		fakeFunc("fake.city", nil, fakeWord("cities")),
+		fakeFunc("fake.company", nil, fakeCompany),
+		fakeFunc("fake.sentence", []*cel.Type{cel.IntType}, fakeSentence),
+	}
+}
+
+// fakeGenerator returns the value of the locale, params are the arguments following the seed.
+type fakeGenerator func(stream *keyedStream, locale string, params []ref.Val) (string, error)
+
+// fakeFunc declares name(seed, params...) with the default locale and
+// name(seed, params..., locale), for string, bytes and int seeds.
+func fakeFunc(name string, params []*cel.Type, gen fakeGenerator) cel.EnvOption {
+	binding := func(args ...ref.Val) ref.Val {
+		seed, ok := seedString(args[0])
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(args[0])
+		}
+		locale := DEFAULT_LOCALE
+		if len(args) > len(params)+1 {
+			localeStr, ok := args[len(args)-1].(types.String)
+			if !ok {
+				return types.MaybeNoSuchOverloadErr(args[len(args)-1])
+			}
+			locale = string(localeStr)
+		}
+		// the seed is not a secret, the stream is not keyed
+		stream := newKeyedStream(nil, name, seed)
+		out, err := gen(stream, locale, args[1:len(params)+1])
+		if err != nil {
+			return types.NewErr("%s(): %v", name, err)
+		}
+		return types.String(out)
+	}
+
+	overloadName := strings.ReplaceAll(name, ".", "_")
+	var opts []cel.FunctionOpt
+	for _, seedType := range []*cel.Type{cel.StringType, cel.BytesType, cel.IntType} {
+		argTypes := slices.Concat([]*cel.Type{seedType}, params)
+		opts = append(opts,
+			cel.Overload(overloadName+"_"+seedType.String(),
+				argTypes, cel.StringType, cel.FunctionBinding(binding),
+			),
+			cel.Overload(overloadName+"_"+seedType.String()+"_locale",
+				append(argTypes, cel.StringType), cel.StringType, cel.FunctionBinding(binding),
+			),
+		)
+	}
+	return cel.Function(name, opts...)
+}
+
+// seedString returns the text of a string, bytes or int seed, so table.id and
+// int(table.id) are the same seed.
+func seedString(val ref.Val) (string, bool) {
+	if v, ok := val.(types.Int); ok {
+		return strconv.FormatInt(int64(v), 10), true
+	}
+	return valueString(val)
+}
+
+func fakeWord(list string) fakeGenerator {
+	return func(stream *keyedStream, locale string, _ []ref.Val) (string, error) {
+		list, err := words(locale, list)
+		if err != nil {
+			return "", err
+		}
+		return stream.choice(list), nil
+	}
+}
+
+func fakeName(stream *keyedStream, locale string, _ []ref.Val) (string, error) {
+	first, err := words(locale, "first_names")
+	if err != nil {
+		return "", err
+	}
+	last, err := words(locale, "last_names")
+	if err != nil {
+		return "", err
+	}
+	return stream.choice(first) + " " + stream.choice(last), nil
+}
+
+// fakeCompany returns a last name with a company suffix, or two last names.
+func fakeCompany(stream *keyedStream, locale string, _ []ref.Val) (string, error) {
+	names, err := words(locale, "last_names")
+	if err != nil {
+		return "", err
+	}
+	suffixes, err := words(locale, "company_suffixes")
+	if err != nil {
+		return "", err
+	}
+	if stream.intn(3) == 0 {
+		return stream.choice(names) + " & " + stream.choice(names), nil
+	}
+	return stream.choice(names) + " " + stream.choice(suffixes), nil
+}
+
+// FAKE_MAX_SENTENCE_WORDS limits the number of words of fake.sentence().
+const FAKE_MAX_SENTENCE_WORDS = 1000
+
+// fakeSentence returns n words, the first one capitalized, ending with a period.
+func fakeSentence(stream *keyedStream, locale string, params []ref.Val) (string, error) {
+	n := int(params[0].(types.Int))
+	if n < 1 || n > FAKE_MAX_SENTENCE_WORDS {
+		return "", fmt.Errorf("number of words must be in 1..%d, got %d", FAKE_MAX_SENTENCE_WORDS, n)
+	}
+	list, err := words(locale, "words")
+	if err != nil {
+		return "", err
+	}
+
+	sentence := make([]string, n)
+	for i := range sentence {
+		sentence[i] = stream.choice(list)
+	}
+	first, size := utf8.DecodeRuneInString(sentence[0])
+	sentence[0] = string(unicode.ToUpper(first)) + sentence[0][size:]
+	return strings.Join(sentence, " ") + ".", nil
+}
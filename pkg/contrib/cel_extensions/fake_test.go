@@ -0,0 +1,134 @@
+package cel_extensions
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeFuncs(t *testing.T) {
+	table := map[string][]byte{"id": []byte("42")}
+
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, out string)
+	}{
+		{
+			name: "first_name",
+			expr: `fake.first_name(table.id)`,
+			check: func(t *testing.T, out string) {
+				assert.Contains(t, mustWords("en", "first_names"), out)
+			},
+		},
+		{
+			name: "first_name with locale",
+			expr: `fake.first_name(table.id, "de")`,
+			check: func(t *testing.T, out string) {
+				assert.Contains(t, mustWords("de", "first_names"), out)
+			},
+		},
+		{
+			name: "name",
+			expr: `fake.name(table.id, "fr")`,
+			check: func(t *testing.T, out string) {
+				first, last, ok := strings.Cut(out, " ")
+				require.True(t, ok, out)
+				assert.Contains(t, mustWords("fr", "first_names"), first)
+				assert.Contains(t, mustWords("fr", "last_names"), last)
+			},
+		},
+		{
+			name: "city",
+			expr: `fake.city(table.id)`,
+			check: func(t *testing.T, out string) {
+				assert.Contains(t, mustWords("en", "cities"), out)
+			},
+		},
+		{
+			name: "company",
+			expr: `fake.company(table.id, "de")`,
+			check: func(t *testing.T, out string) {
+				found := slices.ContainsFunc(mustWords("de", "last_names"), func(name string) bool {
+					return strings.HasPrefix(out, name+" ")
+				})
+				assert.True(t, found, out)
+			},
+		},
+		{
+			name: "sentence",
+			expr: `fake.sentence(table.id, 5)`,
+			check: func(t *testing.T, out string) {
+				require.True(t, strings.HasSuffix(out, "."), out)
+				words := strings.Fields(strings.TrimSuffix(out, "."))
+				assert.Len(t, words, 5)
+				assert.Equal(t, strings.ToUpper(out[:1]), out[:1])
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := evalString(t, tt.expr, table)
+			require.NoError(t, err)
+			tt.check(t, out)
+
+			again, err := evalString(t, tt.expr, table)
+			require.NoError(t, err)
+			assert.Equal(t, out, again)
+		})
+	}
+}
+
+func TestFakeFuncs_Seed(t *testing.T) {
+	table := map[string][]byte{"id": []byte("42")}
+
+	// GIVEN the same seed as bytes, string and int
+	var outs []string
+	for _, expr := range []string{
+		`fake.sentence(table.id, 8)`,
+		`fake.sentence("42", 8)`,
+		`fake.sentence(int(table.id), 8)`,
+	} {
+		out, err := evalString(t, expr, table)
+		require.NoError(t, err)
+		outs = append(outs, out)
+	}
+
+	// THEN the values are the same
+	assert.Equal(t, outs[0], outs[1])
+	assert.Equal(t, outs[0], outs[2])
+
+	// AND another seed gives another value
+	other, err := evalString(t, `fake.sentence(43, 8)`, table)
+	require.NoError(t, err)
+	assert.NotEqual(t, outs[0], other)
+}
+
+func TestFakeFuncs_Errors(t *testing.T) {
+	_, err := evalString(t, `fake.city(1, "xx")`, nil)
+	assert.ErrorContains(t, err, "no cities word list for locale xx")
+
+	_, err = evalString(t, `fake.sentence(1, 0)`, nil)
+	assert.ErrorContains(t, err, "number of words must be in 1..1000")
+}
+
+func TestWordlists_Locales(t *testing.T) {
+	// every locale has the lists of the default locale
+	entries, err := fs.ReadDir(wordlists, "wordlists/"+DEFAULT_LOCALE)
+	require.NoError(t, err)
+	locales, err := fs.ReadDir(wordlists, "wordlists")
+	require.NoError(t, err)
+
+	for _, locale := range locales {
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".txt")
+			list, err := words(locale.Name(), name)
+			require.NoError(t, err)
+			assert.NotEmpty(t, list, "%s/%s", locale.Name(), name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package cel_extensions
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+)
+
+// IntSetStorage is a storage building integer sets of its keys.
+type IntSetStorage interface {
+	GetIntSet(key string) (*storage.IntSet, error)
+}
+
+// GetIntSetFunc adds intset(), the integer set of a storage key:
+// `int(table.user_id) in intset("users")`.
+func GetIntSetFunc(store Storage) cel.EnvOption {
+	intSetStorage, supported := store.(IntSetStorage)
+	return cel.Function("intset",
+		cel.Overload("store_intset_strings",
+			[]*cel.Type{cel.StringType},
+			cel.AnyType,
+			cel.UnaryBinding(func(arg ref.Val) ref.Val {
+				key, ok := arg.(types.String)
+				if !ok {
+					return types.NewErr("intset() expects a single string argument")
+				}
+				if !supported {
+					return types.NewErr("intset() is not supported by the storage")
+				}
+
+				set, err := intSetStorage.GetIntSet(string(key))
+				if err != nil {
+					return types.NewErr("intset(%q): %v", string(key), err)
+				}
+				return &intSetVal{key: string(key), set: set}
+			}),
+		),
+	)
+}
+
+// bytesToIntFunc adds int(bytes), parsing the decimal text of a column
+// without converting it to a string first.
+func bytesToIntFunc() cel.EnvOption {
+	return cel.Function("int",
+		cel.Overload("bytes_to_int",
+			[]*cel.Type{cel.BytesType},
+			cel.IntType,
+			cel.UnaryBinding(func(arg ref.Val) ref.Val {
+				val, ok := arg.(types.Bytes)
+				if !ok {
+					return types.MaybeNoSuchOverloadErr(arg)
+				}
+				if string(val) == PG_NULL {
+					return types.NewErr("int() cannot convert NULL")
+				}
+				// strconv does not let the string escape, so the conversion does not allocate
+				parsed, err := strconv.ParseInt(string(val), 10, 64)
+				if err != nil {
+					return types.NewErr("int() cannot convert %q", string(val))
+				}
+				return types.Int(parsed)
+			}),
+		),
+	)
+}
+
+var intSetType = types.NewObjectType("chisel.IntSet", traits.ContainerType, traits.SizerType)
+
+// intSetVal is the value of intset(), it supports `in` with integers and size().
+type intSetVal struct {
+	key string
+	set *storage.IntSet
+}
+
+func (s *intSetVal) Contains(value ref.Val) ref.Val {
+	switch v := value.(type) {
+	case types.Int:
+		return types.Bool(s.set.Contains(int64(v)))
+	case types.Uint:
+		return types.Bool(v <= math.MaxInt64 && s.set.Contains(int64(v)))
+	}
+	return types.MaybeNoSuchOverloadErr(value)
+}
+
+func (s *intSetVal) Size() ref.Val {
+	return types.Int(s.set.Len())
+}
+
+func (s *intSetVal) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", intSetType, typeDesc)
+}
+
+func (s *intSetVal) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.TypeType {
+		return intSetType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", intSetType, typeVal)
+}
+
+func (s *intSetVal) Equal(other ref.Val) ref.Val {
+	o, ok := other.(*intSetVal)
+	return types.Bool(ok && o.set == s.set)
+}
+
+func (s *intSetVal) Type() ref.Type {
+	return intSetType
+}
+
+func (s *intSetVal) Value() any {
+	return s.set
+}
+
+func (s *intSetVal) String() string {
+	return fmt.Sprintf("intset(%q)", s.key)
+}
@@ -0,0 +1,128 @@
+package cel_extensions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage"
+	"github.com/zwergpro/pg-chisel/pkg/chisel/storage/mocks"
+)
+
+func evalIntSetExpr(
+	t *testing.T,
+	store Storage,
+	expr string,
+	table map[string][]byte,
+) (any, error) {
+	env, err := NewEnv(GetIntSetFunc(store))
+	require.NoError(t, err)
+	ast, issues := env.Compile(expr)
+	require.NoError(t, issues.Err())
+	prg, err := env.Program(ast)
+	require.NoError(t, err)
+
+	out, _, err := prg.Eval(map[string]interface{}{"table": table})
+	if err != nil {
+		return nil, err
+	}
+	return out.Value(), nil
+}
+
+func TestCustomFunctions_IntSet(t *testing.T) {
+	store, _ := storage.NewMapStringStorage(map[string][]string{
+		"users": {"1", "2", "-3"},
+		"names": {"alice"},
+	})
+
+	tests := []struct {
+		name     string
+		expr     string
+		table    map[string][]byte
+		expected any
+		err      string
+	}{
+		{
+			name:     "column in set",
+			expr:     `int(table.user_id) in intset("users")`,
+			table:    map[string][]byte{"user_id": []byte("2")},
+			expected: true,
+		},
+		{
+			name:     "negative column in set",
+			expr:     `int(table.user_id) in intset("users")`,
+			table:    map[string][]byte{"user_id": []byte("-3")},
+			expected: true,
+		},
+		{
+			name:     "column not in set",
+			expr:     `int(table.user_id) in intset("users")`,
+			table:    map[string][]byte{"user_id": []byte("4")},
+			expected: false,
+		},
+		{
+			name:     "size",
+			expr:     `size(intset("users"))`,
+			expected: int64(3),
+		},
+		{
+			name:     "missing key",
+			expr:     `1 in intset("missing")`,
+			expected: false,
+		},
+		{
+			name:  "NULL column",
+			expr:  `int(table.user_id) in intset("users")`,
+			table: map[string][]byte{"user_id": []byte(PG_NULL)},
+			err:   "int() cannot convert NULL",
+		},
+		{
+			name: "not integer key",
+			expr: `1 in intset("names")`,
+			err:  `value "alice" is not an integer`,
+		},
+		{
+			name: "string value",
+			expr: `"1" in intset("users")`,
+			err:  "no such overload",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := evalIntSetExpr(t, store, tt.expr, tt.table)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+func TestCustomFunctions_IntSet_NotSupported(t *testing.T) {
+	_, err := evalIntSetExpr(t, mocks.NewStorage(t), `1 in intset("users")`, nil)
+	assert.ErrorContains(t, err, "intset() is not supported by the storage")
+}
+
+func TestBytesToInt_NoAllocation(t *testing.T) {
+	store, _ := storage.NewMapStringStorage(map[string][]string{"users": {"1", "2"}})
+	env, err := NewEnv(GetIntSetFunc(store))
+	require.NoError(t, err)
+	ast, issues := env.Compile(`int(table.user_id) in intset("users")`)
+	require.NoError(t, issues.Err())
+	prg, err := env.Program(ast)
+	require.NoError(t, err)
+
+	input := map[string]interface{}{"table": map[string][]byte{"user_id": []byte("12345")}}
+	withIntSet := testing.AllocsPerRun(100, func() { _, _, _ = prg.Eval(input) })
+
+	ast, issues = env.Compile(`int(string(table.user_id)) in intset("users")`)
+	require.NoError(t, issues.Err())
+	prg, err = env.Program(ast)
+	require.NoError(t, err)
+	withString := testing.AllocsPerRun(100, func() { _, _, _ = prg.Eval(input) })
+
+	assert.Less(t, withIntSet, withString, "int(bytes) does not allocate a string")
+}
@@ -0,0 +1,175 @@
+package cel_extensions
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/google/cel-go/cel"
+)
+
+// maskFuncs adds the format-preserving masking functions. Like the pseudonymization
+// functions they are keyed by a secret, so a value is always masked the same way,
+// and the masked values still pass the validation of their format.
+func maskFuncs() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("mask_chars", keyedOverloads("mask_chars", false, maskChars)...),
+		cel.Function("mask_email", keyedOverloads("mask_email", false, maskEmail)...),
+		cel.Function("mask_card", keyedOverloads("mask_card", false, maskCard)...),
+		cel.Function("mask_iban", keyedOverloads("mask_iban", false, maskIban)...),
+	}
+}
+
+const (
+	upperLetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	lowerLetters = "abcdefghijklmnopqrstuvwxyz"
+	digits       = "0123456789"
+)
+
+// maskChars keeps the length and the character classes: letters are replaced with letters
+// of the same case, digits with digits, other characters are kept.
+func maskChars(secret []byte, value string) string {
+	return maskRunes(newKeyedStream(secret, "chars", value), value)
+}
+
+func maskRunes(stream *keyedStream, value string) string {
+	var out strings.Builder
+	out.Grow(len(value))
+	for _, r := range value {
+		switch {
+		case unicode.IsUpper(r):
+			out.WriteByte(upperLetters[stream.intn(len(upperLetters))])
+		case unicode.IsLetter(r):
+			out.WriteByte(lowerLetters[stream.intn(len(lowerLetters))])
+		case unicode.IsDigit(r):
+			out.WriteByte(digits[stream.intn(len(digits))])
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// maskEmail masks the local part of the email with maskChars, the domain is kept.
+// The local part is keyed case insensitively, its case is kept.
+func maskEmail(secret []byte, value string) string {
+	at := strings.LastIndexByte(value, '@')
+	if at < 0 {
+		return maskChars(secret, value)
+	}
+	local, domain := value[:at], value[at:]
+	return maskRunes(newKeyedStream(secret, "email", strings.ToLower(local)), local) + domain
+}
+
+// maskCard replaces the digits of the card number but the first one, which identifies
+// the card network, and sets the last one to the Luhn check digit. Separators are kept.
+func maskCard(secret []byte, value string) string {
+	stream := newKeyedStream(secret, "card", digitsOf(value))
+	out := []byte(value)
+	var positions []int
+	for i, c := range out {
+		if c >= '0' && c <= '9' {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) < 2 {
+		return value
+	}
+
+	for _, pos := range positions[1 : len(positions)-1] {
+		out[pos] = digits[stream.intn(len(digits))]
+	}
+	payload := make([]byte, 0, len(positions)-1)
+	for _, pos := range positions[:len(positions)-1] {
+		payload = append(payload, out[pos])
+	}
+	out[positions[len(positions)-1]] = luhnCheckDigit(payload)
+	return string(out)
+}
+
+// luhnCheckDigit returns the digit completing the payload to a valid Luhn number.
+func luhnCheckDigit(payload []byte) byte {
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		d := int(payload[i] - '0')
+		// the check digit is appended, so the rightmost payload digit is doubled
+		if (len(payload)-1-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func digitsOf(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+// maskIban keeps the country code, masks the account number (BBAN) keeping the character
+// classes and recomputes the check digits, so the masked IBAN passes the mod 97 check.
+// Spaces are kept. Values not shaped like an IBAN are masked with maskChars.
+func maskIban(secret []byte, value string) string {
+	compact := strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	if len(compact) < 5 || !isUpperLetter(compact[0]) || !isUpperLetter(compact[1]) {
+		return maskChars(secret, value)
+	}
+
+	stream := newKeyedStream(secret, "iban", compact)
+	out := []byte(strings.ToUpper(value))
+	var positions []int
+	for i, c := range out {
+		if c != ' ' {
+			positions = append(positions, i)
+		}
+	}
+	for _, pos := range positions[4:] {
+		switch c := out[pos]; {
+		case c >= '0' && c <= '9':
+			out[pos] = digits[stream.intn(len(digits))]
+		case isUpperLetter(c):
+			out[pos] = upperLetters[stream.intn(len(upperLetters))]
+		}
+	}
+
+	bban := make([]byte, 0, len(positions)-4)
+	for _, pos := range positions[4:] {
+		bban = append(bban, out[pos])
+	}
+	check := ibanCheckDigits(string(out[positions[0]])+string(out[positions[1]]), string(bban))
+	out[positions[2]], out[positions[3]] = check[0], check[1]
+	return string(out)
+}
+
+func isUpperLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+// ibanCheckDigits computes the ISO 7064 mod 97-10 check digits of the IBAN.
+func ibanCheckDigits(country, bban string) string {
+	remainder := ibanMod97(bban + country + "00")
+	check := 98 - remainder
+	return string([]byte{byte('0' + check/10), byte('0' + check%10)})
+}
+
+// ibanMod97 returns the remainder of the number made of the digits and the letters
+// converted to 10..35.
+func ibanMod97(value string) int {
+	remainder := 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case isUpperLetter(c):
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		}
+	}
+	return remainder
+}
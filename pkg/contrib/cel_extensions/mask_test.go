@@ -0,0 +1,121 @@
+package cel_extensions
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// luhnValid checks the Luhn checksum of the digits.
+func luhnValid(number string) bool {
+	number = digitsOf(number)
+	if len(number) < 2 {
+		return false
+	}
+	return luhnCheckDigit([]byte(number[:len(number)-1])) == number[len(number)-1]
+}
+
+// ibanValid checks the check digits of the IBAN.
+func ibanValid(iban string) bool {
+	compact := strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+	if len(compact) < 5 {
+		return false
+	}
+	return ibanMod97(compact[4:]+compact[:4]) == 1
+}
+
+func TestMaskFuncs(t *testing.T) {
+	t.Setenv("CHISEL_SECRET_DEFAULT", "default-key")
+	table := map[string][]byte{
+		"card":  []byte("4111 1111 1111 1111"),
+		"iban":  []byte("DE89 3704 0044 0532 0130 00"),
+		"email": []byte("John.Doe42@corp.example.org"),
+		"code":  []byte("AB-12cd"),
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		match string
+		check func(t *testing.T, out string)
+	}{
+		{
+			name:  "mask_chars",
+			expr:  `mask_chars(table.code)`,
+			match: `^[A-Z]{2}-\d{2}[a-z]{2}$`,
+		},
+		{
+			name:  "mask_email",
+			expr:  `mask_email(table.email)`,
+			match: `^[A-Z][a-z]{3}\.[A-Z][a-z]{2}\d{2}@corp\.example\.org$`,
+		},
+		{
+			name:  "mask_card",
+			expr:  `mask_card(table.card)`,
+			match: `^4\d{3} \d{4} \d{4} \d{4}$`,
+			check: func(t *testing.T, out string) {
+				assert.True(t, luhnValid(out), out)
+			},
+		},
+		{
+			name:  "mask_iban",
+			expr:  `mask_iban(table.iban)`,
+			match: `^DE\d{2} \d{4} \d{4} \d{4} \d{4} \d{2}$`,
+			check: func(t *testing.T, out string) {
+				assert.True(t, ibanValid(out), out)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := evalString(t, tt.expr, table)
+			require.NoError(t, err)
+			assert.Regexp(t, regexp.MustCompile(tt.match), out)
+			if tt.check != nil {
+				tt.check(t, out)
+			}
+
+			// masked deterministically, and with another secret differently
+			again, err := evalString(t, tt.expr, table)
+			require.NoError(t, err)
+			assert.Equal(t, out, again)
+			t.Setenv("CHISEL_SECRET_OTHER", "other-key")
+			other, err := evalString(t, strings.Replace(tt.expr, ")", `, "other")`, 1), table)
+			require.NoError(t, err)
+			assert.NotEqual(t, out, other)
+		})
+	}
+}
+
+func TestMaskCard_Luhn(t *testing.T) {
+	secret := []byte("key")
+	cards := []string{"4111111111111111", "5500-0000-0000-0004", "340000000000009", "79927398713"}
+	for _, card := range cards {
+		require.True(t, luhnValid(card), card)
+		masked := maskCard(secret, card)
+		assert.True(t, luhnValid(masked), masked)
+		assert.Len(t, masked, len(card))
+		assert.Equal(t, card[0], masked[0])
+	}
+	assert.Equal(t, "7", maskCard(secret, "7"), "too short to be masked")
+}
+
+func TestMaskIban_CheckDigits(t *testing.T) {
+	secret := []byte("key")
+	ibans := []string{
+		"GB82WEST12345698765432",
+		"FR14 2004 1010 0505 0001 3M02 606",
+		"NL91ABNA0417164300",
+	}
+	for _, iban := range ibans {
+		require.True(t, ibanValid(iban), iban)
+		masked := maskIban(secret, iban)
+		assert.True(t, ibanValid(masked), masked)
+		assert.Len(t, masked, len(iban))
+		assert.Equal(t, iban[:2], masked[:2])
+	}
+	assert.Regexp(t, `^\d{3}$`, maskIban(secret, "123"), "not shaped like an IBAN")
+}
@@ -0,0 +1,180 @@
+package cel_extensions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// PSEUDO_EMAIL_DOMAIN is the domain of the pseudonymized emails, reserved for examples.
+const PSEUDO_EMAIL_DOMAIN = "example.com"
+
+// pseudoFuncs adds the keyed pseudonymization functions. The same value is always mapped
+// to the same output with the same secret, so joins on pseudonymized columns keep working.
+// NULL is kept: the \N text of SQL NULL is mapped to CEL null.
+func pseudoFuncs() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("hmac_hex", keyedOverloads("hmac_hex", true, hmacHex)...),
+		cel.Function("pseudo_email", keyedOverloads("pseudo_email", false, pseudoEmail)...),
+		cel.Function("pseudo_name", keyedOverloads("pseudo_name", false, pseudoName)...),
+		cel.Function("pseudo_phone", keyedOverloads("pseudo_phone", false, pseudoPhone)...),
+	}
+}
+
+// keyedOverloads declares fn(value) with the default secret, unless the secret is required,
+// and fn(value, secret_name), for string and bytes values.
+func keyedOverloads(
+	name string,
+	secretRequired bool,
+	fn func(secret []byte, value string) string,
+) []cel.FunctionOpt {
+	call := func(value ref.Val, secretName ref.Val) ref.Val {
+		str, ok := valueString(value)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(value)
+		}
+		secretStr, ok := secretName.(types.String)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(secretName)
+		}
+		if str == PG_NULL {
+			return types.NullValue
+		}
+		secret, err := getSecret(string(secretStr))
+		if err != nil {
+			return types.NewErr("%s(): %v", name, err)
+		}
+		return types.String(fn(secret, str))
+	}
+
+	resultType := cel.NullableType(cel.StringType)
+	opts := []cel.FunctionOpt{
+		cel.Overload(name+"_string_secret",
+			[]*cel.Type{cel.StringType, cel.StringType}, resultType,
+			cel.BinaryBinding(call),
+		),
+		cel.Overload(name+"_bytes_secret",
+			[]*cel.Type{cel.BytesType, cel.StringType}, resultType,
+			cel.BinaryBinding(call),
+		),
+	}
+	if !secretRequired {
+		unary := func(value ref.Val) ref.Val {
+			return call(value, types.String(DEFAULT_SECRET))
+		}
+		opts = append(opts,
+			cel.Overload(name+"_string",
+				[]*cel.Type{cel.StringType}, resultType, cel.UnaryBinding(unary),
+			),
+			cel.Overload(name+"_bytes",
+				[]*cel.Type{cel.BytesType}, resultType, cel.UnaryBinding(unary),
+			),
+		)
+	}
+	return opts
+}
+
+// valueString returns the text of a string or bytes value.
+func valueString(val ref.Val) (string, bool) {
+	switch v := val.(type) {
+	case types.String:
+		return string(v), true
+	case types.Bytes:
+		return string(v), true
+	}
+	return "", false
+}
+
+func hmacHex(secret []byte, value string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pseudoEmail maps the email, case insensitively, to a user of PSEUDO_EMAIL_DOMAIN.
+func pseudoEmail(secret []byte, value string) string {
+	stream := newKeyedStream(secret, "email", strings.ToLower(strings.TrimSpace(value)))
+	return "user_" + hex.EncodeToString(stream.bytes(6)) + "@" + PSEUDO_EMAIL_DOMAIN
+}
+
+// pseudoName maps the value to a first and last name of the default locale.
+func pseudoName(secret []byte, value string) string {
+	stream := newKeyedStream(secret, "name", value)
+	first := stream.choice(mustWords(DEFAULT_LOCALE, "first_names"))
+	last := stream.choice(mustWords(DEFAULT_LOCALE, "last_names"))
+	return first + " " + last
+}
+
+// pseudoPhone replaces the digits of the phone number, its formatting is kept.
+func pseudoPhone(secret []byte, value string) string {
+	stream := newKeyedStream(secret, "phone", value)
+	out := []byte(value)
+	for i, c := range out {
+		if c >= '0' && c <= '9' {
+			out[i] = '0' + byte(stream.intn(10))
+		}
+	}
+	return string(out)
+}
+
+// keyedStream is a deterministic stream of bytes keyed by the secret: the HMAC-SHA256
+// blocks of the domain, the value and a counter. The domain separates the functions,
+// so the same value is mapped to unrelated outputs by different functions.
+type keyedStream struct {
+	secret  []byte
+	domain  string
+	value   string
+	counter uint32
+	block   []byte
+}
+
+func newKeyedStream(secret []byte, domain, value string) *keyedStream {
+	return &keyedStream{secret: secret, domain: domain, value: value}
+}
+
+func (s *keyedStream) next() byte {
+	if len(s.block) == 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(s.domain))
+		mac.Write([]byte{0})
+		mac.Write([]byte(s.value))
+		mac.Write(binary.BigEndian.AppendUint32(nil, s.counter))
+		s.block = mac.Sum(nil)
+		s.counter++
+	}
+	b := s.block[0]
+	s.block = s.block[1:]
+	return b
+}
+
+func (s *keyedStream) bytes(n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = s.next()
+	}
+	return out
+}
+
+func (s *keyedStream) uint64() uint64 {
+	return binary.BigEndian.Uint64(s.bytes(8))
+}
+
+// intn returns a uniform number in [0, n).
+func (s *keyedStream) intn(n int) int {
+	limit := ^uint64(0) - ^uint64(0)%uint64(n)
+	for {
+		if v := s.uint64(); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+func (s *keyedStream) choice(list []string) string {
+	return list[s.intn(len(list))]
+}
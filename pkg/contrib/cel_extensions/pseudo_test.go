@@ -0,0 +1,136 @@
+package cel_extensions
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// evalString evaluates the expression returning a string with the table of the row.
+func evalString(t *testing.T, expr string, table map[string][]byte) (string, error) {
+	env, err := NewEnv()
+	require.NoError(t, err)
+	ast, issues := env.Compile(expr)
+	require.NoError(t, issues.Err())
+	prg, err := env.Program(ast)
+	require.NoError(t, err)
+
+	out, _, err := prg.Eval(map[string]interface{}{"table": table})
+	if err != nil {
+		return "", err
+	}
+	return out.Value().(string), nil
+}
+
+func TestPseudoFuncs(t *testing.T) {
+	t.Setenv("CHISEL_SECRET_DEFAULT", "default-key")
+	t.Setenv("CHISEL_SECRET_USERS_KEY", "users-key")
+	table := map[string][]byte{
+		"email":   []byte("John.Doe@Corp.io"),
+		"phone":   []byte("+1 (415) 555-0199"),
+		"missing": []byte(PG_NULL),
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		match string
+	}{
+		{"hmac_hex", `hmac_hex(table.email, "users.key")`, `^[0-9a-f]{64}$`},
+		{"pseudo_email", `pseudo_email(table.email)`, `^user_[0-9a-f]{12}@example\.com$`},
+		{"pseudo_name", `pseudo_name("john")`, `^[A-Z][a-z]+ [A-Z][a-z]+$`},
+		{"pseudo_phone", `pseudo_phone(table.phone)`, `^\+\d \(\d{3}\) \d{3}-\d{4}$`},
+		{"NULL is kept", `pseudo_email(table.missing) == null ? "null" : "text"`, `^null$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := evalString(t, tt.expr, table)
+			require.NoError(t, err)
+			assert.Regexp(t, regexp.MustCompile(tt.match), out)
+		})
+	}
+}
+
+func TestPseudoFuncs_Deterministic(t *testing.T) {
+	t.Setenv("CHISEL_SECRET_DEFAULT", "default-key")
+	t.Setenv("CHISEL_SECRET_OTHER", "other-key")
+
+	// The same value is mapped to the same output, whatever its type or case for emails.
+	first, err := evalString(t, `pseudo_email(table.email)`,
+		map[string][]byte{"email": []byte("a@b.io")})
+	require.NoError(t, err)
+	second, err := evalString(t, `pseudo_email(" A@B.io")`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	// Another secret or another value gives another output.
+	other, err := evalString(t, `pseudo_email("a@b.io", "other")`, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+	other, err = evalString(t, `pseudo_email("c@b.io")`, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+
+	expected := hmacHex([]byte("other-key"), "value")
+	out, err := evalString(t, `hmac_hex(b"value", "other")`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, out)
+}
+
+func TestPseudoFuncs_MissingSecret(t *testing.T) {
+	_, err := evalString(t, `hmac_hex("value", "missing-secret")`, nil)
+	assert.ErrorContains(t, err,
+		`secret "missing-secret" is not set: set CHISEL_SECRET_MISSING_SECRET`)
+}
+
+func TestCheckSecrets(t *testing.T) {
+	t.Setenv("CHISEL_SECRET_USERS", "users-key")
+	t.Setenv("CHISEL_SECRET_DEFAULT", "")
+	secrets.mu.Lock()
+	clear(secrets.resolved)
+	secrets.mu.Unlock()
+
+	env, err := NewEnv()
+	require.NoError(t, err)
+	check := func(expr string) error {
+		checked, issues := env.Compile(expr)
+		require.NoError(t, issues.Err())
+		return CheckSecrets(checked)
+	}
+
+	// GIVEN: Expressions whose secrets are set or computed from the row.
+	assert.NoError(t, check(`hmac_hex(table.email, "users") + "x"`))
+	assert.NoError(t, check(`pseudo_email(table.email, string(table.secret))`))
+	assert.NoError(t, check(`string(table.id)`))
+
+	// THEN: A missing secret, named or default, fails before any row is evaluated.
+	err = check(`pseudo_email(table.email) + mask_card(table.card, "cards")`)
+	assert.ErrorContains(t, err, `pseudo_email(): secret "default" is not set`)
+	assert.ErrorContains(t, err, `mask_card(): secret "cards" is not set`)
+	err = check(`shift_date(table.birth_date, table.id, "-30d..30d")`)
+	assert.ErrorContains(t, err, `shift_date(): secret "default" is not set`)
+	assert.NoError(t, check(`shift_date(table.birth_date, table.id, "-30d..30d", "users")`))
+}
+
+func TestLoadSecretsFile(t *testing.T) {
+	// GIVEN: A secrets file.
+	fname := filepath.Join(t.TempDir(), "secrets")
+	content := strings.Join([]string{"# pseudonymization keys", "", "file_key = from-file", ""}, "\n")
+	require.NoError(t, os.WriteFile(fname, []byte(content), 0o600))
+
+	// WHEN: It is loaded.
+	require.NoError(t, LoadSecretsFile(fname))
+	out, err := evalString(t, `hmac_hex("value", "file_key")`, nil)
+
+	// THEN: Its secrets are used by the keyed functions.
+	require.NoError(t, err)
+	assert.Equal(t, hmacHex([]byte("from-file"), "value"), out)
+
+	require.NoError(t, os.WriteFile(fname, []byte("no separator\n"), 0o600))
+	assert.ErrorContains(t, LoadSecretsFile(fname), "line 1: expected name=value")
+}
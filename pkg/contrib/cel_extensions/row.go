@@ -0,0 +1,228 @@
+package cel_extensions
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+const ROW_VAR = "row"
+
+// RowColumn describes a table column exposed in the typed row view.
+type RowColumn struct {
+	// Name of the column as it is written in the COPY statement.
+	Name string
+	// PostgreSQL type of the column, the column is exposed as a string if it is empty.
+	Type    string
+	NotNull bool
+}
+
+// RowSchema exposes the columns of a table to CEL as typed `row.<column>` variables.
+// NULL values are exposed as CEL null, so nullable columns are declared as nullable types.
+type RowSchema struct {
+	columns []rowColumn
+}
+
+type rowColumn struct {
+	name    string
+	varName string
+	celType *cel.Type
+	parse   func(val []byte) (ref.Val, error)
+}
+
+var (
+	identRe        = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+	reservedIdents = map[string]struct{}{
+		"as": {}, "break": {}, "const": {}, "continue": {}, "else": {}, "false": {}, "for": {},
+		"function": {}, "if": {}, "import": {}, "in": {}, "let": {}, "loop": {}, "package": {},
+		"namespace": {}, "null": {}, "return": {}, "true": {}, "var": {}, "void": {},
+	}
+)
+
+func NewRowSchema(columns []RowColumn) *RowSchema {
+	schema := RowSchema{columns: make([]rowColumn, 0, len(columns))}
+	for _, column := range columns {
+		ident := unquoteIdent(column.Name)
+		if _, reserved := reservedIdents[ident]; reserved || !identRe.MatchString(ident) {
+			log.Printf("[DEBUG] Column %s is only available in table", column.Name)
+			continue
+		}
+
+		celType, parse := pgColumnType(column.Type)
+		if !column.NotNull {
+			celType = cel.NullableType(celType)
+		}
+		schema.columns = append(schema.columns, rowColumn{
+			name:    column.Name,
+			varName: ROW_VAR + "." + ident,
+			celType: celType,
+			parse:   parse,
+		})
+	}
+	return &schema
+}
+
+// EnvOptions declares the row variables.
+func (s *RowSchema) EnvOptions() []cel.EnvOption {
+	opts := make([]cel.EnvOption, 0, len(s.columns))
+	for _, column := range s.columns {
+		opts = append(opts, cel.Variable(column.varName, column.celType))
+	}
+	return opts
+}
+
+// Referenced returns the schema of the columns read by the checked expression,
+// so the other columns are not bound.
+func (s *RowSchema) Referenced(ast *cel.Ast) *RowSchema {
+	names := make(map[string]struct{})
+	for _, ref := range ast.NativeRep().ReferenceMap() {
+		names[ref.Name] = struct{}{}
+	}
+
+	referenced := RowSchema{}
+	for _, column := range s.columns {
+		if _, ok := names[column.varName]; ok {
+			referenced.columns = append(referenced.columns, column)
+		}
+	}
+	return &referenced
+}
+
+// Bind adds the typed values of the record columns to the CEL input. The values are parsed
+// lazily, when the expression reads them, so a value which can not be parsed is an error
+// of the expression reading it.
+func (s *RowSchema) Bind(
+	input map[string]any,
+	vals map[string][]byte,
+	isNull func(col string) bool,
+) error {
+	for _, column := range s.columns {
+		val, ok := vals[column.name]
+		if !ok {
+			return fmt.Errorf("can not find column %s", column.name)
+		}
+		if isNull(column.name) {
+			input[column.varName] = types.NullValue
+			continue
+		}
+
+		input[column.varName] = func() ref.Val {
+			value, err := column.parse(val)
+			if err != nil {
+				return types.NewErr("can not parse column %s: %v", column.name, err)
+			}
+			return value
+		}
+	}
+	return nil
+}
+
+// pgColumnType maps the PostgreSQL column type to the CEL type and the parser of its text format.
+func pgColumnType(pgType string) (*cel.Type, func([]byte) (ref.Val, error)) {
+	if strings.HasSuffix(pgType, "]") {
+		return cel.StringType, parseString
+	}
+
+	// drop type modifiers, e.g. "timestamp(3) with time zone"
+	base := pgType
+	if start := strings.IndexByte(base, '('); start != -1 {
+		if end := strings.IndexByte(base[start:], ')'); end != -1 {
+			base = base[:start] + base[start+end+1:]
+		}
+	}
+
+	switch base {
+	case "smallint", "integer", "bigint":
+		return cel.IntType, parseInt
+	case "real", "double precision":
+		return cel.DoubleType, parseDouble
+	case "boolean":
+		return cel.BoolType, parseBool
+	case "timestamp with time zone", "timestamp without time zone", "timestamp", "date":
+		return cel.TimestampType, parseTimestamp
+	case "bytea":
+		return cel.BytesType, parseBytea
+	default:
+		return cel.StringType, parseString
+	}
+}
+
+func parseString(val []byte) (ref.Val, error) {
+	return types.String(val), nil
+}
+
+func parseInt(val []byte) (ref.Val, error) {
+	i, err := strconv.ParseInt(string(val), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return types.Int(i), nil
+}
+
+func parseDouble(val []byte) (ref.Val, error) {
+	f, err := strconv.ParseFloat(string(val), 64)
+	if err != nil {
+		return nil, err
+	}
+	return types.Double(f), nil
+}
+
+func parseBool(val []byte) (ref.Val, error) {
+	switch string(val) {
+	case "t":
+		return types.True, nil
+	case "f":
+		return types.False, nil
+	default:
+		return nil, fmt.Errorf("invalid boolean: %q", val)
+	}
+}
+
+var (
+	maxTimestamp = time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+	minTimestamp = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// parseTimestamp parses timestamps and dates in the ISO DateStyle used by pg_dump,
+// see parsePgDateTime.
+func parseTimestamp(val []byte) (ref.Val, error) {
+	switch string(val) {
+	case "infinity":
+		return types.Timestamp{Time: maxTimestamp}, nil
+	case "-infinity":
+		return types.Timestamp{Time: minTimestamp}, nil
+	}
+
+	t, err := parsePgDateTime(string(val))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %q", val)
+	}
+	return types.Timestamp{Time: t.Instant()}, nil
+}
+
+// parseBytea decodes the hex format of bytea, values in the escape format are kept as is.
+func parseBytea(val []byte) (ref.Val, error) {
+	if len(val) < 2 || val[0] != '\\' || val[1] != 'x' {
+		return types.Bytes(val), nil
+	}
+	b, err := hex.DecodeString(string(val[2:]))
+	if err != nil {
+		return nil, err
+	}
+	return types.Bytes(b), nil
+}
+
+func unquoteIdent(ident string) string {
+	if len(ident) >= 2 && ident[0] == '"' && ident[len(ident)-1] == '"' {
+		return strings.ReplaceAll(ident[1:len(ident)-1], `""`, `"`)
+	}
+	return ident
+}
@@ -0,0 +1,197 @@
+package cel_extensions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRowColumns = []RowColumn{
+	{Name: "id", Type: "bigint", NotNull: true},
+	{Name: "profile_id", Type: "integer"},
+	{Name: "price", Type: "numeric(10,2)"},
+	{Name: "active", Type: "boolean", NotNull: true},
+	{Name: "created_at", Type: "timestamp with time zone"},
+	{Name: "birthday", Type: "date"},
+	{Name: "data", Type: "bytea"},
+	{Name: "tags", Type: "integer[]"},
+	{Name: `"Name"`, Type: "text"},
+	{Name: "comment"},
+	{Name: "in", Type: "text"},
+}
+
+func evalRow(t *testing.T, expr string, vals map[string]string, nulls ...string) (any, error) {
+	schema := NewRowSchema(testRowColumns)
+	env, err := NewEnv(schema.EnvOptions()...)
+	require.NoError(t, err)
+
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	prg, err := env.Program(ast)
+	require.NoError(t, err)
+
+	table := make(map[string][]byte)
+	for _, column := range testRowColumns {
+		table[column.Name] = []byte(vals[column.Name])
+	}
+	isNull := func(col string) bool {
+		for _, null := range nulls {
+			if null == col {
+				return true
+			}
+		}
+		return false
+	}
+
+	input := map[string]any{"table": table}
+	if err := schema.Bind(input, table, isNull); err != nil {
+		return nil, err
+	}
+	out, _, err := prg.Eval(input)
+	if err != nil {
+		return nil, err
+	}
+	return out.Value(), nil
+}
+
+func testRowVals() map[string]string {
+	return map[string]string{
+		"id":         "42",
+		"profile_id": "3",
+		"price":      "10.50",
+		"active":     "t",
+		"created_at": "2024-01-02 03:04:05.123456+03",
+		"birthday":   "1990-05-06",
+		"data":       `\x414243`,
+		"tags":       "{1,2}",
+		`"Name"`:     "Bob",
+		"comment":    "hello",
+		"in":         "x",
+	}
+}
+
+func TestRowSchema_TypedAccess(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected any
+	}{
+		{`row.id == 42`, true},
+		{`row.profile_id > 2`, true},
+		{`row.price == "10.50"`, true},
+		{`row.active`, true},
+		{`row.created_at == timestamp("2024-01-02T00:04:05.123456Z")`, true},
+		{`row.birthday < timestamp("2000-01-01T00:00:00Z")`, true},
+		{`row.data == b"ABC"`, true},
+		{`row.tags`, "{1,2}"},
+		{`row.Name + " " + row.comment`, "Bob hello"},
+		{`string(table.id) == "42"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			out, err := evalRow(t, tt.expr, testRowVals())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+func TestRowSchema_Null(t *testing.T) {
+	out, err := evalRow(t, `row.profile_id == null && row.created_at == null`, testRowVals(),
+		"profile_id", "created_at")
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	out, err = evalRow(t, `row.profile_id == null`, testRowVals())
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+}
+
+func TestRowSchema_TypeErrors(t *testing.T) {
+	for _, expr := range []string{
+		`row.id == "42"`,
+		`row.active > 1`,
+		`row.profile_id + "x" == "y"`,
+		`row.unknown == 1`,
+		`row.in == "x"`,
+	} {
+		_, err := evalRow(t, expr, testRowVals())
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestRowSchema_InvalidValue(t *testing.T) {
+	vals := testRowVals()
+	vals["id"] = "abc"
+
+	_, err := evalRow(t, `row.id == 1`, vals)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can not parse column id")
+
+	// a value which can not be parsed is only an error when it is read
+	out, err := evalRow(t, `row.profile_id == 3 && string(table.id) == "abc"`, vals)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+}
+
+func TestRowSchema_Referenced(t *testing.T) {
+	schema := NewRowSchema(testRowColumns)
+	env, err := NewEnv(schema.EnvOptions()...)
+	require.NoError(t, err)
+	ast, issues := env.Compile(`row.id > 1 && row.Name != "" && string(table.price) != ""`)
+	require.NoError(t, issues.Err())
+
+	var names []string
+	for _, column := range schema.Referenced(ast).columns {
+		names = append(names, column.name)
+	}
+	assert.Equal(t, []string{"id", `"Name"`}, names)
+}
+
+func TestRowSchema_NumericPrecision(t *testing.T) {
+	// numeric is exposed as a string, a double would round the value
+	vals := testRowVals()
+	vals["price"] = "12345678901234567890.12"
+
+	out, err := evalRow(t, `row.price`, vals)
+	require.NoError(t, err)
+	assert.Equal(t, "12345678901234567890.12", out)
+
+	out, err = evalRow(t, `double(row.price) > 1e19`, vals)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		val      string
+		expected time.Time
+	}{
+		{"2024-01-02 03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02 03:04:05.5", time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC)},
+		{"2024-01-02 03:04:05+00", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02 03:04:05+05:30", time.Date(2024, 1, 1, 21, 34, 5, 0, time.UTC)},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-02 BC", time.Date(-2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0044-03-15 12:00:00+01 BC", time.Date(-43, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"10000-01-01", time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"infinity", maxTimestamp},
+		{"-infinity", minTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			val, err := parseTimestamp([]byte(tt.val))
+			require.NoError(t, err)
+			assert.True(t, tt.expected.Equal(val.(types.Timestamp).Time), "got %v", val)
+		})
+	}
+
+	_, err := parseTimestamp([]byte("2024-13-02"))
+	assert.Error(t, err)
+}
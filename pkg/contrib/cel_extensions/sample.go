@@ -0,0 +1,59 @@
+package cel_extensions
+
+import (
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// SampleFuncs adds sample(key, rate) and sample_seeded(key, rate, seed), which are true for
+// the given fraction of the keys. The key is hashed into [0, 1), so the same keys are sampled
+// in every run and in every table: sample(table.id, 0.05) on users and
+// sample(table.user_id, 0.05) on orders keep the orders of the sampled users.
+// sample(key, rate) is sample_seeded(key, rate, "").
+func SampleFuncs() []cel.EnvOption {
+	seeded := func(args ...ref.Val) ref.Val {
+		key, ok := seedString(args[0])
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(args[0])
+		}
+		rate, ok := args[1].(types.Double)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(args[1])
+		}
+		seed, ok := args[2].(types.String)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(args[2])
+		}
+		if rate < 0 || rate > 1 {
+			return types.NewErr("sample(): rate must be in [0, 1], got %v", float64(rate))
+		}
+		return types.Bool(sampleHash(string(seed), key) < float64(rate))
+	}
+	unseeded := func(key, rate ref.Val) ref.Val {
+		return seeded(key, rate, types.String(""))
+	}
+
+	var sampleOpts, seededOpts []cel.FunctionOpt
+	for _, keyType := range []*cel.Type{cel.StringType, cel.BytesType, cel.IntType} {
+		sampleOpts = append(sampleOpts, cel.Overload("sample_"+keyType.String()+"_double",
+			[]*cel.Type{keyType, cel.DoubleType}, cel.BoolType,
+			cel.BinaryBinding(unseeded),
+		))
+		seededOpts = append(seededOpts, cel.Overload("sample_seeded_"+keyType.String()+"_double",
+			[]*cel.Type{keyType, cel.DoubleType, cel.StringType}, cel.BoolType,
+			cel.FunctionBinding(seeded),
+		))
+	}
+	return []cel.EnvOption{
+		cel.Function("sample", sampleOpts...),
+		cel.Function("sample_seeded", seededOpts...),
+	}
+}
+
+// sampleHash maps the key to [0, 1) with the HMAC of the seed, which is stable across runs.
+func sampleHash(seed, key string) float64 {
+	v := newKeyedStream([]byte(seed), "sample", key).uint64()
+	// the 53 high bits fill the mantissa of the float
+	return float64(v>>11) / (1 << 53)
+}
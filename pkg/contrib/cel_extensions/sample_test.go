@@ -0,0 +1,97 @@
+package cel_extensions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compileSample(t *testing.T, expr string) cel.Program {
+	env, err := NewEnv(SampleFuncs()...)
+	require.NoError(t, err)
+	ast, issues := env.Compile(expr)
+	require.NoError(t, issues.Err())
+	prg, err := env.Program(ast)
+	require.NoError(t, err)
+	return prg
+}
+
+func evalSample(t *testing.T, prg cel.Program, id string) (bool, error) {
+	out, _, err := prg.Eval(map[string]interface{}{
+		"table": map[string][]byte{"id": []byte(id)},
+	})
+	if err != nil {
+		return false, err
+	}
+	return out.Value().(bool), nil
+}
+
+func TestSampleFuncs_Rate(t *testing.T) {
+	prg := compileSample(t, `sample(table.id, 0.05)`)
+
+	// GIVEN 20000 keys
+	sampled := 0
+	for i := range 20000 {
+		ok, err := evalSample(t, prg, fmt.Sprint(i))
+		require.NoError(t, err)
+		if ok {
+			sampled++
+		}
+	}
+
+	// THEN about 5% of them are sampled
+	assert.InDelta(t, 1000, sampled, 150)
+}
+
+func TestSampleFuncs_Stable(t *testing.T) {
+	// the same keys are sampled whatever the type of the key
+	bytesPrg := compileSample(t, `sample(table.id, 0.3)`)
+	intPrg := compileSample(t, `sample(int(table.id), 0.3)`)
+	seededPrg := compileSample(t, `sample_seeded(table.id, 0.3, "")`)
+	otherSeedPrg := compileSample(t, `sample_seeded(table.id, 0.3, "orders")`)
+	widerPrg := compileSample(t, `sample(table.id, 0.6)`)
+
+	differs := false
+	for i := range 200 {
+		id := fmt.Sprint(i)
+		expected, err := evalSample(t, bytesPrg, id)
+		require.NoError(t, err)
+
+		for _, prg := range []cel.Program{intPrg, seededPrg} {
+			ok, err := evalSample(t, prg, id)
+			require.NoError(t, err)
+			assert.Equal(t, expected, ok, id)
+		}
+
+		// a larger rate keeps the sampled keys
+		wider, err := evalSample(t, widerPrg, id)
+		require.NoError(t, err)
+		assert.True(t, !expected || wider, id)
+
+		other, err := evalSample(t, otherSeedPrg, id)
+		require.NoError(t, err)
+		differs = differs || other != expected
+	}
+	assert.True(t, differs, "another seed samples other keys")
+}
+
+func TestSampleFuncs_Bounds(t *testing.T) {
+	for _, tt := range []struct {
+		expr     string
+		expected bool
+	}{
+		{`sample(table.id, 0.0)`, false},
+		{`sample(table.id, 1.0)`, true},
+		{`sample_seeded("user-1", 1.0, "x")`, true},
+	} {
+		ok, err := evalSample(t, compileSample(t, tt.expr), "1")
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, ok, tt.expr)
+	}
+
+	_, err := evalSample(t, compileSample(t, `sample(table.id, 1.5)`), "1")
+	assert.ErrorContains(t, err, "rate must be in [0, 1]")
+}
@@ -0,0 +1,162 @@
+package cel_extensions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+)
+
+// SECRET_ENV_PREFIX prefixes the environment variables of the secrets:
+// the secret "users" is read from CHISEL_SECRET_USERS.
+const SECRET_ENV_PREFIX = "CHISEL_SECRET_"
+
+// DEFAULT_SECRET is the secret of the pseudonymization functions called without a secret name.
+const DEFAULT_SECRET = "default"
+
+// secrets resolves the secrets of the keyed functions. They are never read from the config,
+// so a chisel.yml can be shared without the keys of the pseudonymized values.
+var secrets = struct {
+	mu       sync.RWMutex
+	file     map[string][]byte // secrets of the secrets file
+	resolved map[string][]byte
+}{resolved: make(map[string][]byte)}
+
+// LoadSecretsFile reads the secrets file, made of `name=value` lines.
+// Empty lines and lines starting with # are skipped.
+func LoadSecretsFile(fname string) error {
+	file, err := os.Open(fname)
+	if err != nil {
+		return fmt.Errorf("cannot open secrets file: %w", err)
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Mode().Perm()&0o077 != 0 {
+		log.Printf("[WARN] Secrets file %s is accessible by other users", fname)
+	}
+
+	values := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("secrets file line %d: expected name=value", lineNo)
+		}
+		values[strings.TrimSpace(name)] = []byte(strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read secrets file: %w", err)
+	}
+
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	secrets.file = values
+	clear(secrets.resolved)
+	log.Printf("[DEBUG] %d secrets are loaded from %s", len(values), fname)
+	return nil
+}
+
+// getSecret returns the secret from its environment variable, or from the secrets file.
+func getSecret(name string) ([]byte, error) {
+	secrets.mu.RLock()
+	secret, ok := secrets.resolved[name]
+	secrets.mu.RUnlock()
+	if ok {
+		return secret, nil
+	}
+
+	envName := secretEnvName(name)
+	if value := os.Getenv(envName); value != "" {
+		secret = []byte(value)
+	} else {
+		secrets.mu.RLock()
+		secret = secrets.file[name]
+		secrets.mu.RUnlock()
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf(
+			"secret %q is not set: set %s or add it to the secrets file", name, envName,
+		)
+	}
+
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	secrets.resolved[name] = secret
+	return secret, nil
+}
+
+// secretArgs are the positions of the secret name argument of the keyed functions,
+// the functions called without it use DEFAULT_SECRET.
+var secretArgs = map[string]int{
+	"hmac_hex":     1,
+	"pseudo_email": 1,
+	"pseudo_name":  1,
+	"pseudo_phone": 1,
+	"mask_chars":   1,
+	"mask_email":   1,
+	"mask_card":    1,
+	"mask_iban":    1,
+	"shift_date":   3,
+}
+
+// CheckSecrets resolves the secrets of the keyed functions called by the checked expression,
+// so a missing secret fails when the tasks are built rather than in the middle of a run.
+// Secret names which are not constant are resolved when the rows are evaluated.
+func CheckSecrets(checked *cel.Ast) error {
+	var errs []error
+	seen := make(map[string]bool)
+	ast.PreOrderVisit(checked.NativeRep().Expr(), ast.NewExprVisitor(func(e ast.Expr) {
+		if e.Kind() != ast.CallKind {
+			return
+		}
+		call := e.AsCall()
+		position, ok := secretArgs[call.FunctionName()]
+		if !ok {
+			return
+		}
+		name := DEFAULT_SECRET
+		if args := call.Args(); position < len(args) {
+			if args[position].Kind() != ast.LiteralKind {
+				return
+			}
+			literal, ok := args[position].AsLiteral().(types.String)
+			if !ok {
+				return
+			}
+			name = string(literal)
+		}
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		if _, err := getSecret(name); err != nil {
+			errs = append(errs, fmt.Errorf("%s(): %w", call.FunctionName(), err))
+		}
+	}))
+	return errors.Join(errs...)
+}
+
+// secretEnvName returns the environment variable of the secret.
+func secretEnvName(name string) string {
+	envName := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	return SECRET_ENV_PREFIX + envName
+}
@@ -0,0 +1,194 @@
+package cel_extensions
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// SetStorage is a storage answering membership queries itself, like the disk storage,
+// set() and array() do not load the values of its keys in memory.
+type SetStorage interface {
+	Storage
+	Contains(key, value string) (bool, error)
+	Size(key string) (values, distinct int)
+	Values(key string) ([]string, error)
+}
+
+var storageSetType = types.NewObjectType("chisel.Set", traits.ContainerType, traits.SizerType)
+
+// storageSet is the value of set() for a SetStorage, it supports `in` and size().
+type storageSet struct {
+	storage SetStorage
+	key     string
+}
+
+func (s *storageSet) Contains(value ref.Val) ref.Val {
+	str, ok := value.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(value)
+	}
+	found, err := s.storage.Contains(s.key, string(str))
+	if err != nil {
+		return types.NewErr("set(%q): %v", s.key, err)
+	}
+	return types.Bool(found)
+}
+
+func (s *storageSet) Size() ref.Val {
+	_, distinct := s.storage.Size(s.key)
+	return types.Int(distinct)
+}
+
+// ConvertToNative loads the whole set.
+func (s *storageSet) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	values, err := s.storage.Values(s.key)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return types.DefaultTypeAdapter.NativeToValue(set).ConvertToNative(typeDesc)
+}
+
+func (s *storageSet) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.TypeType {
+		return storageSetType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", storageSetType, typeVal)
+}
+
+func (s *storageSet) Equal(other ref.Val) ref.Val {
+	o, ok := other.(*storageSet)
+	return types.Bool(ok && o.storage == s.storage && o.key == s.key)
+}
+
+func (s *storageSet) Type() ref.Type {
+	return storageSetType
+}
+
+// Value loads the whole set.
+func (s *storageSet) Value() any {
+	return s.storage.GetSet(s.key)
+}
+
+func (s *storageSet) String() string {
+	return fmt.Sprintf("set(%q)", s.key)
+}
+
+var storageArrayType = types.NewObjectType(
+	"chisel.Array",
+	traits.ContainerType, traits.SizerType, traits.IterableType, traits.IndexerType,
+)
+
+// storageArray is the value of array() for a SetStorage, `in` and size() are answered by
+// the storage, iterating or indexing the array reads its values.
+type storageArray struct {
+	storage SetStorage
+	key     string
+}
+
+func (a *storageArray) Contains(value ref.Val) ref.Val {
+	str, ok := value.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(value)
+	}
+	found, err := a.storage.Contains(a.key, string(str))
+	if err != nil {
+		return types.NewErr("array(%q): %v", a.key, err)
+	}
+	return types.Bool(found)
+}
+
+func (a *storageArray) Size() ref.Val {
+	values, _ := a.storage.Size(a.key)
+	return types.Int(values)
+}
+
+// list reads the values of the key.
+func (a *storageArray) list() ref.Val {
+	values, err := a.storage.Values(a.key)
+	if err != nil {
+		return types.NewErr("array(%q): %v", a.key, err)
+	}
+	return types.NewStringList(types.DefaultTypeAdapter, values)
+}
+
+func (a *storageArray) Iterator() traits.Iterator {
+	list := a.list()
+	if types.IsError(list) {
+		return &errIterator{err: list}
+	}
+	return list.(traits.Lister).Iterator()
+}
+
+func (a *storageArray) Get(index ref.Val) ref.Val {
+	list := a.list()
+	if types.IsError(list) {
+		return list
+	}
+	return list.(traits.Lister).Get(index)
+}
+
+func (a *storageArray) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	values, err := a.storage.Values(a.key)
+	if err != nil {
+		return nil, err
+	}
+	return types.DefaultTypeAdapter.NativeToValue(values).ConvertToNative(typeDesc)
+}
+
+func (a *storageArray) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.TypeType {
+		return storageArrayType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", storageArrayType, typeVal)
+}
+
+func (a *storageArray) Equal(other ref.Val) ref.Val {
+	o, ok := other.(*storageArray)
+	return types.Bool(ok && o.storage == a.storage && o.key == a.key)
+}
+
+func (a *storageArray) Type() ref.Type {
+	return storageArrayType
+}
+
+// Value loads the values, a read error is only logged by the storage.
+func (a *storageArray) Value() any {
+	return a.storage.Get(a.key)
+}
+
+func (a *storageArray) String() string {
+	return fmt.Sprintf("array(%q)", a.key)
+}
+
+// errIterator fails the comprehension over a key which can not be read: a comprehension
+// stops silently on an error of HasNext, so the error is its single element.
+type errIterator struct {
+	err  ref.Val
+	done bool
+}
+
+func (it *errIterator) HasNext() ref.Val {
+	return types.Bool(!it.done)
+}
+
+func (it *errIterator) Next() ref.Val {
+	it.done = true
+	return it.err
+}
+
+func (it *errIterator) ConvertToNative(reflect.Type) (any, error) {
+	return nil, fmt.Errorf("%v", it.err)
+}
+
+func (it *errIterator) ConvertToType(ref.Type) ref.Val { return it.err }
+func (it *errIterator) Equal(ref.Val) ref.Val          { return it.err }
+func (it *errIterator) Type() ref.Type                 { return types.IteratorType }
+func (it *errIterator) Value() any                     { return it.err.Value() }
@@ -0,0 +1,283 @@
+package cel_extensions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// shiftFuncs adds shift_date(value, entity, range[, secret_name]), which shifts a date or
+// a timestamp by an offset of the range, e.g. "-30d..30d". The offset is keyed by the entity,
+// so every date of the entity is shifted by the same offset and their order is kept.
+// The value is written back in the text format it was read in. NULL is kept as CEL null.
+func shiftFuncs() []cel.EnvOption {
+	binding := func(args ...ref.Val) ref.Val {
+		value, ok := valueString(args[0])
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(args[0])
+		}
+		entity, ok := seedString(args[1])
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(args[1])
+		}
+		rangeStr, ok := args[2].(types.String)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(args[2])
+		}
+		secretName := types.String(DEFAULT_SECRET)
+		if len(args) > 3 {
+			if secretName, ok = args[3].(types.String); !ok {
+				return types.MaybeNoSuchOverloadErr(args[3])
+			}
+		}
+		if value == PG_NULL {
+			return types.NullValue
+		}
+
+		secret, err := getSecret(string(secretName))
+		if err != nil {
+			return types.NewErr("shift_date(): %v", err)
+		}
+		out, err := shiftDate(secret, value, entity, string(rangeStr))
+		if err != nil {
+			return types.NewErr("shift_date(): %v", err)
+		}
+		return types.String(out)
+	}
+
+	resultType := cel.NullableType(cel.StringType)
+	var opts []cel.FunctionOpt
+	for _, valueType := range []*cel.Type{cel.StringType, cel.BytesType} {
+		for _, entityType := range []*cel.Type{cel.StringType, cel.BytesType, cel.IntType} {
+			argTypes := []*cel.Type{valueType, entityType, cel.StringType}
+			overloadName := "shift_date_" + valueType.String() + "_" + entityType.String()
+			opts = append(opts,
+				cel.Overload(overloadName,
+					argTypes, resultType, cel.FunctionBinding(binding),
+				),
+				cel.Overload(overloadName+"_secret",
+					append(argTypes, cel.StringType), resultType, cel.FunctionBinding(binding),
+				),
+			)
+		}
+	}
+	return []cel.EnvOption{cel.Function("shift_date", opts...)}
+}
+
+func shiftDate(secret []byte, value, entity, rangeStr string) (string, error) {
+	if value == "infinity" || value == "-infinity" {
+		return value, nil
+	}
+	lo, hi, step, err := parseShiftRange(rangeStr)
+	if err != nil {
+		return "", err
+	}
+	pgTime, err := parsePgDateTime(value)
+	if err != nil {
+		return "", err
+	}
+
+	stream := newKeyedStream(secret, "shift_date", entity)
+	offset := lo + int64(stream.intn(int((hi-lo)/step)+1))*step
+	if !pgTime.hasTime {
+		// dates are shifted by whole days, the offset is rounded down
+		offset = floorDiv(offset, SECONDS_PER_DAY) * SECONDS_PER_DAY
+	}
+	pgTime.time = pgTime.time.Add(time.Duration(offset) * time.Second)
+	return pgTime.String(), nil
+}
+
+const SECONDS_PER_DAY = 24 * 60 * 60
+
+// MAX_SHIFT_SECONDS limits the bounds of the shift range to about 290 years.
+const MAX_SHIFT_SECONDS = int64(1<<63-1) / int64(time.Second)
+
+var shiftUnits = map[byte]int64{'d': SECONDS_PER_DAY, 'h': 60 * 60, 'm': 60, 's': 1}
+
+// parseShiftRange parses "<lo>..<hi>" bounds like "-30d", "12h", "90m" or "10s" into seconds.
+// The step of the offsets is the smallest unit of the bounds.
+func parseShiftRange(rangeStr string) (lo, hi, step int64, err error) {
+	loStr, hiStr, ok := strings.Cut(rangeStr, "..")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid range %q: expected <from>..<to>, e.g. -30d..30d", rangeStr)
+	}
+	lo, loUnit, err := parseShiftBound(loStr)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid range %q: %w", rangeStr, err)
+	}
+	hi, hiUnit, err := parseShiftBound(hiStr)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid range %q: %w", rangeStr, err)
+	}
+	if lo > hi {
+		return 0, 0, 0, fmt.Errorf("invalid range %q: %s is after %s", rangeStr, loStr, hiStr)
+	}
+	return lo, hi, min(loUnit, hiUnit), nil
+}
+
+func parseShiftBound(bound string) (int64, int64, error) {
+	bound = strings.TrimSpace(bound)
+	if bound == "" {
+		return 0, 0, fmt.Errorf("empty bound")
+	}
+	unit, ok := shiftUnits[bound[len(bound)-1]]
+	if !ok {
+		return 0, 0, fmt.Errorf("bound %q has no unit d, h, m or s", bound)
+	}
+	n, err := strconv.ParseInt(bound[:len(bound)-1], 10, 64)
+	if err != nil || n > MAX_SHIFT_SECONDS/unit || n < -MAX_SHIFT_SECONDS/unit {
+		return 0, 0, fmt.Errorf("invalid bound %q", bound)
+	}
+	return n * unit, unit, nil
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// pgDateTime is a date, timestamp or timestamptz in the ISO DateStyle used by pg_dump:
+// "2024-01-15", "2024-01-15 10:30:00.25" or "2024-01-15 10:30:00+05:30", with a " BC" suffix
+// for the years before Christ. The fraction of the seconds and the zone are kept as text,
+// so the shifted value is written in the same format.
+type pgDateTime struct {
+	time    time.Time // wall clock time in UTC, the year 1 BC is the year 0
+	hasTime bool
+	frac    string // ".25"
+	zone    string // "+05:30"
+}
+
+func parsePgDateTime(value string) (pgDateTime, error) {
+	var t pgDateTime
+	invalid := fmt.Errorf("invalid date or timestamp: %q", value)
+
+	text, bc := strings.CutSuffix(value, " BC")
+	datePart, clockPart, hasTime := strings.Cut(text, " ")
+	dateFields := strings.Split(datePart, "-")
+	if len(dateFields) != 3 || len(dateFields[0]) < 4 ||
+		len(dateFields[1]) != 2 || len(dateFields[2]) != 2 {
+		return t, invalid
+	}
+	year, yearOK := parseDigits(dateFields[0])
+	month, monthOK := parseDigits(dateFields[1])
+	day, dayOK := parseDigits(dateFields[2])
+	if !yearOK || !monthOK || !dayOK || year == 0 {
+		return t, invalid
+	}
+	if bc {
+		year = 1 - year
+	}
+
+	var hour, minute, sec int
+	if hasTime {
+		t.hasTime = true
+		if zoneStart := strings.IndexAny(clockPart, "+-"); zoneStart != -1 {
+			clockPart, t.zone = clockPart[:zoneStart], clockPart[zoneStart:]
+			if !validPgZone(t.zone) {
+				return t, invalid
+			}
+		}
+		if dot := strings.IndexByte(clockPart, '.'); dot != -1 {
+			clockPart, t.frac = clockPart[:dot], clockPart[dot:]
+			if _, ok := parseDigits(t.frac[1:]); !ok {
+				return t, invalid
+			}
+		}
+		clockFields := strings.Split(clockPart, ":")
+		if len(clockFields) != 3 {
+			return t, invalid
+		}
+		var hourOK, minuteOK, secOK bool
+		hour, hourOK = parseDigits(clockFields[0])
+		minute, minuteOK = parseDigits(clockFields[1])
+		sec, secOK = parseDigits(clockFields[2])
+		if !hourOK || !minuteOK || !secOK || hour > 23 || minute > 59 || sec > 59 {
+			return t, invalid
+		}
+	}
+
+	t.time = time.Date(year, time.Month(month), day, hour, minute, sec, 0, time.UTC)
+	if t.time.Month() != time.Month(month) || t.time.Day() != day {
+		return t, invalid
+	}
+	return t, nil
+}
+
+// validPgZone checks a zone offset: "+05", "-03:30" or "+00:53:28".
+func validPgZone(zone string) bool {
+	fields := strings.Split(zone[1:], ":")
+	if len(fields) > 3 {
+		return false
+	}
+	for _, field := range fields {
+		if _, ok := parseDigits(field); !ok || len(field) != 2 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDigits parses a non-empty string of ASCII digits.
+func parseDigits(s string) (int, bool) {
+	if s == "" || len(s) > 9 {
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// Instant returns the time with the fraction of the seconds, in the zone of the value
+// or in UTC for values without a zone.
+func (t pgDateTime) Instant() time.Time {
+	nsec := 0
+	if t.frac != "" {
+		digits := (t.frac[1:] + "000000000")[:9]
+		nsec, _ = parseDigits(digits)
+	}
+	loc := time.UTC
+	if t.zone != "" {
+		offset := 0
+		for i, field := range strings.Split(t.zone[1:], ":") {
+			n, _ := parseDigits(field)
+			offset += n * []int{60 * 60, 60, 1}[i]
+		}
+		if t.zone[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(
+		t.time.Year(), t.time.Month(), t.time.Day(),
+		t.time.Hour(), t.time.Minute(), t.time.Second(), nsec, loc,
+	)
+}
+
+func (t pgDateTime) String() string {
+	year, bc := t.time.Year(), false
+	if year <= 0 {
+		year, bc = 1-year, true
+	}
+	out := fmt.Sprintf("%04d-%02d-%02d", year, t.time.Month(), t.time.Day())
+	if t.hasTime {
+		out += fmt.Sprintf(" %02d:%02d:%02d", t.time.Hour(), t.time.Minute(), t.time.Second())
+		out += t.frac + t.zone
+	}
+	if bc {
+		out += " BC"
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package cel_extensions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgDateTime_RoundTrip(t *testing.T) {
+	for _, value := range []string{
+		"2024-01-15",
+		"0044-03-15 BC",
+		"12345-06-30",
+		"2024-01-15 10:30:00",
+		"2024-01-15 10:30:00.5",
+		"2024-01-15 10:30:00.123456",
+		"2024-01-15 10:30:00+00",
+		"2024-01-15 10:30:00.25-03:30",
+		"1901-01-01 00:00:00+00:53:28",
+		"0001-12-31 23:59:59+01 BC",
+	} {
+		parsed, err := parsePgDateTime(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, value, parsed.String())
+	}
+
+	for _, value := range []string{
+		"", "2024-1-15", "2024-02-30", "0000-01-01", "24-01-15", "2024-01-15T10:30:00",
+		"2024-01-15 25:00:00", "2024-01-15 10:30", "2024-01-15 10:30:00.", "2024-01-15 10:30:00+5",
+		"Mon Jan 15 10:30:00 2024",
+	} {
+		_, err := parsePgDateTime(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseShiftRange(t *testing.T) {
+	tests := []struct {
+		rangeStr string
+		lo       int64
+		hi       int64
+		step     int64
+		err      string
+	}{
+		{"-30d..30d", -30 * SECONDS_PER_DAY, 30 * SECONDS_PER_DAY, SECONDS_PER_DAY, ""},
+		{"0d..12h", 0, 12 * 3600, 3600, ""},
+		{"-90m..10s", -90 * 60, 10, 1, ""},
+		{"30d", 0, 0, 0, "expected <from>..<to>"},
+		{"30d..-30d", 0, 0, 0, "30d is after -30d"},
+		{"-30..30d", 0, 0, 0, "has no unit"},
+		{"-30xd..30d", 0, 0, 0, "invalid bound"},
+		{"0d..200000d", 0, 0, 0, "invalid bound"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rangeStr, func(t *testing.T) {
+			lo, hi, step, err := parseShiftRange(tt.rangeStr)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []int64{tt.lo, tt.hi, tt.step}, []int64{lo, hi, step})
+		})
+	}
+}
+
+func TestShiftDate(t *testing.T) {
+	t.Setenv("CHISEL_SECRET_DEFAULT", "default-key")
+	t.Setenv("CHISEL_SECRET_DATES", "dates-key")
+	table := map[string][]byte{
+		"user_id":    []byte("42"),
+		"birth_date": []byte("1990-05-17"),
+		"created_at": []byte("2024-01-15 10:30:00.25+05:30"),
+		"updated_at": []byte("2024-01-15 10:30:01.25+05:30"),
+		"missing":    []byte(PG_NULL),
+	}
+
+	// GIVEN a date shifted by at most 30 days
+	birth, err := evalString(t, `shift_date(table.birth_date, table.user_id, "-30d..30d")`, table)
+	require.NoError(t, err)
+	shifted, err := time.Parse(time.DateOnly, birth)
+	require.NoError(t, err)
+	original := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+	assert.LessOrEqual(t, shifted.Sub(original).Abs(), 30*24*time.Hour)
+
+	// THEN it is shifted the same way with an int entity, and another way with another secret
+	again, err := evalString(t, `shift_date(table.birth_date, 42, "-30d..30d")`, table)
+	require.NoError(t, err)
+	assert.Equal(t, birth, again)
+	other, err := evalString(
+		t, `shift_date(table.birth_date, table.user_id, "-3650d..3650d", "dates")`, table,
+	)
+	require.NoError(t, err)
+	assert.NotEqual(t, birth, other)
+
+	// AND the timestamps of the entity are shifted by the same offset, keeping their format
+	created, err := evalString(t, `shift_date(table.created_at, table.user_id, "-7d..7d")`, table)
+	require.NoError(t, err)
+	updated, err := evalString(t, `shift_date(table.updated_at, table.user_id, "-7d..7d")`, table)
+	require.NoError(t, err)
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2} 10:30:00\.25\+05:30$`, created)
+	assert.Equal(t, strings.Replace(created, ":00.25", ":01.25", 1), updated)
+
+	// AND NULL and infinity are kept
+	out, err := evalString(
+		t, `shift_date(table.missing, table.user_id, "-7d..7d") == null ? "null" : "text"`, table,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "null", out)
+	out, err = evalString(t, `shift_date("infinity", table.user_id, "-7d..7d")`, table)
+	require.NoError(t, err)
+	assert.Equal(t, "infinity", out)
+
+	_, err = evalString(t, `shift_date("2024-13-01", table.user_id, "-7d..7d")`, table)
+	assert.ErrorContains(t, err, "invalid date or timestamp")
+}
+
+func TestShiftDate_DateRoundedDown(t *testing.T) {
+	secret := []byte("key")
+	// a date is shifted to the day of the shifted midnight
+	for _, entity := range []string{"1", "2", "3", "4", "5", "6", "7", "8"} {
+		date, err := shiftDate(secret, "2024-03-01", entity, "-36h..36h")
+		require.NoError(t, err)
+		midnight, err := shiftDate(secret, "2024-03-01 00:00:00", entity, "-36h..36h")
+		require.NoError(t, err)
+		assert.Equal(t, date, midnight[:len(date)], entity)
+	}
+}
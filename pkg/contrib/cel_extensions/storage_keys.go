@@ -0,0 +1,55 @@
+package cel_extensions
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+)
+
+// storageFuncs are the functions reading the storage.
+var storageFuncs = map[string]struct{}{
+	"array":    {},
+	"set":      {},
+	"intset":   {},
+	"maybe_in": {},
+}
+
+// StorageKeys returns the storage keys read by the expression through the storage functions.
+// dynamic is true if some key is computed, so any key may be read.
+func StorageKeys(expr string) (keys []string, dynamic bool, err error) {
+	env, err := cel.NewEnv()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to initialize CEL environment: %w", err)
+	}
+
+	parsed, issues := env.Parse(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, false, fmt.Errorf("failed to parse CEL expression: %w", issues.Err())
+	}
+
+	visitor := ast.NewExprVisitor(func(e ast.Expr) {
+		if e.Kind() != ast.CallKind {
+			return
+		}
+		call := e.AsCall()
+		if _, ok := storageFuncs[call.FunctionName()]; !ok || call.IsMemberFunction() {
+			return
+		}
+		args := call.Args()
+		if len(args) == 0 {
+			return
+		}
+		// the key is the first argument
+		if args[0].Kind() == ast.LiteralKind {
+			if key, ok := args[0].AsLiteral().(types.String); ok {
+				keys = append(keys, string(key))
+				return
+			}
+		}
+		dynamic = true
+	})
+	ast.PreOrderVisit(parsed.NativeRep().Expr(), visitor)
+	return keys, dynamic, nil
+}
@@ -0,0 +1,42 @@
+package cel_extensions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		keys    []string
+		dynamic bool
+	}{
+		{"no storage", `table.id == b"1"`, nil, false},
+		{"set", `string(table.id) in set("users.id")`, []string{"users.id"}, false},
+		{
+			"array and set",
+			`string(table.id) in array("a") || string(table.id) in set("b")`,
+			[]string{"a", "b"},
+			false,
+		},
+		{"intset", `int(table.id) in intset("users.id")`, []string{"users.id"}, false},
+		{"maybe_in", `maybe_in("users.id", table.id)`, []string{"users.id"}, false},
+		{"computed key", `string(table.id) in set("users." + "id")`, nil, true},
+		{"member call", `"users.id".set()`, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, dynamic, err := StorageKeys(tt.expr)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.keys, keys)
+			assert.Equal(t, tt.dynamic, dynamic)
+		})
+	}
+
+	_, _, err := StorageKeys(`set(`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package cel_extensions
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_LOCALE is the locale of the word lists used by the pseudonymization functions
+// and by the fake functions called without a locale.
+const DEFAULT_LOCALE = "en"
+
+// wordlists holds a directory per locale with a word list per file, one word per line.
+//
+//go:embed wordlists
+var wordlists embed.FS
+
+var wordlistCache sync.Map // "<locale>/<name>" -> []string
+
+// words returns the embedded word list of the locale.
+func words(locale, name string) ([]string, error) {
+	cacheKey := locale + "/" + name
+	if cached, ok := wordlistCache.Load(cacheKey); ok {
+		return cached.([]string), nil
+	}
+
+	data, err := wordlists.ReadFile(path.Join("wordlists", locale, name+".txt"))
+	if err != nil {
+		return nil, fmt.Errorf("no %s word list for locale %s", name, locale)
+	}
+	var list []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
+		}
+	}
+	wordlistCache.Store(cacheKey, list)
+	return list, nil
+}
+
+// mustWords returns a word list known to be embedded.
+func mustWords(locale, name string) []string {
+	list, err := words(locale, name)
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
@@ -0,0 +1,70 @@
+package dump
+
+import (
+	"fmt"
+
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+// zlib Z_DEFAULT_COMPRESSION, stored by pg_dump when no level is specified
+const defaultCompressionLevel = -1
+
+var codecAlgorithms = map[string]CompressionAlgorithm{
+	config.NONE_COMPRESSION: COMPRESSION_NONE,
+	config.GZIP_COMPRESSION: COMPRESSION_GZIP,
+	config.LZ4_COMPRESSION:  COMPRESSION_LZ4,
+	config.ZSTD_COMPRESSION: COMPRESSION_ZSTD,
+}
+
+// outputCodec returns the codec of written data. The source codec is kept
+// unless the output compression is configured.
+func outputCodec(cfg *config.Config, source dumpio.Codec) (dumpio.Codec, error) {
+	if cfg.Output.Compression == "" {
+		return source, nil
+	}
+	return dumpio.CodecByName(cfg.Output.Compression)
+}
+
+// setHeaderCompression updates the archive header with the output compression.
+func setHeaderCompression(h *ArchiveHeader, out config.Output) error {
+	if out.Compression == "" {
+		return nil
+	}
+
+	algorithm, ok := codecAlgorithms[out.Compression]
+	if !ok {
+		return fmt.Errorf("unknown compression: %s", out.Compression)
+	}
+
+	// archives older than 1.15 store the gzip level instead of the algorithm
+	if h.Version() < archiveVersion1_15 {
+		switch algorithm {
+		case COMPRESSION_NONE:
+			h.CompressionLevel = 0
+		case COMPRESSION_GZIP:
+			h.CompressionLevel = out.Level
+			if out.Level == dumpio.DEFAULT_LEVEL {
+				h.CompressionLevel = defaultCompressionLevel
+			}
+		default:
+			return fmt.Errorf(
+				"%s compression requires archive version 1.15, got %d.%d",
+				out.Compression,
+				h.VersionMajor,
+				h.VersionMinor,
+			)
+		}
+	}
+	h.Compression = algorithm
+	return nil
+}
+
+// checkOutputCompression checks the output compression can be stored in the archive header.
+func checkOutputCompression(toc *Toc, cfg *config.Config) error {
+	header := toc.Header
+	if err := setHeaderCompression(&header, cfg.Output); err != nil {
+		return fmt.Errorf("invalid output compression: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,580 @@
+package dump
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/klauspost/compress/zlib"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+// The layout of data blocks follows
+// https://github.com/postgres/postgres/blob/master/src/bin/pg_dump/pg_backup_custom.c
+
+// Data block types of the custom format.
+const (
+	BLK_DATA  byte = 1
+	BLK_BLOBS byte = 3
+)
+
+// customChunkSize is the maximum size of a data chunk written to the archive.
+const customChunkSize = 64 * 1024
+
+// loadCustomDump handles loading metadata for a custom format archive.
+// Table data is read directly from the archive until it is rewritten by a command.
+func loadCustomDump(cfg *config.Config) (*Dump, error) {
+	file, err := os.Open(cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive: %w", err)
+	}
+	defer file.Close()
+
+	ar := newArchiveReader(bufio.NewReader(file))
+	toc, err := ar.readToc()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read TOC: %w", err)
+	}
+	if toc.Header.Format != CUSTOM_ARCHIVE {
+		return nil, fmt.Errorf("archive is not a custom archive, got format %d", toc.Header.Format)
+	}
+	if err := checkCustomCompression(&toc.Header); err != nil {
+		return nil, err
+	}
+	if err := checkOutputCompression(toc, cfg); err != nil {
+		return nil, err
+	}
+
+	if err := resolveCustomDataOffsets(file, toc, ar.pos); err != nil {
+		return nil, fmt.Errorf("cannot resolve data offsets: %w", err)
+	}
+
+	dump, err := newDumpFromToc(toc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dump.initStaging(cfg.Destination); err != nil {
+		return nil, err
+	}
+
+	for _, entity := range dump.Entities {
+		entry := entity.TocEntry
+		if entity.Meta.Desc != TABLE_DATA || entry.DataState != OFFSET_POS_SET {
+			continue
+		}
+		entity.DumpHandler = dumpio.NewStagedDumpHandler(
+			dump.stagedDataPath(entry.DumpId),
+			func() (io.ReadCloser, error) {
+				return openCustomDataBlock(cfg.Source, &toc.Header, entry)
+			},
+		)
+	}
+
+	return dump, nil
+}
+
+// checkCustomCompression ensures data blocks of the archive can be decompressed.
+func checkCustomCompression(h *ArchiveHeader) error {
+	switch customCompression(h) {
+	case COMPRESSION_NONE, COMPRESSION_GZIP:
+		return nil
+	default:
+		return fmt.Errorf("unsupported archive compression: %d", h.Compression)
+	}
+}
+
+// customCompression returns the compression algorithm of the data blocks.
+func customCompression(h *ArchiveHeader) CompressionAlgorithm {
+	if h.Version() < archiveVersion1_15 {
+		if h.CompressionLevel != 0 {
+			return COMPRESSION_GZIP
+		}
+		return COMPRESSION_NONE
+	}
+	return h.Compression
+}
+
+// resolveCustomDataOffsets scans the data blocks following the TOC when pg_dump
+// could not record their offsets (e.g. the archive was written to a pipe).
+func resolveCustomDataOffsets(file *os.File, toc *Toc, dataStart int64) error {
+	entries := make(map[int]*TocEntry)
+	for _, entry := range toc.Entries {
+		if entry.DataState == OFFSET_POS_NOT_SET {
+			entries[entry.DumpId] = entry
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if _, err := file.Seek(dataStart, io.SeekStart); err != nil {
+		return fmt.Errorf("seek error: %w", err)
+	}
+	ar := newArchiveReader(bufio.NewReader(file))
+	ar.header = &toc.Header
+
+	for len(entries) > 0 {
+		offset := dataStart + ar.pos
+		blkType, err := ar.readByte()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		dumpId, err := ar.readInt()
+		if err != nil {
+			return err
+		}
+		if entry, ok := entries[dumpId]; ok {
+			entry.DataState = OFFSET_POS_SET
+			entry.DataOffset = offset
+			delete(entries, dumpId)
+		}
+		if err := skipCustomDataBlock(ar, blkType); err != nil {
+			return fmt.Errorf("data block %d: %w", dumpId, err)
+		}
+	}
+
+	for dumpId, entry := range entries {
+		log.Printf("[WARN] Data block of entry %d %s was not found", dumpId, entry.Tag)
+		entry.DataState = OFFSET_NO_DATA
+	}
+	return nil
+}
+
+// skipCustomDataBlock skips the block content following the block type and dump id.
+func skipCustomDataBlock(ar *archiveReader, blkType byte) error {
+	switch blkType {
+	case BLK_DATA:
+		return skipCustomChunks(ar)
+	case BLK_BLOBS:
+		for {
+			oid, err := ar.readInt()
+			if err != nil {
+				return err
+			}
+			if oid == 0 {
+				return nil
+			}
+			if err := skipCustomChunks(ar); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unrecognized data block type %d", blkType)
+	}
+}
+
+func skipCustomChunks(ar *archiveReader) error {
+	for {
+		size, err := ar.readInt()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		n, err := io.CopyN(io.Discard, ar.r, int64(size))
+		ar.pos += n
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openCustomDataBlock opens the data block of the TOC entry
+// and returns a reader of the decompressed COPY data.
+func openCustomDataBlock(
+	path string,
+	header *ArchiveHeader,
+	entry *TocEntry,
+) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive: %w", err)
+	}
+	if _, err := file.Seek(entry.DataOffset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("seek error: %w", err)
+	}
+
+	ar := newArchiveReader(bufio.NewReader(file))
+	ar.header = header
+	if err := readCustomBlockHeader(ar, BLK_DATA, entry.DumpId); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	reader, err := readCustomChunks(ar)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &readCloser{
+		Reader: reader,
+		close: func() error {
+			err := reader.Close()
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		},
+	}, nil
+}
+
+// readCustomBlockHeader reads the block type and dump id and checks they match.
+func readCustomBlockHeader(ar *archiveReader, blkType byte, dumpId int) error {
+	gotType, err := ar.readByte()
+	if err != nil {
+		return fmt.Errorf("cannot read data block type: %w", err)
+	}
+	gotId, err := ar.readInt()
+	if err != nil {
+		return fmt.Errorf("cannot read data block id: %w", err)
+	}
+	if gotType != blkType || gotId != dumpId {
+		return fmt.Errorf(
+			"found unexpected block (type %d, id %d) when reading data of entry %d",
+			gotType,
+			gotId,
+			dumpId,
+		)
+	}
+	return nil
+}
+
+// customChunkReader reads the payload of length-prefixed chunks until the zero-length one.
+type customChunkReader struct {
+	ar        *archiveReader
+	remaining int
+	done      bool
+}
+
+func (r *customChunkReader) Read(p []byte) (int, error) {
+	for r.remaining == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		size, err := r.ar.readInt()
+		if err != nil {
+			return 0, fmt.Errorf("cannot read chunk size: %w", err)
+		}
+		if size == 0 {
+			r.done = true
+			return 0, io.EOF
+		}
+		r.remaining = size
+	}
+
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ar.r.Read(p)
+	r.ar.pos += int64(n)
+	r.remaining -= n
+	if errors.Is(err, io.EOF) && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// customChunkWriter buffers written data into length-prefixed chunks.
+// Close flushes the buffer and writes the zero-length end of data marker.
+type customChunkWriter struct {
+	aw  *archiveWriter
+	buf []byte
+}
+
+func newCustomChunkWriter(aw *archiveWriter) *customChunkWriter {
+	return &customChunkWriter{aw: aw, buf: make([]byte, 0, customChunkSize)}
+}
+
+func (w *customChunkWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		if len(w.buf) == cap(w.buf) {
+			w.flush()
+		}
+	}
+	return written, w.aw.err
+}
+
+func (w *customChunkWriter) flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+	w.aw.writeInt(len(w.buf))
+	w.aw.write(w.buf)
+	w.buf = w.buf[:0]
+}
+
+func (w *customChunkWriter) Close() error {
+	w.flush()
+	w.aw.writeInt(0)
+	return w.aw.err
+}
+
+// saveCustomDump writes a new custom archive to the destination. Rewritten data
+// is taken from the staging directory, all other data blocks are copied as is,
+// or recompressed if the output compression differs from the source one.
+func saveCustomDump(cfg *config.Config, dump *Dump) error {
+	toc := dump.BuildToc()
+	if err := setHeaderCompression(&toc.Header, cfg.Output); err != nil {
+		return err
+	}
+
+	err := replaceFile(cfg.Destination, func(file *os.File) error {
+		return writeCustomArchive(file, cfg, dump, toc)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write custom archive: %w", err)
+	}
+	log.Printf("[INFO] Custom archive written: %s", cfg.Destination)
+	return nil
+}
+
+// writeCustomArchive writes the header, TOC and data blocks the same way pg_dump does:
+// the TOC is written first with placeholders and rewritten once data offsets are known.
+func writeCustomArchive(file *os.File, cfg *config.Config, dump *Dump, toc *Toc) error {
+	src, err := os.Open(cfg.Source)
+	if err != nil {
+		return fmt.Errorf("cannot open source archive: %w", err)
+	}
+	defer src.Close()
+
+	bw := bufio.NewWriter(file)
+	aw := newArchiveWriter(bw, &toc.Header)
+	aw.level = cfg.Output.Level
+	if err := aw.writeHeader(); err != nil {
+		return fmt.Errorf("header write error: %w", err)
+	}
+	tocStart := aw.pos
+	if err := aw.writeTocEntries(toc.Entries); err != nil {
+		return err
+	}
+
+	recompress := customCompression(&toc.Header) != customCompression(&dump.Toc.Header)
+	for _, entry := range toc.Entries {
+		if entry.DataState != OFFSET_POS_SET {
+			entry.DataState = OFFSET_NO_DATA
+			continue
+		}
+		srcOffset := entry.DataOffset
+		entry.DataOffset = aw.pos
+
+		staged, err := dump.isStaged(entry.DumpId)
+		if err != nil {
+			return err
+		}
+		switch {
+		case staged:
+			err = writeStagedCustomBlock(aw, dump, entry)
+		case recompress:
+			err = recompressCustomBlock(aw, src, &dump.Toc.Header, srcOffset, entry)
+		default:
+			err = copyCustomBlock(aw, src, srcOffset, entry)
+		}
+		if err != nil {
+			return fmt.Errorf("data block %d write error: %w", entry.DumpId, err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if _, err := file.Seek(tocStart, io.SeekStart); err != nil {
+		return fmt.Errorf("seek error: %w", err)
+	}
+
+	bw = bufio.NewWriter(file)
+	if err := newArchiveWriter(bw, &toc.Header).writeTocEntries(toc.Entries); err != nil {
+		return fmt.Errorf("TOC rewrite error: %w", err)
+	}
+	return bw.Flush()
+}
+
+// writeStagedCustomBlock writes the staged entity data as a compressed data block.
+func writeStagedCustomBlock(aw *archiveWriter, dump *Dump, entry *TocEntry) error {
+	reader, err := dump.openStaged(entry.DumpId)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	aw.writeByte(BLK_DATA)
+	aw.writeInt(entry.DumpId)
+	return writeCustomChunks(aw, reader)
+}
+
+// writeCustomChunks compresses data from r into chunks followed by the end of data marker.
+func writeCustomChunks(aw *archiveWriter, r io.Reader) error {
+	chunks := newCustomChunkWriter(aw)
+	if customCompression(aw.header) == COMPRESSION_NONE {
+		if _, err := io.Copy(chunks, r); err != nil {
+			return err
+		}
+		return chunks.Close()
+	}
+
+	level := aw.level
+	switch {
+	case level != dumpio.DEFAULT_LEVEL:
+	case aw.header.Version() < archiveVersion1_15 && aw.header.CompressionLevel > 0:
+		level = aw.header.CompressionLevel
+	default:
+		level = zlib.DefaultCompression
+	}
+	zw, err := zlib.NewWriterLevel(chunks, level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return chunks.Close()
+}
+
+// readCustomChunks returns a reader of decompressed chunk data. Closing the reader
+// consumes the remaining chunks up to the end of data marker.
+func readCustomChunks(ar *archiveReader) (io.ReadCloser, error) {
+	chunks := &customChunkReader{ar: ar}
+	drain := func() error {
+		_, err := io.Copy(io.Discard, chunks)
+		return err
+	}
+	if customCompression(ar.header) == COMPRESSION_NONE {
+		return &readCloser{Reader: chunks, close: drain}, nil
+	}
+
+	zr, err := zlib.NewReader(chunks)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open zlib stream: %w", err)
+	}
+	return &readCloser{
+		Reader: zr,
+		close: func() error {
+			if err := zr.Close(); err != nil {
+				return err
+			}
+			return drain()
+		},
+	}, nil
+}
+
+// recompressCustomBlock decompresses the data block from the source archive
+// and writes it with the output compression.
+func recompressCustomBlock(
+	aw *archiveWriter,
+	src *os.File,
+	srcHeader *ArchiveHeader,
+	offset int64,
+	entry *TocEntry,
+) error {
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek error: %w", err)
+	}
+	ar := newArchiveReader(bufio.NewReader(src))
+	ar.header = srcHeader
+
+	blkType, err := ar.readByte()
+	if err != nil {
+		return err
+	}
+	dumpId, err := ar.readInt()
+	if err != nil {
+		return err
+	}
+	if dumpId != entry.DumpId {
+		return fmt.Errorf("found unexpected block id %d", dumpId)
+	}
+	aw.writeByte(blkType)
+	aw.writeInt(dumpId)
+
+	switch blkType {
+	case BLK_DATA:
+		return recompressCustomChunks(aw, ar)
+	case BLK_BLOBS:
+		for {
+			oid, err := ar.readInt()
+			if err != nil {
+				return err
+			}
+			aw.writeInt(oid)
+			if oid == 0 {
+				return aw.err
+			}
+			if err := recompressCustomChunks(aw, ar); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unrecognized data block type %d", blkType)
+	}
+}
+
+func recompressCustomChunks(aw *archiveWriter, ar *archiveReader) error {
+	reader, err := readCustomChunks(ar)
+	if err != nil {
+		return err
+	}
+	if err := writeCustomChunks(aw, reader); err != nil {
+		reader.Close()
+		return err
+	}
+	return reader.Close()
+}
+
+// copyCustomBlock copies the data block from the source archive without decompressing it.
+func copyCustomBlock(aw *archiveWriter, src *os.File, offset int64, entry *TocEntry) error {
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek error: %w", err)
+	}
+
+	tee := &archiveTee{r: bufio.NewReader(src), aw: aw}
+	ar := newArchiveReader(tee)
+	ar.header = aw.header
+
+	blkType, err := ar.readByte()
+	if err != nil {
+		return err
+	}
+	dumpId, err := ar.readInt()
+	if err != nil {
+		return err
+	}
+	if dumpId != entry.DumpId {
+		return fmt.Errorf("found unexpected block id %d", dumpId)
+	}
+	if err := skipCustomDataBlock(ar, blkType); err != nil {
+		return err
+	}
+	return aw.err
+}
+
+// archiveTee writes everything read from r to the archive writer.
+type archiveTee struct {
+	r  io.Reader
+	aw *archiveWriter
+}
+
+func (t *archiveTee) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.aw.write(p[:n])
+		if t.aw.err != nil {
+			return n, t.aw.err
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,182 @@
+package dump
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+const customTestData = "1\tfoo\n2\tbar\n\\.\n\n"
+
+// buildCustomArchive writes a custom archive with a single table data block
+// whose offset is not recorded in the TOC, like pg_dump does when writing to a pipe.
+func buildCustomArchive(t *testing.T, path string, compression CompressionAlgorithm) {
+	toc, err := ReadToc(bytes.NewReader(buildTestToc(CUSTOM_ARCHIVE, 15)))
+	require.NoError(t, err)
+	toc.Header.Compression = compression
+	toc.Entries[2].DataState = OFFSET_POS_NOT_SET
+	toc.Entries[2].DataOffset = 0
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteToc(&buf, toc))
+
+	b := newTocBuilder()
+	b.WriteByte(BLK_DATA)
+	b.int(30)
+	payload := []byte(customTestData)
+	if compression == COMPRESSION_GZIP {
+		var zbuf bytes.Buffer
+		zw := zlib.NewWriter(&zbuf)
+		_, err = zw.Write(payload)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		payload = zbuf.Bytes()
+	}
+	// split the payload into two chunks
+	b.int(3)
+	b.Write(payload[:3])
+	b.int(len(payload) - 3)
+	b.Write(payload[3:])
+	b.int(0)
+	buf.Write(b.Bytes())
+
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+func customTestConfig(src, dest string) *config.Config {
+	return &config.Config{
+		Source:      src,
+		Destination: dest,
+		Format:      config.CUSTOM_FORMAT,
+	}
+}
+
+func readTableData(t *testing.T, dump *Dump, name string) string {
+	entity, err := dump.GetTable(name)
+	require.NoError(t, err)
+
+	reader := entity.DumpHandler.GetReader()
+	require.NoError(t, reader.Open())
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLoadCustomDump(t *testing.T) {
+	for _, compression := range []CompressionAlgorithm{COMPRESSION_NONE, COMPRESSION_GZIP} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src.dump")
+		buildCustomArchive(t, src, compression)
+
+		dump, err := LoadDump(customTestConfig(src, filepath.Join(dir, "out", "dest.dump")))
+		require.NoError(t, err)
+
+		assert.Equal(t, OFFSET_POS_SET, dump.Toc.Entries[2].DataState)
+		assert.Equal(t, customTestData, readTableData(t, dump, "test_table"))
+
+		stagingDir := dump.stagingDir
+		assert.DirExists(t, stagingDir)
+		require.NoError(t, dump.Close())
+		assert.NoDirExists(t, stagingDir)
+	}
+}
+
+func TestSaveCustomDump(t *testing.T) {
+	for _, compression := range []CompressionAlgorithm{COMPRESSION_NONE, COMPRESSION_GZIP} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src.dump")
+		dest := filepath.Join(dir, "dest.dump")
+		buildCustomArchive(t, src, compression)
+
+		// copy untouched data blocks
+		cfg := customTestConfig(src, dest)
+		dump, err := LoadDump(cfg)
+		require.NoError(t, err)
+		require.NoError(t, SaveDump(cfg, dump))
+		require.NoError(t, dump.Close())
+
+		copied, err := LoadDump(customTestConfig(dest, filepath.Join(dir, "copy.dump")))
+		require.NoError(t, err)
+		assert.Equal(t, customTestData, readTableData(t, copied, "test_table"))
+		assert.Len(t, copied.Toc.Entries, 3)
+		require.NoError(t, copied.Close())
+
+		// write rewritten data blocks
+		cfg = customTestConfig(dest, filepath.Join(dir, "rewritten.dump"))
+		dump, err = LoadDump(cfg)
+		require.NoError(t, err)
+
+		entity, err := dump.GetTable("test_table")
+		require.NoError(t, err)
+		writer := entity.DumpHandler.GetWriter()
+		require.NoError(t, writer.Open())
+		_, err = writer.Write([]byte("3\tbaz\n\\.\n\n"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		assert.Equal(t, "3\tbaz\n\\.\n\n", readTableData(t, dump, "test_table"))
+		require.NoError(t, SaveDump(cfg, dump))
+		require.NoError(t, dump.Close())
+
+		rewritten, err := LoadDump(customTestConfig(cfg.Destination, filepath.Join(dir, "x.dump")))
+		require.NoError(t, err)
+		assert.Equal(t, compression, rewritten.Toc.Header.Compression)
+		assert.Equal(t, "3\tbaz\n\\.\n\n", readTableData(t, rewritten, "test_table"))
+		require.NoError(t, rewritten.Close())
+	}
+}
+
+func TestSaveCustomDump_DropTable(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.dump")
+	cfg := customTestConfig(src, filepath.Join(dir, "dest.dump"))
+	buildCustomArchive(t, src, COMPRESSION_GZIP)
+
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+	require.NoError(t, dump.DropTable("test_table"))
+	require.NoError(t, SaveDump(cfg, dump))
+	require.NoError(t, dump.Close())
+
+	toc, err := ReadTocFile(cfg.Destination)
+	require.NoError(t, err)
+	assert.Empty(t, toc.Entries)
+}
+
+func TestLoadCustomDump_WrongFormat(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "toc.dat")
+	require.NoError(t, os.WriteFile(src, buildTestToc(DIRECTORY_ARCHIVE, 15), 0o644))
+
+	_, err := LoadDump(customTestConfig(src, filepath.Join(dir, "dest.dump")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a custom archive")
+}
+
+func TestSaveCustomDump_OutputCompression(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.dump")
+	cfg := customTestConfig(src, filepath.Join(dir, "dest.dump"))
+	cfg.Output = config.Output{Compression: config.NONE_COMPRESSION}
+	buildCustomArchive(t, src, COMPRESSION_GZIP)
+
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+	require.NoError(t, SaveDump(cfg, dump))
+	require.NoError(t, dump.Close())
+
+	saved, err := LoadDump(customTestConfig(cfg.Destination, filepath.Join(dir, "x.dump")))
+	require.NoError(t, err)
+	defer saved.Close()
+	assert.Equal(t, COMPRESSION_NONE, saved.Toc.Header.Compression)
+	assert.Equal(t, customTestData, readTableData(t, saved, "test_table"))
+}
@@ -0,0 +1,196 @@
+package dump
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ColumnType is the type of a table column taken from the CREATE TABLE statement.
+type ColumnType struct {
+	// Type as it is written by pg_dump, e.g. "integer" or "character varying(255)".
+	Type    string
+	NotNull bool
+}
+
+// TableDefn is a table definition parsed from a CREATE TABLE statement.
+type TableDefn struct {
+	Schema  string
+	Name    string
+	Columns map[string]ColumnType // keyed by the column name as it is written in COPY
+}
+
+// columnConstraintKeywords terminate the type of column definition.
+var columnConstraintKeywords = map[string]struct{}{
+	"CHECK":       {},
+	"COLLATE":     {},
+	"COMPRESSION": {},
+	"CONSTRAINT":  {},
+	"DEFAULT":     {},
+	"GENERATED":   {},
+	"NOT":         {},
+	"NULL":        {},
+	"PRIMARY":     {},
+	"REFERENCES":  {},
+	"STORAGE":     {},
+	"UNIQUE":      {},
+}
+
+// tableConstraintKeywords start table constraints and other non-column elements.
+var tableConstraintKeywords = map[string]struct{}{
+	"CHECK":      {},
+	"CONSTRAINT": {},
+	"EXCLUDE":    {},
+	"FOREIGN":    {},
+	"LIKE":       {},
+	"PRIMARY":    {},
+	"UNIQUE":     {},
+}
+
+// ParseCreateTable parses a CREATE TABLE statement of a TABLE entry.
+// example:
+//
+//	CREATE TABLE public.test_table (
+//	    id integer NOT NULL,
+//	    "Name" character varying(255),
+//	    created_at timestamp with time zone DEFAULT now()
+//	);
+func ParseCreateTable(defn string) (*TableDefn, error) {
+	start := openParen(defn)
+	if start == -1 {
+		return nil, fmt.Errorf("no column list in table definition: %q", defn)
+	}
+	head, body := defn[:start], defn[start+1:]
+
+	words := splitSQL(head, ' ')
+	if len(words) < 3 || words[0] != "CREATE" || words[len(words)-2] != "TABLE" {
+		return nil, fmt.Errorf("not a CREATE TABLE statement: %q", head)
+	}
+
+	table := TableDefn{Columns: make(map[string]ColumnType)}
+	table.Schema, table.Name = splitQualifiedName(words[len(words)-1])
+
+	end := closingParen(body)
+	if end == -1 {
+		return nil, fmt.Errorf("unterminated column list in definition of %s", table.Name)
+	}
+
+	for _, element := range splitSQL(body[:end], ',') {
+		words := splitSQL(strings.TrimSpace(element), ' ')
+		if len(words) < 2 {
+			continue
+		}
+		if _, ok := tableConstraintKeywords[words[0]]; ok {
+			continue
+		}
+
+		column := ColumnType{}
+		typeWords := make([]string, 0, len(words)-1)
+		for i, word := range words[1:] {
+			if _, ok := columnConstraintKeywords[word]; ok {
+				rest := words[1+i:]
+				for j := 0; j+1 < len(rest); j++ {
+					if rest[j] == "NOT" && rest[j+1] == "NULL" {
+						column.NotNull = true
+					}
+				}
+				break
+			}
+			typeWords = append(typeWords, word)
+		}
+		column.Type = strings.Join(typeWords, " ")
+		table.Columns[words[0]] = column
+	}
+	return &table, nil
+}
+
+// splitSQL splits the statement by the separator outside of quotes and parentheses.
+// Empty parts are omitted.
+func splitSQL(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	inIdent, inString := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inIdent:
+			inIdent = c != '"'
+		case inString:
+			inString = c != '\''
+		case c == '"':
+			inIdent = true
+		case c == '\'':
+			inString = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (c == sep || sep == ' ' && (c == '\n' || c == '\t')):
+			if part := strings.TrimSpace(s[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// closingParen returns the position of the parenthesis closing an already opened one.
+func closingParen(s string) int {
+	depth := 1
+	inIdent, inString := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inIdent:
+			inIdent = c != '"'
+		case inString:
+			inString = c != '\''
+		case c == '"':
+			inIdent = true
+		case c == '\'':
+			inString = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// unquoteIdent removes the quotes pg_dump adds to identifiers.
+func unquoteIdent(ident string) string {
+	if len(ident) >= 2 && ident[0] == '"' && ident[len(ident)-1] == '"' {
+		return strings.ReplaceAll(ident[1:len(ident)-1], `""`, `"`)
+	}
+	return ident
+}
+
+// SetColumnTypes sets the types of the table columns from the table definition.
+func (t *TableMeta) SetColumnTypes(defn *TableDefn) {
+	for name, column := range t.Columns {
+		if columnType, ok := defn.Columns[name]; ok {
+			column.Type = columnType.Type
+			column.NotNull = columnType.NotNull
+		}
+	}
+}
+
+// setTableColumnTypes sets the column types from the CREATE TABLE statement.
+// Columns keep unknown types if the statement cannot be parsed.
+func setTableColumnTypes(table *TableMeta, defn string) {
+	tableDefn, err := ParseCreateTable(defn)
+	if err != nil {
+		log.Printf("[WARN] Column types of %s are unknown: %v", table.Name, err)
+		return
+	}
+	table.SetColumnTypes(tableDefn)
+}
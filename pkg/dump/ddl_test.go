@@ -0,0 +1,69 @@
+package dump
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	defn := `CREATE TABLE public.test_table (
+    id bigint NOT NULL,
+    "Name" character varying(255) DEFAULT 'a, (b'::character varying NOT NULL,
+    price numeric(10,2),
+    created_at timestamp(3) with time zone DEFAULT now(),
+    tags text[] COLLATE pg_catalog."default",
+    "weird ""col""" boolean,
+    CONSTRAINT test_table_check CHECK ((id > 0))
+);
+`
+	table, err := ParseCreateTable(defn)
+	require.NoError(t, err)
+
+	assert.Equal(t, "public", table.Schema)
+	assert.Equal(t, "test_table", table.Name)
+	assert.Equal(t, map[string]ColumnType{
+		"id":              {Type: "bigint", NotNull: true},
+		`"Name"`:          {Type: "character varying(255)", NotNull: true},
+		"price":           {Type: "numeric(10,2)"},
+		"created_at":      {Type: "timestamp(3) with time zone"},
+		"tags":            {Type: "text[]"},
+		`"weird ""col"""`: {Type: "boolean"},
+	}, table.Columns)
+}
+
+func TestParseCreateTable_QuotedName(t *testing.T) {
+	defn := "CREATE UNLOGGED TABLE \"My Schema\".\"Users\" (\n    id integer\n);\n"
+	table, err := ParseCreateTable(defn)
+	require.NoError(t, err)
+	assert.Equal(t, "My Schema", table.Schema)
+	assert.Equal(t, "Users", table.Name)
+	assert.Equal(t, ColumnType{Type: "integer"}, table.Columns["id"])
+}
+
+func TestParseCreateTable_Invalid(t *testing.T) {
+	for _, defn := range []string{
+		"CREATE VIEW public.v AS SELECT 1;",
+		"CREATE TABLE public.t (\n    id integer\n",
+		"ALTER TABLE public.t (id)",
+	} {
+		_, err := ParseCreateTable(defn)
+		assert.Error(t, err, defn)
+	}
+}
+
+func TestTableMeta_SetColumnTypes(t *testing.T) {
+	table, err := TableMetaFromCopyStmt("COPY public.test_table (id, \"Name\", extra) FROM stdin;\n")
+	require.NoError(t, err)
+
+	table.SetColumnTypes(&TableDefn{Columns: map[string]ColumnType{
+		"id":     {Type: "integer", NotNull: true},
+		`"Name"`: {Type: "text"},
+	}})
+
+	assert.Equal(t, "integer", table.Columns["id"].Type)
+	assert.True(t, table.Columns["id"].NotNull)
+	assert.Equal(t, "text", table.Columns[`"Name"`].Type)
+	assert.Empty(t, table.Columns["extra"].Type, "columns missing in the definition are untyped")
+}
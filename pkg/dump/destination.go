@@ -0,0 +1,149 @@
+package dump
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+// StagedDestination makes the output of a directory dump atomic: the run writes
+// into a staging directory next to the destination, which replaces the destination
+// only once the run succeeded. Single-file archives are already assembled in a temp
+// file and renamed into place on save, so they are not staged.
+type StagedDestination struct {
+	cfg  *config.Config
+	dest string // the configured destination
+	dir  string // staging directory, empty once committed, kept or aborted
+}
+
+// StageDestination points cfg.Destination to the staging directory next to
+// the destination, the configured destination is restored by Commit or Abort.
+// The staging directory kept by a failed run is reused if resume is set,
+// otherwise it is replaced by an empty one.
+func StageDestination(cfg *config.Config, resume bool) (*StagedDestination, error) {
+	staged := &StagedDestination{cfg: cfg, dest: cfg.Destination}
+	if cfg.Format != config.DIRECTORY_FORMAT {
+		if resume {
+			return nil, fmt.Errorf("resume is not supported by the %s format", cfg.Format)
+		}
+		return staged, nil
+	}
+
+	parent, name := filepath.Split(filepath.Clean(cfg.Destination))
+	dir := filepath.Join(parent, "."+name+".chisel-staging")
+	if !resume {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, fmt.Errorf("cannot remove previous staging directory: %w", err)
+		}
+	} else if _, err := os.Stat(dir); err == nil {
+		log.Printf("[INFO] Resume in staging directory %s", dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create staging directory: %w", err)
+	}
+
+	staged.dir = dir
+	cfg.Destination = dir
+	log.Printf("[DEBUG] Destination is staged in %s", dir)
+	return staged, nil
+}
+
+// Commit checks the staged dump and replaces the destination with it.
+func (s *StagedDestination) Commit() error {
+	if s.dir == "" {
+		return nil
+	}
+	if err := checkStagedDump(s.dir, s.cfg.TocFile); err != nil {
+		return fmt.Errorf("staged dump is inconsistent: %w", err)
+	}
+
+	parent, name := filepath.Split(filepath.Clean(s.dest))
+	backup := filepath.Join(parent, "."+name+".chisel-old")
+	if err := os.RemoveAll(backup); err != nil {
+		return fmt.Errorf("cannot remove stale backup: %w", err)
+	}
+
+	hasDest := true
+	if err := os.Rename(s.dest, backup); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot move destination aside: %w", err)
+		}
+		hasDest = false
+	}
+	if err := os.Rename(s.dir, s.dest); err != nil {
+		if hasDest {
+			if restoreErr := os.Rename(backup, s.dest); restoreErr != nil {
+				log.Printf("[ERROR] Cannot restore destination from %s: %v", backup, restoreErr)
+			}
+		}
+		return fmt.Errorf("cannot move staging directory to destination: %w", err)
+	}
+	log.Printf("[INFO] Staged dump moved to %s", s.dest)
+
+	s.dir = ""
+	s.cfg.Destination = s.dest
+	if hasDest {
+		if err := os.RemoveAll(backup); err != nil {
+			return fmt.Errorf("cannot remove previous destination: %w", err)
+		}
+	}
+	return nil
+}
+
+// Keep makes Abort leave the staging directory, so the failed run can be resumed.
+func (s *StagedDestination) Keep() {
+	if s.dir == "" {
+		return
+	}
+	log.Printf("[INFO] Staging directory is kept: %s", s.dir)
+	s.cfg.Destination = s.dest
+	s.dir = ""
+}
+
+// Abort removes the staging directory, the destination is left untouched.
+// It does nothing after Commit or Keep.
+func (s *StagedDestination) Abort() error {
+	if s.dir == "" {
+		return nil
+	}
+	s.cfg.Destination = s.dest
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("cannot remove staging directory: %w", err)
+	}
+	log.Printf("[DEBUG] Staging directory removed: %s", s.dir)
+	s.dir = ""
+	return nil
+}
+
+// checkStagedDump makes sure the TOC of the staged dump can be read, every data file
+// it references exists and no temp files are left.
+func checkStagedDump(dir, tocFile string) error {
+	toc, err := ReadTocFile(filepath.Join(dir, tocFile))
+	if err != nil {
+		return fmt.Errorf("cannot read TOC: %w", err)
+	}
+	for _, entry := range toc.Entries {
+		if entry.DataFile == "" {
+			continue
+		}
+		if _, err := findDataFile(dir, entry.DataFile); err != nil {
+			return err
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("cannot list staging directory: %w", err)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "tmp_") {
+			return fmt.Errorf("temp file %s is left", file.Name())
+		}
+	}
+	return nil
+}
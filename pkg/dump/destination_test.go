@@ -0,0 +1,173 @@
+package dump
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+// stagedTestDump stages the destination, loads the dump and rewrites its table.
+func stagedTestDump(t *testing.T, src, dest string) (*config.Config, *StagedDestination, *Dump) {
+	cfg := directoryTestConfig(src, dest)
+	staged, err := StageDestination(cfg, false)
+	require.NoError(t, err)
+	require.NotEqual(t, dest, cfg.Destination)
+
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+	entity, err := dump.GetTable("test_table")
+	require.NoError(t, err)
+	writer := entity.DumpHandler.GetWriter()
+	require.NoError(t, writer.Open())
+	_, err = writer.Write([]byte("3\tbaz\n\\.\n\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return cfg, staged, dump
+}
+
+func TestStagedDestination_Commit(t *testing.T) {
+	// GIVEN: A destination left by a previous run.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	buildDirectoryDump(t, src, dumpio.NoneCodec)
+	require.NoError(t, os.MkdirAll(dest, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "stale"), nil, 0o644))
+
+	cfg, staged, dump := stagedTestDump(t, src, dest)
+	assert.NoFileExists(t, filepath.Join(dest, "30.dat"), "destination is not written before commit")
+
+	// WHEN: The dump is saved and the destination is committed.
+	require.NoError(t, SaveDump(cfg, dump))
+	err := staged.Commit()
+
+	// THEN: The destination is replaced by the staged dump.
+	require.NoError(t, err)
+	assert.Equal(t, dest, cfg.Destination)
+	data, err := os.ReadFile(filepath.Join(dest, "30.dat"))
+	require.NoError(t, err)
+	assert.Equal(t, "3\tbaz\n\\.\n\n", string(data))
+	assert.FileExists(t, filepath.Join(dest, config.DEFAULT_TOC_FILE))
+	assert.NoFileExists(t, filepath.Join(dest, "stale"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "staging and backup directories are removed")
+	assert.NoError(t, staged.Abort(), "abort after commit does nothing")
+	assert.DirExists(t, dest)
+}
+
+func TestStagedDestination_CommitUntouched(t *testing.T) {
+	// GIVEN: A staged dump whose table is not rewritten by any task.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	buildDirectoryDump(t, src, dumpio.NoneCodec)
+	cfg := directoryTestConfig(src, dest)
+	staged, err := StageDestination(cfg, false)
+	require.NoError(t, err)
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+
+	// WHEN: The dump is saved and the destination is committed.
+	require.NoError(t, SaveDump(cfg, dump))
+	require.NoError(t, staged.Commit())
+
+	// THEN: The untouched data file is taken from the source.
+	data, err := os.ReadFile(filepath.Join(dest, "30.dat"))
+	require.NoError(t, err)
+	assert.Equal(t, directoryTestData, string(data))
+	data, err = os.ReadFile(filepath.Join(src, "30.dat"))
+	require.NoError(t, err)
+	assert.Equal(t, directoryTestData, string(data), "the source is untouched")
+}
+
+func TestStagedDestination_Abort(t *testing.T) {
+	// GIVEN: A destination left by a previous run and a failed run.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	buildDirectoryDump(t, src, dumpio.NoneCodec)
+	require.NoError(t, os.MkdirAll(dest, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "previous"), nil, 0o644))
+
+	cfg, staged, _ := stagedTestDump(t, src, dest)
+
+	// WHEN: The run is aborted.
+	err := staged.Abort()
+
+	// THEN: The staging directory is removed and the destination is untouched.
+	require.NoError(t, err)
+	assert.Equal(t, dest, cfg.Destination)
+	assert.FileExists(t, filepath.Join(dest, "previous"))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestStagedDestination_CommitInconsistent(t *testing.T) {
+	// GIVEN: A staged dump missing a data file referenced by its TOC.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	buildDirectoryDump(t, src, dumpio.NoneCodec)
+
+	cfg, staged, dump := stagedTestDump(t, src, dest)
+	require.NoError(t, SaveDump(cfg, dump))
+	require.NoError(t, os.Remove(filepath.Join(cfg.Destination, "30.dat")))
+
+	// WHEN: The destination is committed.
+	err := staged.Commit()
+
+	// THEN: The destination is not created.
+	assert.ErrorContains(t, err, "data file 30.dat not found")
+	assert.NoDirExists(t, dest)
+	require.NoError(t, staged.Abort())
+}
+
+func TestStageDestination_SingleFile(t *testing.T) {
+	// GIVEN: A custom archive destination.
+	cfg := &config.Config{Destination: "/tmp/dump.custom", Format: config.CUSTOM_FORMAT}
+
+	// WHEN: The destination is staged.
+	staged, err := StageDestination(cfg, false)
+
+	// THEN: It is kept, the archive is already replaced atomically on save.
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/dump.custom", cfg.Destination)
+	assert.NoError(t, staged.Commit())
+	assert.NoError(t, staged.Abort())
+}
+
+func TestStagedDestination_KeepAndResume(t *testing.T) {
+	// GIVEN: A failed run keeping its staging directory.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	buildDirectoryDump(t, src, dumpio.NoneCodec)
+
+	cfg, staged, _ := stagedTestDump(t, src, dest)
+	stagingDir := cfg.Destination
+	staged.Keep()
+	require.NoError(t, staged.Abort())
+	assert.Equal(t, dest, cfg.Destination)
+	assert.FileExists(t, filepath.Join(stagingDir, "30.dat"))
+
+	// WHEN: The run is resumed, then started again without resume.
+	resumed, err := StageDestination(cfg, true)
+	require.NoError(t, err)
+
+	// THEN: The resumed run reuses the staged files, a new run starts from scratch.
+	assert.Equal(t, stagingDir, cfg.Destination)
+	assert.FileExists(t, filepath.Join(stagingDir, "30.dat"))
+	resumed.Keep()
+
+	_, err = StageDestination(cfg, false)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(stagingDir, "30.dat"))
+}
@@ -1,7 +1,11 @@
 package dump
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
 	"path/filepath"
 
 	"github.com/zwergpro/pg-chisel/pkg/config"
@@ -10,15 +14,19 @@ import (
 
 // loadDirectoryDump handles loading metadata for a directory dump.
 func loadDirectoryDump(cfg *config.Config) (*Dump, error) {
-	dump := &Dump{
-		Entities: make(map[string]*Entity),
+	toc, err := ReadTocFile(filepath.Join(cfg.Source, cfg.TocFile))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read TOC: %w", err)
 	}
-
-	if err := loadEntityMeta(cfg, dump); err != nil {
+	if toc.Header.Format != DIRECTORY_ARCHIVE {
+		return nil, fmt.Errorf("TOC is not a directory archive, got format %d", toc.Header.Format)
+	}
+	if err := checkOutputCompression(toc, cfg); err != nil {
 		return nil, err
 	}
 
-	if err := loadTableMeta(cfg, dump); err != nil {
+	dump, err := newDumpFromToc(toc)
+	if err != nil {
 		return nil, err
 	}
 
@@ -29,54 +37,266 @@ func loadDirectoryDump(cfg *config.Config) (*Dump, error) {
 	return dump, nil
 }
 
-// loadEntityMeta populates dump Entities from the entity metadata file.
-func loadEntityMeta(cfg *config.Config, dump *Dump) error {
-	entityMeta, err := LoadEntityMetaFromFile(filepath.Join(cfg.Source, cfg.ListFile))
-	if err != nil {
-		return fmt.Errorf("cannot load entity metadata: %w", err)
+// newDumpFromToc populates dump Entities and their table metadata from the TOC.
+func newDumpFromToc(toc *Toc) (*Dump, error) {
+	dump := &Dump{
+		Entities:    make(map[string]*Entity),
+		Toc:         toc,
+		foreignKeys: foreignKeysFromToc(toc),
+	}
+
+	defns := make(map[string]string)
+	for _, entry := range toc.Entries {
+		if entry.Desc == TABLE {
+			defns[entry.Namespace+"."+entry.Tag] = entry.Defn
+		}
+	}
+
+	for _, entry := range toc.Entries {
+		meta, err := EntityMetaFromTocEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load entity metadata: %w", err)
+		}
+
+		entity := &Entity{
+			Id:       meta.DumpId,
+			Meta:     *meta,
+			TocEntry: entry,
+		}
+
+		if entry.Desc == TABLE_DATA && entry.CopyStmt != "" {
+			table, err := TableMetaFromCopyStmt(entry.CopyStmt)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load table metadata: %w", err)
+			}
+			if defn, ok := defns[entry.Namespace+"."+entry.Tag]; ok {
+				setTableColumnTypes(table, defn)
+			}
+			entity.Table = table
+		}
+
+		dump.Entities[meta.Name] = entity
+	}
+	return dump, nil
+}
+
+// dataFileSuffixes lists the suffixes pg_dump appends to data files for each compression.
+var dataFileSuffixes = []string{"", ".gz", ".lz4", ".zst"}
+
+// saveDirectoryDump writes the rebuilt TOC to the destination, links the data files
+// no task rewrote from the source and removes data files of dropped entries.
+// If the output compression is configured, data files are recompressed and stale
+// siblings are removed.
+func saveDirectoryDump(cfg *config.Config, dump *Dump) error {
+	if err := os.MkdirAll(cfg.Destination, 0o755); err != nil {
+		return fmt.Errorf("mkdir destination error: %w", err)
 	}
 
-	for _, meta := range entityMeta {
-		dump.Entities[meta.Name] = &Entity{
-			Id:   meta.DumpId,
-			Meta: *meta,
+	for _, entry := range dump.DroppedEntries() {
+		if entry.DataFile == "" {
+			continue
+		}
+		if err := removeDataFiles(cfg.Destination, entry.DataFile, ""); err != nil {
+			return fmt.Errorf("cannot remove data file of dropped entry: %w", err)
+		}
+	}
+
+	toc := dump.BuildToc()
+	if err := linkUntouchedDataFiles(cfg, toc); err != nil {
+		return err
+	}
+
+	if cfg.Output.Compression != "" {
+		if err := recompressDataFiles(cfg, dump); err != nil {
+			return err
+		}
+	}
+
+	if err := setHeaderCompression(&toc.Header, cfg.Output); err != nil {
+		return err
+	}
+
+	tocPath := filepath.Join(cfg.Destination, cfg.TocFile)
+	if err := WriteTocFile(tocPath, toc); err != nil {
+		return fmt.Errorf("cannot write TOC: %w", err)
+	}
+	log.Printf("[INFO] TOC written: %s", tocPath)
+	return nil
+}
+
+// linkUntouchedDataFiles makes the destination complete: the data files of the TOC which
+// are missing in the destination, as no task rewrote them, are linked from the source.
+func linkUntouchedDataFiles(cfg *config.Config, toc *Toc) error {
+	for _, entry := range toc.Entries {
+		if entry.DataFile == "" {
+			continue
+		}
+		if _, err := findDataFile(cfg.Destination, entry.DataFile); err == nil {
+			continue
+		}
+		fname, err := findDataFile(cfg.Source, entry.DataFile)
+		if err != nil {
+			return err
 		}
+		if err := linkFile(
+			filepath.Join(cfg.Source, fname), filepath.Join(cfg.Destination, fname),
+		); err != nil {
+			return fmt.Errorf("cannot link untouched data file %s: %w", fname, err)
+		}
+		log.Printf("[DEBUG] Untouched data file %s is linked from the source", fname)
 	}
 	return nil
 }
 
-// loadTableMeta populates table metadata into existing Entities.
-func loadTableMeta(cfg *config.Config, dump *Dump) error {
-	tables, err := LoadTableMetaFromFile(filepath.Join(cfg.Source, cfg.TocFile))
+// linkFile hard-links the file, or copies it when the directories are on different devices.
+func linkFile(src, dest string) error {
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
 	if err != nil {
-		return fmt.Errorf("cannot load table metadata: %w", err)
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// recompressDataFiles makes sure every data file in the destination is written
+// with the output compression. Files that were not rewritten by tasks
+// (e.g. synced from the source) are recompressed.
+func recompressDataFiles(cfg *config.Config, dump *Dump) error {
+	codec, err := dumpio.CodecByName(cfg.Output.Compression)
+	if err != nil {
+		return err
+	}
+
+	for _, entity := range dump.Entities {
+		if entity.Meta.Desc != TABLE_DATA || dump.IsDropped(entity.Id) {
+			continue
+		}
+
+		name := entity.dataFileName()
+		target := name + codec.Extension()
+		if _, err := os.Stat(filepath.Join(cfg.Destination, target)); err == nil {
+			if err := removeDataFiles(cfg.Destination, name, target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fname, err := findDataFile(cfg.Destination, name)
+		if err != nil {
+			log.Printf("[DEBUG] Data file %s is missing in destination, skip recompression", name)
+			continue
+		}
+
+		log.Printf("[DEBUG] Recompress data file %s to %s", fname, target)
+		if err := recompressDataFile(cfg, fname, target, codec); err != nil {
+			return fmt.Errorf("cannot recompress data file %s: %w", fname, err)
+		}
+		if err := removeDataFiles(cfg.Destination, name, target); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+func recompressDataFile(cfg *config.Config, fname, target string, codec dumpio.Codec) error {
+	srcPath := filepath.Join(cfg.Destination, fname)
+	reader := dumpio.NewDetectingReader(dumpio.NewSourceFileHandler(srcPath, srcPath))
+	if err := reader.Open(); err != nil {
+		return err
+	}
+	defer reader.Close()
 
-	for _, table := range tables {
-		entity, exists := dump.Entities[table.Name]
-		if !exists {
-			return fmt.Errorf("cannot find entity for table: %s", table.Name)
+	writer := dumpio.NewCodecWriter(
+		codec,
+		cfg.Output.Level,
+		dumpio.NewDestinationFileHandler(filepath.Join(cfg.Destination, target)),
+	)
+	if err := writer.Open(); err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Abort()
+		return err
+	}
+	return writer.Close()
+}
+
+// removeDataFiles removes the data file with every compression suffix except keep.
+func removeDataFiles(dir, name, keep string) error {
+	for _, suffix := range dataFileSuffixes {
+		if name+suffix == keep {
+			continue
+		}
+		path := filepath.Join(dir, name+suffix)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot remove data file: %w", err)
+		} else if err == nil {
+			log.Printf("[DEBUG] Removed data file: %s", path)
 		}
-		entity.Table = table
 	}
 	return nil
 }
 
-// loadEntityData initializes data based on compression configuration.
+// loadEntityData initializes data handlers of entities. The compression of each
+// data file is detected from its extension, the same way pg_restore does.
+// Rewritten files are written with the output compression.
 func loadEntityData(cfg *config.Config, dump *Dump) error {
-	switch cfg.Compression {
-	case config.GZIP_COMPRESSION:
-		for _, entity := range dump.Entities {
-			if entity.Meta.Desc == TABLE_DATA {
-				entity.DumpHandler = dumpio.NewGzipDumpHandler(
-					cfg.Source,
-					cfg.Destination,
-					fmt.Sprintf("%d.dat.gz", entity.Id),
-				)
-			}
+	for _, entity := range dump.Entities {
+		if entity.Meta.Desc != TABLE_DATA {
+			continue
 		}
-	default:
-		return fmt.Errorf("unknown compression type: %s", cfg.Compression)
+
+		fname, err := findDataFile(cfg.Source, entity.dataFileName())
+		if err != nil {
+			return err
+		}
+
+		codec := dumpio.CodecByFileName(fname)
+		if cfg.Compression != "" && codec.Name() != cfg.Compression {
+			log.Printf(
+				"[WARN] Data file %s is compressed with %s instead of %s",
+				fname,
+				codec.Name(),
+				cfg.Compression,
+			)
+		}
+
+		outCodec, err := outputCodec(cfg, codec)
+		if err != nil {
+			return err
+		}
+		entity.DumpHandler = dumpio.NewFileDumpHandler(
+			filepath.Join(cfg.Source, fname),
+			filepath.Join(cfg.Destination, entity.dataFileName()+outCodec.Extension()),
+			outCodec,
+			cfg.Output.Level,
+		)
 	}
 	return nil
 }
+
+// findDataFile returns the name of the data file with the compression suffix.
+func findDataFile(dir, name string) (string, error) {
+	for _, suffix := range dataFileSuffixes {
+		_, err := os.Stat(filepath.Join(dir, name+suffix))
+		if err == nil {
+			return name + suffix, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("stat error on data file: %w", err)
+		}
+	}
+	return "", fmt.Errorf("data file %s not found in %s", name, dir)
+}
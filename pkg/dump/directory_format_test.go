@@ -0,0 +1,149 @@
+package dump
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+const directoryTestData = "1\tfoo\n2\tbar\n\\.\n\n"
+
+func buildDirectoryDump(t *testing.T, dir string, codec dumpio.Codec) {
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	tocPath := filepath.Join(dir, config.DEFAULT_TOC_FILE)
+	require.NoError(t, os.WriteFile(tocPath, buildTestToc(DIRECTORY_ARCHIVE, 15), 0o644))
+
+	file, err := os.Create(filepath.Join(dir, "30.dat"+codec.Extension()))
+	require.NoError(t, err)
+	defer file.Close()
+
+	w, err := codec.NewWriter(file, dumpio.DEFAULT_LEVEL)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, directoryTestData)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func directoryTestConfig(src, dest string) *config.Config {
+	return &config.Config{
+		Source:      src,
+		Destination: dest,
+		TocFile:     config.DEFAULT_TOC_FILE,
+		Format:      config.DIRECTORY_FORMAT,
+	}
+}
+
+func TestLoadDirectoryDump_DetectsCompression(t *testing.T) {
+	for _, codec := range dumpio.Codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src")
+			dest := filepath.Join(dir, "dest")
+			require.NoError(t, os.MkdirAll(dest, 0o755))
+			buildDirectoryDump(t, src, codec)
+
+			dump, err := LoadDump(directoryTestConfig(src, dest))
+			require.NoError(t, err)
+			assert.Equal(t, directoryTestData, readTableData(t, dump, "test_table"))
+
+			// rewritten data is written with the same compression
+			entity, err := dump.GetTable("test_table")
+			require.NoError(t, err)
+			writer := entity.DumpHandler.GetWriter()
+			require.NoError(t, writer.Open())
+			_, err = writer.Write([]byte("3\tbaz\n\\.\n\n"))
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			assert.FileExists(t, filepath.Join(dest, "30.dat"+codec.Extension()))
+			assert.Equal(t, "3\tbaz\n\\.\n\n", readTableData(t, dump, "test_table"))
+		})
+	}
+}
+
+func TestLoadDirectoryDump_MissingDataFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	buildDirectoryDump(t, src, dumpio.GzipCodec)
+	require.NoError(t, os.Remove(filepath.Join(src, "30.dat.gz")))
+
+	_, err := LoadDump(directoryTestConfig(src, filepath.Join(dir, "dest")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "data file 30.dat not found")
+}
+
+func TestSaveDirectoryDump_OutputCompression(t *testing.T) {
+	t.Run("rewritten file", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		dest := filepath.Join(dir, "dest")
+		require.NoError(t, os.MkdirAll(dest, 0o755))
+		buildDirectoryDump(t, src, dumpio.GzipCodec)
+
+		cfg := directoryTestConfig(src, dest)
+		cfg.Output = config.Output{Compression: config.ZSTD_COMPRESSION, Level: 19}
+		dump, err := LoadDump(cfg)
+		require.NoError(t, err)
+
+		entity, err := dump.GetTable("test_table")
+		require.NoError(t, err)
+		writer := entity.DumpHandler.GetWriter()
+		require.NoError(t, writer.Open())
+		_, err = writer.Write([]byte("3\tbaz\n\\.\n\n"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		require.NoError(t, SaveDump(cfg, dump))
+
+		assert.FileExists(t, filepath.Join(dest, "30.dat.zst"))
+		assert.NoFileExists(t, filepath.Join(dest, "30.dat.gz"))
+		assert.Equal(t, "3\tbaz\n\\.\n\n", readTableData(t, dump, "test_table"))
+
+		toc, err := ReadTocFile(filepath.Join(dest, config.DEFAULT_TOC_FILE))
+		require.NoError(t, err)
+		assert.Equal(t, COMPRESSION_ZSTD, toc.Header.Compression)
+		assert.Equal(t, "30.dat", toc.Entries[2].DataFile)
+	})
+
+	t.Run("synced file", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		dest := filepath.Join(dir, "dest")
+		buildDirectoryDump(t, src, dumpio.GzipCodec)
+		buildDirectoryDump(t, dest, dumpio.GzipCodec)
+
+		cfg := directoryTestConfig(src, dest)
+		cfg.Output = config.Output{Compression: config.NONE_COMPRESSION}
+		dump, err := LoadDump(cfg)
+		require.NoError(t, err)
+		require.NoError(t, SaveDump(cfg, dump))
+
+		assert.NoFileExists(t, filepath.Join(dest, "30.dat.gz"))
+		data, err := os.ReadFile(filepath.Join(dest, "30.dat"))
+		require.NoError(t, err)
+		assert.Equal(t, directoryTestData, string(data))
+
+		toc, err := ReadTocFile(filepath.Join(dest, config.DEFAULT_TOC_FILE))
+		require.NoError(t, err)
+		assert.Equal(t, COMPRESSION_NONE, toc.Header.Compression)
+	})
+
+	t.Run("unsupported by archive version", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		buildDirectoryDump(t, src, dumpio.GzipCodec)
+		tocPath := filepath.Join(src, config.DEFAULT_TOC_FILE)
+		require.NoError(t, os.WriteFile(tocPath, buildTestToc(DIRECTORY_ARCHIVE, 14), 0o644))
+
+		cfg := directoryTestConfig(src, filepath.Join(dir, "dest"))
+		cfg.Output = config.Output{Compression: config.LZ4_COMPRESSION}
+		_, err := LoadDump(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "requires archive version 1.15")
+	})
+}
@@ -0,0 +1,155 @@
+package dump
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// DropTable removes the table with the given name from the dump together
+// with its data, owned sequences and every TOC entry depending on them
+// (indexes, constraints, foreign keys, sequence values, comments, etc.).
+func (d *Dump) DropTable(name string) error {
+	entity, err := d.GetTable(name)
+	if err != nil {
+		return err
+	}
+	if d.Toc == nil {
+		return fmt.Errorf("dump has no TOC, cannot drop %s", name)
+	}
+
+	table := d.findTocEntry(TABLE, entity.Meta.Schema, entity.Meta.Name)
+	if table == nil {
+		return fmt.Errorf("cannot find TABLE entry for %s", name)
+	}
+
+	if d.dropped == nil {
+		d.dropped = make(map[int]struct{})
+	}
+	d.dropped[table.DumpId] = struct{}{}
+	d.dropped[entity.Id] = struct{}{}
+
+	for _, seq := range d.ownedSequences(table) {
+		d.dropped[seq] = struct{}{}
+	}
+
+	// Drop everything depending on dropped entries until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, entry := range d.Toc.Entries {
+			if d.IsDropped(entry.DumpId) {
+				continue
+			}
+			for _, dep := range entry.Dependencies {
+				if d.IsDropped(dep) {
+					log.Printf("[DEBUG] Drop dependent entry: %d %s %s", entry.DumpId, entry.Desc, entry.Tag)
+					d.dropped[entry.DumpId] = struct{}{}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// IsDropped reports whether the TOC entry with the given dump id was dropped.
+func (d *Dump) IsDropped(dumpId int) bool {
+	_, ok := d.dropped[dumpId]
+	return ok
+}
+
+// BuildToc returns a copy of the source TOC without the dropped entries.
+// Entries depending on a dropped entry are dropped as well, so the kept
+// entries never reference a missing one.
+func (d *Dump) BuildToc() *Toc {
+	toc := &Toc{
+		Header:  d.Toc.Header,
+		Entries: make([]*TocEntry, 0, len(d.Toc.Entries)),
+	}
+	for _, entry := range d.Toc.Entries {
+		if d.IsDropped(entry.DumpId) {
+			continue
+		}
+		newEntry := *entry
+		toc.Entries = append(toc.Entries, &newEntry)
+	}
+	return toc
+}
+
+// DroppedEntries returns the dropped TOC entries in TOC order.
+func (d *Dump) DroppedEntries() []*TocEntry {
+	var entries []*TocEntry
+	if d.Toc == nil {
+		return entries
+	}
+	for _, entry := range d.Toc.Entries {
+		if d.IsDropped(entry.DumpId) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (d *Dump) findTocEntry(desc EntityDescType, schema, tag string) *TocEntry {
+	for _, entry := range d.Toc.Entries {
+		if entry.Desc == desc && entry.Namespace == schema && entry.Tag == tag {
+			return entry
+		}
+	}
+	return nil
+}
+
+// ownedSequences returns the dump ids of sequences owned by the table.
+func (d *Dump) ownedSequences(table *TocEntry) []int {
+	var sequences []int
+	for _, entry := range d.Toc.Entries {
+		switch entry.Desc {
+		case SEQUENCE_OWNED_BY:
+			// example: "ALTER SEQUENCE public.test_table_id_seq OWNED BY public.test_table.id;"
+			_, owner, found := strings.Cut(entry.Defn, " OWNED BY ")
+			if !found || !hasQualifiedPrefix(owner, table.Namespace, table.Tag) {
+				continue
+			}
+			for _, dep := range entry.Dependencies {
+				if seq := d.tocEntryById(dep); seq != nil && seq.Desc == SEQUENCE {
+					sequences = append(sequences, seq.DumpId)
+				}
+			}
+		case SEQUENCE:
+			// identity sequences are defined with "ALTER TABLE <table> ALTER COLUMN ..."
+			if hasQualifiedPrefix(
+				strings.TrimPrefix(entry.Defn, "ALTER TABLE "),
+				table.Namespace,
+				table.Tag,
+			) {
+				sequences = append(sequences, entry.DumpId)
+			}
+		}
+	}
+	return sequences
+}
+
+func (d *Dump) tocEntryById(dumpId int) *TocEntry {
+	for _, entry := range d.Toc.Entries {
+		if entry.DumpId == dumpId {
+			return entry
+		}
+	}
+	return nil
+}
+
+// hasQualifiedPrefix checks whether s starts with the optionally quoted "schema.name."
+// or "schema.name " qualified identifier.
+func hasQualifiedPrefix(s, schema, name string) bool {
+	s = strings.TrimPrefix(s, "ONLY ")
+	for _, sch := range []string{schema, `"` + schema + `"`} {
+		for _, n := range []string{name, `"` + name + `"`} {
+			prefix := sch + "." + n
+			if strings.HasPrefix(s, prefix+".") || strings.HasPrefix(s, prefix+" ") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package dump
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+func buildDropTestDump(t *testing.T) *Dump {
+	toc := &Toc{
+		Header: ArchiveHeader{
+			VersionMajor: 1,
+			VersionMinor: 15,
+			IntSize:      4,
+			OffSize:      8,
+			Format:       DIRECTORY_ARCHIVE,
+		},
+		Entries: []*TocEntry{
+			{DumpId: 1, Desc: TABLE, Namespace: "public", Tag: "users"},
+			{DumpId: 2, Desc: SEQUENCE, Namespace: "public", Tag: "users_id_seq"},
+			{
+				DumpId:       3,
+				Desc:         SEQUENCE_OWNED_BY,
+				Namespace:    "public",
+				Tag:          "users_id_seq",
+				Defn:         "ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;\n",
+				Dependencies: []int{2},
+			},
+			{DumpId: 4, Desc: TABLE, Namespace: "public", Tag: "orders"},
+			{
+				DumpId:       5,
+				Desc:         DEFAULT,
+				Namespace:    "public",
+				Tag:          "users id",
+				Dependencies: []int{1, 2},
+			},
+			{
+				DumpId:       6,
+				Desc:         TABLE_DATA,
+				Namespace:    "public",
+				Tag:          "users",
+				CopyStmt:     "COPY public.users (id, name) FROM stdin;\n",
+				DataFile:     "6.dat",
+				Dependencies: []int{1},
+			},
+			{
+				DumpId:       7,
+				Desc:         TABLE_DATA,
+				Namespace:    "public",
+				Tag:          "orders",
+				CopyStmt:     "COPY public.orders (id, user_id) FROM stdin;\n",
+				DataFile:     "7.dat",
+				Dependencies: []int{4},
+			},
+			{DumpId: 8, Desc: SEQUENCE_SET, Tag: "users_id_seq", Dependencies: []int{2}},
+			{DumpId: 9, Desc: CONSTRAINT, Tag: "users users_pkey", Dependencies: []int{1}},
+			{DumpId: 10, Desc: INDEX, Tag: "users_name_idx", Dependencies: []int{1}},
+			{
+				DumpId:       11,
+				Desc:         FK_CONSTRAINT,
+				Namespace:    "public",
+				Tag:          "orders orders_user_id_fkey",
+				Dependencies: []int{4, 9},
+			},
+			{DumpId: 12, Desc: CONSTRAINT, Tag: "orders orders_pkey", Dependencies: []int{4}},
+		},
+	}
+
+	dump, err := newDumpFromToc(toc)
+	require.NoError(t, err)
+	return dump
+}
+
+func tocEntryIds(toc *Toc) []int {
+	ids := make([]int, 0, len(toc.Entries))
+	for _, entry := range toc.Entries {
+		ids = append(ids, entry.DumpId)
+	}
+	return ids
+}
+
+func TestDropTable(t *testing.T) {
+	dump := buildDropTestDump(t)
+
+	require.NoError(t, dump.DropTable("users"))
+
+	assert.Equal(t, []int{4, 7, 12}, tocEntryIds(dump.BuildToc()))
+	assert.Equal(
+		t,
+		[]int{1, 2, 3, 5, 6, 8, 9, 10, 11},
+		tocEntryIds(&Toc{Entries: dump.DroppedEntries()}),
+	)
+
+	_, err := dump.GetTable("users")
+	assert.ErrorContains(t, err, "dropped")
+
+	_, err = dump.GetTable("orders")
+	assert.NoError(t, err)
+}
+
+func TestDropTable_UnknownTable(t *testing.T) {
+	dump := buildDropTestDump(t)
+
+	err := dump.DropTable("unknown")
+	assert.Error(t, err)
+	assert.Len(t, dump.BuildToc().Entries, 12)
+}
+
+func TestSaveDirectoryDump(t *testing.T) {
+	dump := buildDropTestDump(t)
+	cfg := &config.Config{
+		Format:      config.DIRECTORY_FORMAT,
+		Destination: t.TempDir(),
+		TocFile:     config.DEFAULT_TOC_FILE,
+	}
+
+	for _, name := range []string{"6.dat.gz", "7.dat.gz"} {
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Destination, name), []byte("data"), 0o644))
+	}
+
+	require.NoError(t, dump.DropTable("users"))
+	require.NoError(t, SaveDump(cfg, dump))
+
+	assert.NoFileExists(t, filepath.Join(cfg.Destination, "6.dat.gz"))
+	assert.FileExists(t, filepath.Join(cfg.Destination, "7.dat.gz"))
+
+	toc, err := ReadTocFile(filepath.Join(cfg.Destination, config.DEFAULT_TOC_FILE))
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 7, 12}, tocEntryIds(toc))
+	assert.Equal(t, "7.dat", toc.Entries[1].DataFile)
+}
+
+func TestSaveDirectoryDump_RestoreAfterDrop(t *testing.T) {
+	// GIVEN: A dump with a comment on the foreign key referencing the users primary key,
+	// so the comment depends on the users table transitively.
+	dump := buildDropTestDump(t)
+	dump.Toc.Entries = append(dump.Toc.Entries, &TocEntry{
+		DumpId:       13,
+		Desc:         COMMENT,
+		Namespace:    "public",
+		Tag:          "CONSTRAINT orders_user_id_fkey ON orders",
+		Dependencies: []int{11},
+	})
+	cfg := &config.Config{
+		Format:      config.DIRECTORY_FORMAT,
+		Destination: t.TempDir(),
+		TocFile:     config.DEFAULT_TOC_FILE,
+	}
+	for _, name := range []string{"6.dat.gz", "7.dat.gz"} {
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Destination, name), []byte("data"), 0o644))
+	}
+
+	// WHEN: The users table is dropped and the dump is saved.
+	require.NoError(t, dump.DropTable("users"))
+	require.NoError(t, SaveDump(cfg, dump))
+
+	// THEN: The written dump can be restored, as pg_restore does: every dependency
+	// of the kept entries is in the TOC and every data file exists.
+	toc, err := ReadTocFile(filepath.Join(cfg.Destination, config.DEFAULT_TOC_FILE))
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 7, 12}, tocEntryIds(toc))
+
+	kept := make(map[int]bool)
+	for _, entry := range toc.Entries {
+		kept[entry.DumpId] = true
+	}
+	for _, entry := range toc.Entries {
+		for _, dep := range entry.Dependencies {
+			assert.True(t, kept[dep], "entry %d depends on the missing entry %d", entry.DumpId, dep)
+		}
+		if entry.DataFile != "" {
+			_, err := findDataFile(cfg.Destination, entry.DataFile)
+			assert.NoError(t, err)
+		}
+	}
+}
@@ -10,6 +10,12 @@ import (
 // Dump represents a collection of Entities loaded from the dump metadata.
 type Dump struct {
 	Entities map[string]*Entity
+	Toc      *Toc
+
+	dropped     map[int]struct{} // dump ids of dropped TOC entries
+	stagingDir  string           // rewritten data of single-file archives
+	script      string           // uncompressed plain script COPY blocks are read from
+	foreignKeys []*ForeignKey
 }
 
 // GetTable retrieves an entity by name and ensures it's a table.
@@ -21,14 +27,28 @@ func (d *Dump) GetTable(name string) (*Entity, error) {
 	if !entity.IsTable() {
 		return nil, fmt.Errorf("entity %s is not a table", name)
 	}
+	if d.IsDropped(entity.Id) {
+		return nil, fmt.Errorf("entity %s was dropped", name)
+	}
 	return entity, nil
 }
 
+// DiscardWrites makes commands read the table data without writing it, e.g. for a dry run.
+// It must be called before the commands are built.
+func (d *Dump) DiscardWrites() {
+	for _, entity := range d.Entities {
+		if entity.DumpHandler != nil {
+			entity.DumpHandler = dumpio.NewDiscardDumpHandler(entity.DumpHandler)
+		}
+	}
+}
+
 // Entity represents an entity from the dump.
 type Entity struct {
 	Id          int
 	Meta        EntityMeta
 	Table       *TableMeta
+	TocEntry    *TocEntry
 	DumpHandler dumpio.DumpHandler
 }
 
@@ -37,6 +57,14 @@ func (e *Entity) IsTable() bool {
 	return e.Table != nil
 }
 
+// dataFileName returns the name of the entity data file without compression suffix.
+func (e *Entity) dataFileName() string {
+	if e.TocEntry != nil && e.TocEntry.DataFile != "" {
+		return e.TocEntry.DataFile
+	}
+	return fmt.Sprintf("%d.dat", e.Id)
+}
+
 // GetColumn retrieves a column by name from a table entity.
 func (e *Entity) GetColumn(name string) (*ColumnMeta, error) {
 	if !e.IsTable() {
@@ -55,7 +83,29 @@ func LoadDump(cfg *config.Config) (*Dump, error) {
 	switch cfg.Format {
 	case config.DIRECTORY_FORMAT:
 		return loadDirectoryDump(cfg)
+	case config.CUSTOM_FORMAT:
+		return loadCustomDump(cfg)
+	case config.TAR_FORMAT:
+		return loadTarDump(cfg)
+	case config.PLAIN_FORMAT:
+		return loadPlainDump(cfg)
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", cfg.Format)
 	}
 }
+
+// SaveDump writes the dump metadata to the destination based on the given configuration.
+func SaveDump(cfg *config.Config, dump *Dump) error {
+	switch cfg.Format {
+	case config.DIRECTORY_FORMAT:
+		return saveDirectoryDump(cfg, dump)
+	case config.CUSTOM_FORMAT:
+		return saveCustomDump(cfg, dump)
+	case config.TAR_FORMAT:
+		return saveTarDump(cfg, dump)
+	case config.PLAIN_FORMAT:
+		return savePlainDump(cfg, dump)
+	default:
+		return fmt.Errorf("unsupported format: %s", cfg.Format)
+	}
+}
@@ -0,0 +1,149 @@
+package dumpio
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Codec describes the compression method of dump data files.
+type Codec interface {
+	// Name returns the compression name as used in the config.
+	Name() string
+	// Extension returns the file name suffix added by pg_dump, e.g. ".gz".
+	Extension() string
+	// MaxLevel returns the maximum compression level, 0 if levels are not supported.
+	MaxLevel() int
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	// NewWriter creates a compressing writer, DEFAULT_LEVEL selects the codec default level.
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+// DEFAULT_LEVEL selects the default compression level of a codec.
+const DEFAULT_LEVEL = 0
+
+var (
+	NoneCodec Codec = noneCodec{}
+	GzipCodec Codec = gzipCodec{}
+	Lz4Codec  Codec = lz4Codec{}
+	ZstdCodec Codec = zstdCodec{}
+)
+
+// Codecs lists all supported codecs.
+var Codecs = []Codec{NoneCodec, GzipCodec, Lz4Codec, ZstdCodec}
+
+// CodecByName returns the codec with the given config name.
+func CodecByName(name string) (Codec, error) {
+	for _, codec := range Codecs {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown compression: %s", name)
+}
+
+// CodecByFileName detects the codec from the file name extension.
+// Files without a known compression extension are treated as uncompressed.
+func CodecByFileName(fname string) Codec {
+	for _, codec := range Codecs {
+		if codec.Extension() != "" && strings.HasSuffix(fname, codec.Extension()) {
+			return codec
+		}
+	}
+	return NoneCodec
+}
+
+type noneCodec struct{}
+
+func (noneCodec) Name() string      { return "none" }
+func (noneCodec) Extension() string { return "" }
+func (noneCodec) MaxLevel() int     { return 0 }
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+func (noneCodec) NewWriter(w io.Writer, _ int) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string      { return "gzip" }
+func (gzipCodec) Extension() string { return ".gz" }
+func (gzipCodec) MaxLevel() int     { return gzip.BestCompression }
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (gzipCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == DEFAULT_LEVEL {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+type lz4Codec struct{}
+
+func (lz4Codec) Name() string      { return "lz4" }
+func (lz4Codec) Extension() string { return ".lz4" }
+func (lz4Codec) MaxLevel() int     { return 9 }
+
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
+
+// lz4Levels maps the levels 1..9 to the lz4 compression levels.
+var lz4Levels = []lz4.CompressionLevel{
+	lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5,
+	lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
+func (lz4Codec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	writer := lz4.NewWriter(w)
+	if level != DEFAULT_LEVEL {
+		if level < 1 || level > len(lz4Levels) {
+			return nil, fmt.Errorf("invalid lz4 compression level: %d", level)
+		}
+		option := lz4.CompressionLevelOption(lz4Levels[level-1])
+		if err := writer.Apply(option); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string      { return "zstd" }
+func (zstdCodec) Extension() string { return ".zst" }
+func (zstdCodec) MaxLevel() int     { return 22 }
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func (zstdCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == DEFAULT_LEVEL {
+		return zstd.NewWriter(w)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+}
+
+// nopWriteCloser adds a no-op Close method to io.Writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
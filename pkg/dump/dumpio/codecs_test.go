@@ -0,0 +1,40 @@
+package dumpio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs_Levels(t *testing.T) {
+	data := []byte(strings.Repeat("1\tName1\t1@test.com\t11\n", 1000))
+
+	for _, codec := range []Codec{GzipCodec, Lz4Codec, ZstdCodec} {
+		for level := DEFAULT_LEVEL; level <= min(codec.MaxLevel(), 9); level++ {
+			t.Run(fmt.Sprintf("%s level %d", codec.Name(), level), func(t *testing.T) {
+				// GIVEN: Data written at the level.
+				var buf bytes.Buffer
+				writer, err := codec.NewWriter(&buf, level)
+				require.NoError(t, err)
+				_, err = writer.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, writer.Close())
+
+				// THEN: It is read back unchanged.
+				reader, err := codec.NewReader(&buf)
+				require.NoError(t, err)
+				out, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				assert.Equal(t, data, out)
+			})
+		}
+	}
+
+	_, err := Lz4Codec.NewWriter(io.Discard, 10)
+	assert.ErrorContains(t, err, "invalid lz4 compression level: 10")
+}
@@ -12,9 +12,11 @@ type DumpReader interface {
 }
 
 // DumpWriter defines an interface for writing data with the ability to open and close resources.
+// Close commits the written data, Abort closes the resources and discards it.
 type DumpWriter interface {
 	io.WriteCloser
 	Open() error
+	Abort() error
 }
 
 // DumpHandler represents a dump data handler with both reading and writing capabilities.
@@ -23,51 +25,111 @@ type DumpHandler interface {
 	GetWriter() DumpWriter
 }
 
-// GzipDumpHandler implements the DumpHandler interface for handling gzip-compressed files.
-type GzipDumpHandler struct {
-	srcDir  string
-	destDir string
-	fname   string
+// FileDumpHandler implements the DumpHandler interface for handling data files
+// of directory dumps. The source file is read with the codec detected from its name,
+// while the destination file is written with the given Codec.
+type FileDumpHandler struct {
+	srcPath  string
+	destPath string
 
 	reader DumpReader
 	writer DumpWriter
 }
 
-// NewGzipDumpHandler creates a new GzipDumpHandler instance, initializing its reader and writer.
+// NewFileDumpHandler creates a new FileDumpHandler instance, initializing its reader and writer.
 // It sets up file handlers for both source and destination paths.
 //
 // Parameters:
-// - srcDir: Source directory for input files.
-// - destDir: Destination directory for output files.
-// - fname: File name to process.
+// - srcPath: Path of the source data file.
+// - destPath: Path of the destination data file.
+// - codec: Codec the destination file is compressed with.
+// - level: Compression level of the destination file, DEFAULT_LEVEL for the codec default.
 //
 // Returns:
-// - DumpHandler: A GzipDumpHandler instance implementing the DumpHandler interface.
+// - DumpHandler: A FileDumpHandler instance implementing the DumpHandler interface.
+func NewFileDumpHandler(srcPath, destPath string, codec Codec, level int) DumpHandler {
+	sourceHandler := NewSourceFileHandler(srcPath, destPath)
+	reader := NewDetectingReader(sourceHandler)
+
+	destinationHandler := NewDestinationFileHandler(destPath)
+	writer := NewCodecWriter(codec, level, destinationHandler)
+
+	return &FileDumpHandler{
+		srcPath:  srcPath,
+		destPath: destPath,
+		reader:   reader,
+		writer:   writer,
+	}
+}
+
+// NewGzipDumpHandler creates a new FileDumpHandler instance for gzip-compressed files.
 func NewGzipDumpHandler(srcDir, destDir, fname string) DumpHandler {
-	// Initialize source and destination handlers with file paths
-	sourcePath := filepath.Join(srcDir, fname)
-	destPath := filepath.Join(destDir, fname)
+	return NewFileDumpHandler(
+		filepath.Join(srcDir, fname),
+		filepath.Join(destDir, fname),
+		GzipCodec,
+		DEFAULT_LEVEL,
+	)
+}
+
+func (h *FileDumpHandler) GetReader() DumpReader {
+	return h.reader
+}
 
-	sourceHandler := NewSourceFileHandler(sourcePath, destPath)
-	reader := NewGzipReader(sourceHandler)
+func (h *FileDumpHandler) GetWriter() DumpWriter {
+	return h.writer
+}
 
-	destinationHandler := NewDestinationFileHandler(destPath)
-	writer := NewGzipWriter(destinationHandler)
-
-	return &GzipDumpHandler{
-		srcDir:  srcDir,
-		destDir: destDir,
-		fname:   fname,
-		reader:  reader,
-		writer:  writer,
+// StagedDumpHandler implements the DumpHandler interface for entities stored inside
+// a single-file archive. Rewritten data is staged to a gzip-compressed file,
+// which is read instead of the archive by subsequent commands.
+type StagedDumpHandler struct {
+	reader DumpReader
+	writer DumpWriter
+}
+
+// NewStagedDumpHandler creates a new StagedDumpHandler instance.
+//
+// Parameters:
+// - stagedPath: Path of the staged copy of the entity data.
+// - openSource: Function opening the original entity data in the archive.
+//
+// Returns:
+// - DumpHandler: A StagedDumpHandler instance implementing the DumpHandler interface.
+func NewStagedDumpHandler(stagedPath string, openSource SourceOpener) DumpHandler {
+	return &StagedDumpHandler{
+		reader: NewStagedReader(stagedPath, openSource),
+		writer: NewGzipWriter(NewDestinationFileHandler(stagedPath)),
 	}
 }
 
-func (h *GzipDumpHandler) GetReader() DumpReader {
+func (h *StagedDumpHandler) GetReader() DumpReader {
 	return h.reader
 }
 
-func (h *GzipDumpHandler) GetWriter() DumpWriter {
+func (h *StagedDumpHandler) GetWriter() DumpWriter {
+	return h.writer
+}
+
+// DiscardDumpHandler reads the data of the wrapped handler and discards the rewritten data.
+type DiscardDumpHandler struct {
+	handler DumpHandler
+	writer  DumpWriter
+}
+
+// NewDiscardDumpHandler wraps the handler, so the data is never written.
+func NewDiscardDumpHandler(handler DumpHandler) DumpHandler {
+	return &DiscardDumpHandler{
+		handler: handler,
+		writer:  &DiscardWriter{},
+	}
+}
+
+func (h *DiscardDumpHandler) GetReader() DumpReader {
+	return h.handler.GetReader()
+}
+
+func (h *DiscardDumpHandler) GetWriter() DumpWriter {
 	return h.writer
 }
 
@@ -13,6 +13,7 @@ import (
 type FileHandler interface {
 	GetFile() (*os.File, error)
 	Close(*os.File) error
+	Abort(*os.File) error
 }
 
 // DestinationFileHandler handles destination files that might already exist.
@@ -83,6 +84,18 @@ func (h *DestinationFileHandler) Close(file *os.File) error {
 	return nil
 }
 
+// Abort closes the file and removes it, the original file is left untouched.
+func (h *DestinationFileHandler) Abort(file *os.File) error {
+	if err := file.Close(); err != nil {
+		log.Printf("[ERROR] Could not close file %s: %v", file.Name(), err)
+	}
+	if err := os.Remove(file.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot remove file %q: %w", file.Name(), err)
+	}
+	log.Printf("[DEBUG] Written file discarded: %s", file.Name())
+	return nil
+}
+
 // tempFileName builds a name for the temporary file based on the existing destPath.
 func (h *DestinationFileHandler) tempFileName() string {
 	dir, name := filepath.Split(h.destPath)
@@ -134,3 +147,8 @@ func (h *SourceFileHandler) Close(file *os.File) error {
 	}
 	return nil
 }
+
+// Abort closes the file, the source is never written.
+func (h *SourceFileHandler) Abort(file *os.File) error {
+	return h.Close(file)
+}
@@ -9,6 +9,24 @@ type DumpWriter struct {
 	mock.Mock
 }
 
+// Abort provides a mock function with no fields
+func (_m *DumpWriter) Abort() error {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Abort")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Close provides a mock function with no fields
 func (_m *DumpWriter) Close() error {
 	ret := _m.Called()
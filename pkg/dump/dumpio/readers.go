@@ -2,37 +2,53 @@ package dumpio
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-
-	"github.com/klauspost/compress/gzip"
 )
 
-// GzipReader is responsible for reading gzip-compressed files.
+// CodecReader is responsible for reading compressed files.
 // It wraps around a FileHandler for file management and provides
-// reading capabilities via an io.ReadCloser.
-type GzipReader struct {
+// reading capabilities via an io.ReadCloser created by the Codec.
+// Without a Codec, it is detected from the name of the opened file.
+type CodecReader struct {
+	codec      Codec
 	srcHandler FileHandler
 	file       *os.File
 	reader     io.ReadCloser
 }
 
-// NewGzipReader creates a new instance of GzipReader with the provided file handler.
+// NewCodecReader creates a new instance of CodecReader with the provided codec and file handler.
 //
 // Parameters:
+// - codec: Codec used to decompress the file.
 // - srcHandler: FileHandler responsible for opening and closing the source file.
 //
 // Returns:
-// - DumpReader: An instance of GzipReader.
-func NewGzipReader(srcHandler FileHandler) DumpReader {
-	return &GzipReader{
+// - DumpReader: An instance of CodecReader.
+func NewCodecReader(codec Codec, srcHandler FileHandler) DumpReader {
+	return &CodecReader{
+		codec:      codec,
+		srcHandler: srcHandler,
+	}
+}
+
+// NewDetectingReader creates a new instance of CodecReader detecting the codec
+// from the name of the file opened by the file handler.
+func NewDetectingReader(srcHandler FileHandler) DumpReader {
+	return &CodecReader{
 		srcHandler: srcHandler,
 	}
 }
 
-func (r *GzipReader) Open() error {
+// NewGzipReader creates a new instance of CodecReader for gzip-compressed files.
+func NewGzipReader(srcHandler FileHandler) DumpReader {
+	return NewCodecReader(GzipCodec, srcHandler)
+}
+
+func (r *CodecReader) Open() error {
 	// Open the source file using the file handler
 	file, err := r.srcHandler.GetFile()
 	if err != nil {
@@ -40,29 +56,33 @@ func (r *GzipReader) Open() error {
 	}
 	r.file = file
 
-	log.Printf("[DEBUG] Opening gzip reader for file %s", file.Name())
+	codec := r.codec
+	if codec == nil {
+		codec = CodecByFileName(file.Name())
+	}
+	log.Printf("[DEBUG] Opening %s reader for file %s", codec.Name(), file.Name())
 
-	// Create a gzip reader from the file
-	reader, err := gzip.NewReader(file)
+	// Create a decompressing reader from the file
+	reader, err := codec.NewReader(file)
 	if err != nil {
-		return fmt.Errorf("cannot create gzip reader: %w", err)
+		return fmt.Errorf("cannot create %s reader: %w", codec.Name(), err)
 	}
 	r.reader = reader
 	return nil
 }
 
-func (r *GzipReader) Read(p []byte) (n int, err error) {
+func (r *CodecReader) Read(p []byte) (n int, err error) {
 	if r.reader == nil {
-		return 0, fmt.Errorf("gzip reader is not initialized, call Open() first")
+		return 0, fmt.Errorf("reader is not initialized, call Open() first")
 	}
 	return r.reader.Read(p)
 }
 
-func (r *GzipReader) Close() error {
-	// Close the gzip reader
+func (r *CodecReader) Close() error {
+	// Close the decompressing reader
 	if r.reader != nil {
 		if err := r.reader.Close(); err != nil {
-			return fmt.Errorf("cannot close gzip reader: %w", err)
+			return fmt.Errorf("cannot close reader: %w", err)
 		}
 	}
 
@@ -93,3 +113,66 @@ func (r *DummyReader) Close() error {
 	r.Buff.Reset()
 	return nil
 }
+
+// SourceOpener opens the original, already decompressed, entity data.
+type SourceOpener func() (io.ReadCloser, error)
+
+// StagedReader reads the staged copy of the entity data if the entity was
+// already rewritten, otherwise it reads the original data using SourceOpener.
+type StagedReader struct {
+	stagedPath string
+	openSource SourceOpener
+	reader     io.ReadCloser
+}
+
+// NewStagedReader creates a new instance of StagedReader.
+//
+// Parameters:
+// - stagedPath: Path of the gzip-compressed staged copy of the entity data.
+// - openSource: Function opening the original entity data.
+//
+// Returns:
+// - DumpReader: An instance of StagedReader.
+func NewStagedReader(stagedPath string, openSource SourceOpener) DumpReader {
+	return &StagedReader{
+		stagedPath: stagedPath,
+		openSource: openSource,
+	}
+}
+
+func (r *StagedReader) Open() error {
+	if _, err := os.Stat(r.stagedPath); err == nil {
+		stagedReader := NewGzipReader(NewSourceFileHandler(r.stagedPath, r.stagedPath))
+		if err := stagedReader.Open(); err != nil {
+			return fmt.Errorf("cannot open staged file: %w", err)
+		}
+		r.reader = stagedReader
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("stat error on staged file %q: %w", r.stagedPath, err)
+	}
+
+	log.Printf("[DEBUG] Opening source reader for staged file %s", r.stagedPath)
+	reader, err := r.openSource()
+	if err != nil {
+		return fmt.Errorf("cannot open source: %w", err)
+	}
+	r.reader = reader
+	return nil
+}
+
+func (r *StagedReader) Read(p []byte) (n int, err error) {
+	if r.reader == nil {
+		return 0, fmt.Errorf("staged reader is not initialized, call Open() first")
+	}
+	return r.reader.Read(p)
+}
+
+func (r *StagedReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
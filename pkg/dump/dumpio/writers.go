@@ -2,35 +2,45 @@ package dumpio
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-
-	"github.com/klauspost/compress/gzip"
 )
 
-// GzipWriter is responsible for writing gzip-compressed data to a file.
-// It manages file access via a FileHandler and uses gzip.DumpWriter for compression.
-type GzipWriter struct {
+// CodecWriter is responsible for writing compressed data to a file.
+// It manages file access via a FileHandler and uses the Codec for compression.
+type CodecWriter struct {
+	codec       Codec          // Codec used to compress data.
+	level       int            // Compression level, DEFAULT_LEVEL for the codec default.
 	destHandler FileHandler    // Handler for managing destination file operations.
 	file        *os.File       // Opened file pointer for writing.
-	writer      io.WriteCloser // Gzip writer for compressing data.
+	writer      io.WriteCloser // Compressing writer.
 }
 
-// NewGzipWriter creates a new instance of GzipWriter with the given file handler.
+// NewCodecWriter creates a new instance of CodecWriter with the given codec and file handler.
 //
 // Parameters:
+// - codec: Codec used to compress the file.
+// - level: Compression level, DEFAULT_LEVEL for the codec default.
 // - destHandler: FileHandler responsible for opening and closing the destination file.
 //
 // Returns:
-// - DumpWriter: An initialized GzipWriter instance.
-func NewGzipWriter(destHandler FileHandler) DumpWriter {
-	return &GzipWriter{
+// - DumpWriter: An initialized CodecWriter instance.
+func NewCodecWriter(codec Codec, level int, destHandler FileHandler) DumpWriter {
+	return &CodecWriter{
+		codec:       codec,
+		level:       level,
 		destHandler: destHandler,
 	}
 }
 
-func (w *GzipWriter) Open() error {
+// NewGzipWriter creates a new instance of CodecWriter for gzip-compressed files.
+func NewGzipWriter(destHandler FileHandler) DumpWriter {
+	return NewCodecWriter(GzipCodec, DEFAULT_LEVEL, destHandler)
+}
+
+func (w *CodecWriter) Open() error {
 	// Open the destination file using the file handler.
 	file, err := w.destHandler.GetFile()
 	if err != nil {
@@ -38,23 +48,34 @@ func (w *GzipWriter) Open() error {
 	}
 	w.file = file
 
-	// Create a gzip writer from the file.
-	w.writer = gzip.NewWriter(w.file)
+	// Create a compressing writer from the file.
+	writer, err := w.codec.NewWriter(w.file, w.level)
+	if err != nil {
+		return fmt.Errorf("cannot create %s writer: %w", w.codec.Name(), err)
+	}
+	w.writer = writer
 	return nil
 }
 
-func (w *GzipWriter) Write(p []byte) (n int, err error) {
+func (w *CodecWriter) Write(p []byte) (n int, err error) {
 	if w.writer == nil {
-		return 0, fmt.Errorf("gzip writer is not initialized, call Open() first")
+		return 0, fmt.Errorf("%s writer is not initialized, call Open() first", w.codec.Name())
 	}
 	return w.writer.Write(p)
 }
 
-func (w *GzipWriter) Close() error {
-	// Close the gzip writer.
+func (w *CodecWriter) Close() error {
+	// Close the compressing writer, the data is truncated if it fails to flush,
+	// so the file is discarded instead of replacing the destination.
 	if w.writer != nil {
 		if err := w.writer.Close(); err != nil {
-			return fmt.Errorf("cannot close gzip writer: %w", err)
+			err = fmt.Errorf("cannot close %s writer: %w", w.codec.Name(), err)
+			if w.file != nil {
+				if abortErr := w.destHandler.Abort(w.file); abortErr != nil {
+					err = errors.Join(err, fmt.Errorf("cannot discard destination file: %w", abortErr))
+				}
+			}
+			return err
 		}
 	}
 
@@ -67,6 +88,20 @@ func (w *GzipWriter) Close() error {
 	return nil
 }
 
+// Abort closes the compressing writer and discards the destination file.
+func (w *CodecWriter) Abort() error {
+	if w.writer != nil {
+		// the data is discarded, so a failure to flush it does not matter
+		w.writer.Close()
+	}
+	if w.file != nil {
+		if err := w.destHandler.Abort(w.file); err != nil {
+			return fmt.Errorf("cannot discard destination file: %w", err)
+		}
+	}
+	return nil
+}
+
 type DummyWriter struct {
 	Buff *bytes.Buffer
 }
@@ -86,3 +121,27 @@ func (w *DummyWriter) Write(p []byte) (n int, err error) {
 func (w *DummyWriter) Close() error {
 	return nil
 }
+
+func (w *DummyWriter) Abort() error {
+	w.Buff = nil
+	return nil
+}
+
+// DiscardWriter discards all written data.
+type DiscardWriter struct{}
+
+func (w *DiscardWriter) Open() error {
+	return nil
+}
+
+func (w *DiscardWriter) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+func (w *DiscardWriter) Close() error {
+	return nil
+}
+
+func (w *DiscardWriter) Abort() error {
+	return nil
+}
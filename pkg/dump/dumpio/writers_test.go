@@ -0,0 +1,79 @@
+package dumpio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecWriter_Abort(t *testing.T) {
+	for _, exists := range []bool{false, true} {
+		// GIVEN: Data written to a destination which may already exist.
+		dir := t.TempDir()
+		dest := filepath.Join(dir, "30.dat")
+		if exists {
+			require.NoError(t, os.WriteFile(dest, []byte("original"), 0o644))
+		}
+		writer := NewCodecWriter(NoneCodec, DEFAULT_LEVEL, NewDestinationFileHandler(dest))
+		require.NoError(t, writer.Open())
+		_, err := writer.Write([]byte("partial"))
+		require.NoError(t, err)
+
+		// WHEN: The writer is aborted.
+		err = writer.Abort()
+
+		// THEN: The written data is discarded and the original file is kept.
+		require.NoError(t, err)
+		assert.NoFileExists(t, filepath.Join(dir, "tmp_30.dat"))
+		if exists {
+			data, err := os.ReadFile(dest)
+			require.NoError(t, err)
+			assert.Equal(t, "original", string(data))
+		} else {
+			assert.NoFileExists(t, dest)
+		}
+	}
+}
+
+// failingCloseCodec flushes nothing on Close, e.g. when the disk is full.
+type failingCloseCodec struct {
+	noneCodec
+}
+
+func (c failingCloseCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return failingCloseWriter{w}, nil
+}
+
+type failingCloseWriter struct {
+	io.Writer
+}
+
+func (w failingCloseWriter) Close() error {
+	return errors.New("no space left on device")
+}
+
+func TestCodecWriter_CloseError(t *testing.T) {
+	// GIVEN: An existing destination and a codec failing to flush on Close.
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "30.dat")
+	require.NoError(t, os.WriteFile(dest, []byte("original"), 0o644))
+	writer := NewCodecWriter(failingCloseCodec{}, DEFAULT_LEVEL, NewDestinationFileHandler(dest))
+	require.NoError(t, writer.Open())
+	_, err := writer.Write([]byte("partial"))
+	require.NoError(t, err)
+
+	// WHEN: The writer is closed.
+	err = writer.Close()
+
+	// THEN: The error is returned, the temp file is removed and the destination is kept.
+	assert.ErrorContains(t, err, "no space left on device")
+	assert.NoFileExists(t, filepath.Join(dir, "tmp_30.dat"))
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+}
@@ -221,6 +221,40 @@ func LoadEntityMetaFromFile(filePath string) ([]*EntityMeta, error) {
 	return metadata, nil
 }
 
+// EntityMetaFromTocEntry builds entity metadata from a binary TOC entry.
+func EntityMetaFromTocEntry(entry *TocEntry) (*EntityMeta, error) {
+	meta := EntityMeta{
+		DumpId: entry.DumpId,
+		Desc:   entry.Desc,
+		Schema: entry.Namespace,
+		Name:   entry.Tag,
+		Owner:  entry.Owner,
+	}
+
+	var err error
+	if entry.TableOID != "" {
+		if meta.TableOID, err = strconv.Atoi(entry.TableOID); err != nil {
+			return nil, fmt.Errorf("TableOID parse error: %w", err)
+		}
+	}
+	if entry.OID != "" {
+		if meta.OID, err = strconv.Atoi(entry.OID); err != nil {
+			return nil, fmt.Errorf("OID parse error: %w", err)
+		}
+	}
+
+	switch entry.Desc {
+	case CONSTRAINT, DEFAULT, FK_CONSTRAINT, TRIGGER:
+		// tag example: "test_table test_table_pkey"
+		if table, name, found := strings.Cut(entry.Tag, " "); found {
+			meta.Table = table
+			meta.Name = name
+		}
+	}
+
+	return &meta, nil
+}
+
 func EntityMetaFromLine(line string) (*EntityMeta, error) {
 	meta := EntityMeta{}
 	err := meta.fromLine(line)
@@ -0,0 +1,169 @@
+package dump
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// ForeignKey is a foreign key constraint from the referencing (child) table
+// to the referenced (parent) table. Column names are written as in COPY statements.
+type ForeignKey struct {
+	Id         int // dump id of the FK CONSTRAINT entry, 0 for plain dumps
+	Name       string
+	Schema     string
+	Table      string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+}
+
+// ParseForeignKey parses the ALTER TABLE statement of a FK CONSTRAINT entry.
+// example:
+//
+//	ALTER TABLE ONLY public.orders
+//	    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id);
+func ParseForeignKey(defn string) (*ForeignKey, error) {
+	words := splitSQL(strings.TrimSuffix(strings.TrimSpace(defn), ";"), ' ')
+
+	tableIdx := slices.Index(words, "TABLE")
+	constraintIdx := slices.Index(words, "CONSTRAINT")
+	foreignIdx := slices.Index(words, "FOREIGN")
+	referencesIdx := slices.Index(words, "REFERENCES")
+	if len(words) < 2 || words[0] != "ALTER" || tableIdx == -1 || foreignIdx == -1 ||
+		referencesIdx == -1 || foreignIdx+2 >= len(words) || referencesIdx+1 >= len(words) {
+		return nil, fmt.Errorf("not a foreign key definition: %q", defn)
+	}
+
+	fk := ForeignKey{}
+	tableIdx++
+	if words[tableIdx] == "ONLY" {
+		tableIdx++
+	}
+	fk.Schema, fk.Table = splitQualifiedName(words[tableIdx])
+	if constraintIdx != -1 && constraintIdx+1 < len(words) {
+		fk.Name = unquoteIdent(words[constraintIdx+1])
+	}
+
+	if words[foreignIdx+1] != "KEY" {
+		return nil, fmt.Errorf("not a foreign key definition: %q", defn)
+	}
+	fk.Columns = splitColumnList(words[foreignIdx+2])
+
+	// the referenced columns usually follow the table name without a space
+	ref := words[referencesIdx+1]
+	refColumns := ""
+	if idx := openParen(ref); idx != -1 {
+		ref, refColumns = ref[:idx], ref[idx:]
+	} else if referencesIdx+2 < len(words) && strings.HasPrefix(words[referencesIdx+2], "(") {
+		refColumns = words[referencesIdx+2]
+	}
+	fk.RefSchema, fk.RefTable = splitQualifiedName(ref)
+	fk.RefColumns = splitColumnList(refColumns)
+
+	if len(fk.Columns) == 0 || len(fk.Columns) != len(fk.RefColumns) {
+		return nil, fmt.Errorf("invalid columns of foreign key %s", fk.Name)
+	}
+	return &fk, nil
+}
+
+// openParen returns the position of the first parenthesis outside of quotes.
+func openParen(s string) int {
+	inIdent := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			inIdent = !inIdent
+		case s[i] == '(' && !inIdent:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitQualifiedName splits "schema.name" into unquoted schema and name.
+func splitQualifiedName(qualifiedName string) (string, string) {
+	parts := splitSQL(qualifiedName, '.')
+	if len(parts) == 0 {
+		return "", ""
+	}
+	name := unquoteIdent(parts[len(parts)-1])
+	if len(parts) == 1 {
+		return "", name
+	}
+	return unquoteIdent(parts[0]), name
+}
+
+// splitColumnList splits "(a, b)" into column names.
+func splitColumnList(list string) []string {
+	list = strings.TrimSpace(list)
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return nil
+	}
+	return splitSQL(list[1:len(list)-1], ',')
+}
+
+// foreignKeysFromToc parses the FK CONSTRAINT entries of the TOC.
+// Constraints which cannot be parsed are skipped.
+func foreignKeysFromToc(toc *Toc) []*ForeignKey {
+	var fks []*ForeignKey
+	for _, entry := range toc.Entries {
+		if entry.Desc != FK_CONSTRAINT {
+			continue
+		}
+		fk, err := ParseForeignKey(entry.Defn)
+		if err != nil {
+			log.Printf("[WARN] Foreign key %s is skipped: %v", entry.Tag, err)
+			continue
+		}
+		fk.Id = entry.DumpId
+		fks = append(fks, fk)
+	}
+	return fks
+}
+
+// GetForeignKeys returns the foreign keys of the dump, except the dropped ones.
+func (d *Dump) GetForeignKeys() []*ForeignKey {
+	fks := make([]*ForeignKey, 0, len(d.foreignKeys))
+	for _, fk := range d.foreignKeys {
+		if fk.Id == 0 || !d.IsDropped(fk.Id) {
+			fks = append(fks, fk)
+		}
+	}
+	return fks
+}
+
+// ErrSchemaMismatch is returned when a table of a foreign key is in another schema
+// than the dumped table of the same name.
+var ErrSchemaMismatch = errors.New("table is in another schema")
+
+// GetForeignKeyTables returns the child and the parent tables of the foreign key.
+// The schemas of the foreign key are checked against the tables when both are known.
+func (d *Dump) GetForeignKeyTables(fk *ForeignKey) (*Entity, *Entity, error) {
+	child, err := d.getSchemaTable(fk.Schema, fk.Table)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, err := d.getSchemaTable(fk.RefSchema, fk.RefTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	return child, parent, nil
+}
+
+func (d *Dump) getSchemaTable(schema, name string) (*Entity, error) {
+	entity, err := d.GetTable(name)
+	if err != nil {
+		return nil, err
+	}
+	if schema != "" && entity.Meta.Schema != "" && schema != entity.Meta.Schema {
+		return nil, fmt.Errorf(
+			"%w: %s.%s, the dumped %s is %s.%s",
+			ErrSchemaMismatch, schema, name, name, entity.Meta.Schema, name,
+		)
+	}
+	return entity, nil
+}
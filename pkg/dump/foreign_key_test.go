@@ -0,0 +1,145 @@
+package dump
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForeignKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		defn     string
+		expected ForeignKey
+	}{
+		{
+			name: "single column",
+			defn: "ALTER TABLE ONLY public.orders\n" +
+				"    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) " +
+				"REFERENCES public.users(id);\n",
+			expected: ForeignKey{
+				Name:       "orders_user_id_fkey",
+				Schema:     "public",
+				Table:      "orders",
+				Columns:    []string{"user_id"},
+				RefSchema:  "public",
+				RefTable:   "users",
+				RefColumns: []string{"id"},
+			},
+		},
+		{
+			name: "composite key with actions",
+			defn: "ALTER TABLE public.items\n" +
+				"    ADD CONSTRAINT items_fkey FOREIGN KEY (order_id, \"Shop\") " +
+				"REFERENCES public.orders(id, shop) ON DELETE CASCADE NOT VALID;\n",
+			expected: ForeignKey{
+				Name:       "items_fkey",
+				Schema:     "public",
+				Table:      "items",
+				Columns:    []string{"order_id", `"Shop"`},
+				RefSchema:  "public",
+				RefTable:   "orders",
+				RefColumns: []string{"id", "shop"},
+			},
+		},
+		{
+			name: "quoted names",
+			defn: "ALTER TABLE ONLY \"My\".\"Orders\"\n" +
+				"    ADD CONSTRAINT \"Orders_fkey\" FOREIGN KEY (\"userId\") " +
+				"REFERENCES \"My\".\"Users\"(\"Id\");\n",
+			expected: ForeignKey{
+				Name:       "Orders_fkey",
+				Schema:     "My",
+				Table:      "Orders",
+				Columns:    []string{`"userId"`},
+				RefSchema:  "My",
+				RefTable:   "Users",
+				RefColumns: []string{`"Id"`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fk, err := ParseForeignKey(tt.defn)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, *fk)
+		})
+	}
+}
+
+func TestParseForeignKey_Invalid(t *testing.T) {
+	for _, defn := range []string{
+		"ALTER TABLE ONLY public.orders\n    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);\n",
+		"ALTER TABLE public.orders ADD CONSTRAINT fk FOREIGN KEY (a, b) REFERENCES public.u(id);",
+		"CREATE INDEX i ON public.orders USING btree (user_id);\n",
+	} {
+		_, err := ParseForeignKey(defn)
+		assert.Error(t, err, defn)
+	}
+}
+
+func TestDump_GetForeignKeys(t *testing.T) {
+	dump := &Dump{
+		foreignKeys: []*ForeignKey{
+			{Id: 5, Name: "dropped"},
+			{Id: 6, Name: "kept"},
+			{Name: "plain"},
+		},
+		dropped: map[int]struct{}{5: {}},
+	}
+
+	fks := dump.GetForeignKeys()
+	require.Len(t, fks, 2)
+	assert.Equal(t, "kept", fks[0].Name)
+	assert.Equal(t, "plain", fks[1].Name)
+}
+
+func TestForeignKeysFromToc(t *testing.T) {
+	toc := &Toc{Entries: []*TocEntry{
+		{DumpId: 1, Desc: TABLE, Tag: "orders"},
+		{
+			DumpId: 7,
+			Desc:   FK_CONSTRAINT,
+			Tag:    "orders orders_user_id_fkey",
+			Defn: "ALTER TABLE ONLY public.orders\n" +
+				"    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) " +
+				"REFERENCES public.users(id);\n",
+		},
+		{DumpId: 8, Desc: FK_CONSTRAINT, Tag: "orders broken", Defn: "defn"},
+	}}
+
+	fks := foreignKeysFromToc(toc)
+	require.Len(t, fks, 1)
+	assert.Equal(t, 7, fks[0].Id)
+	assert.Equal(t, "orders_user_id_fkey", fks[0].Name)
+}
+
+func TestDump_GetForeignKeyTables(t *testing.T) {
+	users := &Entity{Id: 1, Meta: EntityMeta{Schema: "public", Name: "users"}, Table: &TableMeta{}}
+	events := &Entity{Id: 2, Meta: EntityMeta{Schema: "audit", Name: "events"}, Table: &TableMeta{}}
+	dump := &Dump{Entities: map[string]*Entity{"users": users, "events": events}}
+
+	// GIVEN: A foreign key between the dumped tables, a qualified and an unqualified one.
+	child, parent, err := dump.GetForeignKeyTables(&ForeignKey{
+		Schema: "audit", Table: "events", RefSchema: "public", RefTable: "users",
+	})
+	require.NoError(t, err)
+	assert.Same(t, events, child)
+	assert.Same(t, users, parent)
+	_, _, err = dump.GetForeignKeyTables(&ForeignKey{Table: "events", RefTable: "users"})
+	require.NoError(t, err)
+
+	// THEN: A foreign key of a same-named table of another schema is not attached to it.
+	_, _, err = dump.GetForeignKeyTables(&ForeignKey{
+		Schema: "audit", Table: "events", RefSchema: "audit", RefTable: "users",
+	})
+	assert.ErrorIs(t, err, ErrSchemaMismatch)
+	assert.ErrorContains(t, err, "audit.users, the dumped users is public.users")
+
+	// AND: A missing table is not a schema mismatch.
+	_, _, err = dump.GetForeignKeyTables(&ForeignKey{Table: "orders", RefTable: "users"})
+	assert.ErrorContains(t, err, "entity orders does not exist")
+	assert.NotErrorIs(t, err, ErrSchemaMismatch)
+}
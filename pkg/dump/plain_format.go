@@ -0,0 +1,459 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+// Plain dumps are SQL scripts with table data embedded as COPY blocks:
+//
+//	COPY public.users (id, name) FROM stdin;
+//	1	foo
+//	\.
+//
+// Each COPY block is exposed as a TABLE DATA entity, the dump id of the entity
+// is the position of the block in the script starting from 1.
+
+// plainBlock is the location of COPY block data within the uncompressed script.
+type plainBlock struct {
+	offset int64
+	size   int64
+}
+
+// loadPlainDump handles loading metadata for a plain SQL dump, optionally gzipped.
+// Table data is read directly from the script until it is rewritten by a command.
+func loadPlainDump(cfg *config.Config) (*Dump, error) {
+	dump := &Dump{Entities: make(map[string]*Entity)}
+	if err := dump.initStaging(cfg.Destination); err != nil {
+		return nil, err
+	}
+
+	reader, err := dump.openPlainSource(cfg.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	scanner := newPlainScanner(reader)
+	defns := make(map[string]*TableDefn)
+	blockId := 0
+	for {
+		stmt, kind, err := scanner.nextStatement()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read script: %w", err)
+		}
+		switch kind {
+		case plainCreateTable:
+			readPlainTableDefn(string(stmt), defns)
+			continue
+		case plainAlterTable:
+			readPlainForeignKey(string(stmt), dump)
+			continue
+		case plainOther:
+			continue
+		}
+		blockId++
+
+		table, err := TableMetaFromCopyStmt(string(stmt))
+		if err != nil {
+			return nil, fmt.Errorf("cannot load table metadata: %w", err)
+		}
+		if defn, ok := defns[unquoteIdent(table.Schema)+"."+table.Name]; ok {
+			table.SetColumnTypes(defn)
+		}
+
+		block := plainBlock{offset: scanner.pos}
+		if err := scanner.skipCopyData(); err != nil {
+			return nil, fmt.Errorf("cannot read COPY data of %s: %w", table.Name, err)
+		}
+		block.size = scanner.pos - block.offset
+
+		entity := &Entity{
+			Id: blockId,
+			Meta: EntityMeta{
+				DumpId: blockId,
+				Desc:   TABLE_DATA,
+				Schema: table.Schema,
+				Name:   table.Name,
+			},
+			Table: table,
+		}
+		entity.DumpHandler = dumpio.NewStagedDumpHandler(
+			dump.stagedDataPath(entity.Id),
+			func() (io.ReadCloser, error) {
+				return openPlainBlock(dump.script, block)
+			},
+		)
+
+		// tables are addressed by name, so same-named tables of several schemas are ambiguous
+		if other, exists := dump.Entities[table.Name]; exists {
+			if other.Meta.Schema != table.Schema {
+				return nil, fmt.Errorf(
+					"table %s is dumped from the schemas %s and %s, tables are addressed by name",
+					table.Name, other.Meta.Schema, table.Schema,
+				)
+			}
+			log.Printf("[WARN] Table %s has several COPY blocks, only the last one is used", table.Name)
+		}
+		dump.Entities[table.Name] = entity
+	}
+
+	return dump, nil
+}
+
+// openPlainScript opens the script and decompresses it if it is gzipped.
+func openPlainScript(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open script: %w", err)
+	}
+
+	compressed, err := isGzipFile(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !compressed {
+		return file, nil
+	}
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot open gzip script: %w", err)
+	}
+	return &readCloser{
+		Reader: gr,
+		close: func() error {
+			err := gr.Close()
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		},
+	}, nil
+}
+
+// openPlainSource opens the script for loading and sets the uncompressed script
+// COPY blocks are read from. A gzipped script is decompressed into the staging
+// directory while it is loaded, so blocks are read by offset from the copy
+// instead of decompressing the script again for each of them.
+func (d *Dump) openPlainSource(path string) (io.ReadCloser, error) {
+	reader, err := openPlainScript(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := reader.(*os.File); ok {
+		d.script = path
+		return reader, nil
+	}
+
+	script, err := os.Create(d.stagedScriptPath())
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("cannot create uncompressed script: %w", err)
+	}
+	d.script = script.Name()
+	return &readCloser{
+		Reader: io.TeeReader(reader, script),
+		close: func() error {
+			return errors.Join(reader.Close(), script.Close())
+		},
+	}, nil
+}
+
+// isGzipFile checks the gzip magic bytes and rewinds the file.
+func isGzipFile(file *os.File) (bool, error) {
+	magic := make([]byte, 2)
+	n, err := io.ReadFull(file, magic)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, fmt.Errorf("cannot read file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("seek error: %w", err)
+	}
+	return n == 2 && magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// openPlainBlock returns a reader of the COPY block data within the uncompressed script.
+func openPlainBlock(path string, block plainBlock) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open script: %w", err)
+	}
+	if _, err := file.Seek(block.offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot seek to COPY block: %w", err)
+	}
+	return &readCloser{Reader: io.LimitReader(file, block.size), close: file.Close}, nil
+}
+
+// isCreateTable reports whether the line starts a CREATE TABLE statement.
+func isCreateTable(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("CREATE TABLE ")) ||
+		bytes.HasPrefix(line, []byte("CREATE UNLOGGED TABLE "))
+}
+
+// readPlainTableDefn stores the definition parsed from the CREATE TABLE statement
+// by the qualified table name.
+func readPlainTableDefn(stmt string, defns map[string]*TableDefn) {
+	defn, err := ParseCreateTable(stmt)
+	if err != nil {
+		log.Printf("[WARN] Column types are unknown: %v", err)
+		return
+	}
+	defns[defn.Schema+"."+defn.Name] = defn
+}
+
+// isAlterTable reports whether the line starts an ALTER TABLE statement.
+func isAlterTable(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("ALTER TABLE "))
+}
+
+// readPlainForeignKey adds the foreign key to the dump if the ALTER TABLE statement defines one.
+func readPlainForeignKey(stmt string, dump *Dump) {
+	if !strings.Contains(stmt, " FOREIGN KEY ") {
+		return
+	}
+
+	fk, err := ParseForeignKey(stmt)
+	if err != nil {
+		log.Printf("[WARN] Foreign key is skipped: %v", err)
+		return
+	}
+	dump.foreignKeys = append(dump.foreignKeys, fk)
+}
+
+// isCopyFromStdin reports whether the line is a COPY ... FROM stdin statement.
+func isCopyFromStdin(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return bytes.HasPrefix(line, []byte("COPY ")) && bytes.HasSuffix(line, []byte("FROM stdin;"))
+}
+
+// plainScanner reads the script line by line and tracks the position in it.
+type plainScanner struct {
+	r    *bufio.Reader
+	buf  []byte
+	stmt []byte
+	pos  int64
+}
+
+func newPlainScanner(r io.Reader) *plainScanner {
+	return &plainScanner{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// next returns the next line including the line break.
+// The line is valid until the next call.
+func (s *plainScanner) next() ([]byte, error) {
+	line, err := s.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		s.buf = append(s.buf[:0], line...)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			line, err = s.r.ReadSlice('\n')
+			s.buf = append(s.buf, line...)
+		}
+		line = s.buf
+	}
+	s.pos += int64(len(line))
+
+	if errors.Is(err, io.EOF) && len(line) > 0 {
+		return line, nil
+	}
+	return line, err
+}
+
+// plainStmtKind is the kind of a statement returned by nextStatement.
+type plainStmtKind int
+
+const (
+	plainOther plainStmtKind = iota
+	plainCreateTable
+	plainAlterTable
+	plainCopy
+)
+
+// nextStatement returns the next statement including the line breaks: a whole
+// CREATE TABLE or ALTER TABLE statement, a COPY ... FROM stdin line followed by
+// the COPY data, or any other single line. Loading and writing the script both
+// tokenize it this way, so they agree on the positions of COPY blocks.
+// The statement is valid until the next call.
+func (s *plainScanner) nextStatement() ([]byte, plainStmtKind, error) {
+	line, err := s.next()
+	if err != nil {
+		return nil, plainOther, err
+	}
+
+	var kind plainStmtKind
+	switch {
+	case isCreateTable(line):
+		kind = plainCreateTable
+	case isAlterTable(line):
+		kind = plainAlterTable
+	case isCopyFromStdin(line):
+		return line, plainCopy, nil
+	default:
+		return line, plainOther, nil
+	}
+
+	// the statement is read up to the line ending with ';'
+	s.stmt = append(s.stmt[:0], line...)
+	for !bytes.HasSuffix(bytes.TrimSpace(line), []byte(";")) {
+		if line, err = s.next(); errors.Is(err, io.EOF) {
+			return nil, kind, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, kind, err
+		}
+		s.stmt = append(s.stmt, line...)
+	}
+	return s.stmt, kind, nil
+}
+
+// skipCopyData skips COPY data lines up to and including the end marker
+// and the blank line following it.
+func (s *plainScanner) skipCopyData() error {
+	return s.copyCopyData(io.Discard)
+}
+
+// copyCopyData copies COPY data lines up to and including the end marker
+// and the blank line following it to w.
+func (s *plainScanner) copyCopyData(w io.Writer) error {
+	for {
+		line, err := s.next()
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		if bytes.Equal(bytes.TrimRight(line, "\r\n"), []byte("\\.")) {
+			break
+		}
+	}
+
+	// pg_dump separates the end marker from the next statement with a blank line
+	next, err := s.r.Peek(1)
+	if err == nil && next[0] == '\n' {
+		if _, err := s.r.Discard(1); err != nil {
+			return err
+		}
+		s.pos++
+		_, err = w.Write([]byte("\n"))
+		return err
+	}
+	return nil
+}
+
+// savePlainDump writes the rewritten script to the destination in one pass.
+// Rewritten COPY blocks are taken from the staging directory, everything else
+// is copied as is from the uncompressed script. The script is gzipped if the source
+// script is, unless the output compression is configured.
+func savePlainDump(cfg *config.Config, dump *Dump) error {
+	src, err := os.Open(cfg.Source)
+	if err != nil {
+		return fmt.Errorf("cannot open source script: %w", err)
+	}
+	compressed, err := isGzipFile(src)
+	src.Close()
+	if err != nil {
+		return err
+	}
+	if cfg.Output.Compression != "" {
+		compressed = cfg.Output.Compression == config.GZIP_COMPRESSION
+	}
+
+	reader, err := os.Open(dump.script)
+	if err != nil {
+		return fmt.Errorf("cannot open script: %w", err)
+	}
+	defer reader.Close()
+
+	err = replaceFile(cfg.Destination, func(file *os.File) error {
+		bw := bufio.NewWriterSize(file, 64*1024)
+		var w io.Writer = bw
+		var gw io.WriteCloser
+		if compressed {
+			if gw, err = dumpio.GzipCodec.NewWriter(bw, cfg.Output.Level); err != nil {
+				return err
+			}
+			w = gw
+		}
+
+		if err := writePlainScript(w, reader, dump); err != nil {
+			return err
+		}
+		if gw != nil {
+			if err := gw.Close(); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write plain script: %w", err)
+	}
+	log.Printf("[INFO] Plain script written: %s", cfg.Destination)
+	return nil
+}
+
+func writePlainScript(w io.Writer, r io.Reader, dump *Dump) error {
+	scanner := newPlainScanner(r)
+	blockId := 0
+	for {
+		stmt, kind, err := scanner.nextStatement()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot read script: %w", err)
+		}
+		if _, err := w.Write(stmt); err != nil {
+			return err
+		}
+		if kind != plainCopy {
+			continue
+		}
+
+		blockId++
+		staged, err := dump.isStaged(blockId)
+		if err != nil {
+			return err
+		}
+		if !staged {
+			if err := scanner.copyCopyData(w); err != nil {
+				return fmt.Errorf("cannot copy COPY block %d: %w", blockId, err)
+			}
+			continue
+		}
+
+		if err := scanner.skipCopyData(); err != nil {
+			return fmt.Errorf("cannot skip COPY block %d: %w", blockId, err)
+		}
+		if err := copyStaged(w, dump, blockId); err != nil {
+			return fmt.Errorf("cannot write COPY block %d: %w", blockId, err)
+		}
+	}
+}
+
+func copyStaged(w io.Writer, dump *Dump, dumpId int) error {
+	reader, err := dump.openStaged(dumpId)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(w, reader)
+	return err
+}
@@ -0,0 +1,234 @@
+package dump
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+const plainTestScript = `--
+-- PostgreSQL database dump
+--
+
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    name text
+);
+
+--
+-- Data for Name: users; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public.users (id, name) FROM stdin;
+1	foo
+2	bar
+\.
+
+
+--
+-- Data for Name: orders; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public.orders (id, user_id) FROM stdin;
+10	1
+\.
+
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id);
+`
+
+func buildPlainScript(t *testing.T, path string, compressed bool) {
+	data := []byte(plainTestScript)
+	if compressed {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, err := gw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+		data = buf.Bytes()
+	}
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func readPlainScript(t *testing.T, path string) string {
+	reader, err := openPlainScript(path)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func plainTestConfig(src, dest string) *config.Config {
+	return &config.Config{
+		Source:      src,
+		Destination: dest,
+		Format:      config.PLAIN_FORMAT,
+	}
+}
+
+func TestLoadPlainDump(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src.sql")
+		buildPlainScript(t, src, compressed)
+
+		dump, err := LoadDump(plainTestConfig(src, filepath.Join(dir, "dest.sql")))
+		require.NoError(t, err)
+
+		require.Len(t, dump.Entities, 2)
+		users, err := dump.GetTable("users")
+		require.NoError(t, err)
+		assert.Equal(t, 1, users.Id)
+		assert.Equal(t, "public", users.Meta.Schema)
+		assert.Equal(t, []string{"id", "name"}, users.Table.SortedColumns)
+		assert.Equal(t, "integer", users.Table.Columns["id"].Type)
+		assert.True(t, users.Table.Columns["id"].NotNull)
+		assert.Equal(t, "text", users.Table.Columns["name"].Type)
+
+		fks := dump.GetForeignKeys()
+		require.Len(t, fks, 1)
+		assert.Equal(t, "orders", fks[0].Table)
+		assert.Equal(t, []string{"user_id"}, fks[0].Columns)
+		assert.Equal(t, "users", fks[0].RefTable)
+		assert.Equal(t, []string{"id"}, fks[0].RefColumns)
+
+		assert.Equal(t, "1\tfoo\n2\tbar\n\\.\n\n", readTableData(t, dump, "users"))
+		assert.Equal(t, "10\t1\n\\.\n\n", readTableData(t, dump, "orders"))
+		require.NoError(t, dump.Close())
+	}
+}
+
+func TestLoadPlainDump_GzipDecompressedOnce(t *testing.T) {
+	// GIVEN: A loaded gzipped script.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.sql.gz")
+	buildPlainScript(t, src, true)
+	dump, err := LoadDump(plainTestConfig(src, filepath.Join(dir, "dest.sql")))
+	require.NoError(t, err)
+	defer dump.Close()
+
+	// WHEN: The gzipped script is gone.
+	require.NoError(t, os.Remove(src))
+
+	// THEN: COPY blocks are read from the uncompressed copy made while loading.
+	assert.Equal(t, "10\t1\n\\.\n\n", readTableData(t, dump, "orders"))
+	assert.Equal(t, "1\tfoo\n2\tbar\n\\.\n\n", readTableData(t, dump, "users"))
+}
+
+func TestLoadPlainDump_SchemaCollision(t *testing.T) {
+	// GIVEN: A script with the tables a.t and b.t.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.sql")
+	script := "COPY a.t (id) FROM stdin;\n1\n\\.\n\nCOPY b.t (id) FROM stdin;\n2\n\\.\n"
+	require.NoError(t, os.WriteFile(src, []byte(script), 0o644))
+
+	// WHEN: The dump is loaded.
+	_, err := LoadDump(plainTestConfig(src, filepath.Join(dir, "dest.sql")))
+
+	// THEN: The tables can not be addressed by name, so loading fails.
+	assert.ErrorContains(t, err, "table t is dumped from the schemas a and b")
+}
+
+func TestSavePlainDump(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src.sql")
+		cfg := plainTestConfig(src, filepath.Join(dir, "dest.sql"))
+		buildPlainScript(t, src, compressed)
+
+		dump, err := LoadDump(cfg)
+		require.NoError(t, err)
+
+		// untouched script is copied as is
+		require.NoError(t, SaveDump(cfg, dump))
+		assert.Equal(t, plainTestScript, readPlainScript(t, cfg.Destination))
+
+		entity, err := dump.GetTable("users")
+		require.NoError(t, err)
+		writer := entity.DumpHandler.GetWriter()
+		require.NoError(t, writer.Open())
+		_, err = writer.Write([]byte("2\tbar\n\\.\n\n"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		require.NoError(t, SaveDump(cfg, dump))
+		require.NoError(t, dump.Close())
+
+		expected := bytes.Replace([]byte(plainTestScript), []byte("1\tfoo\n"), nil, 1)
+		assert.Equal(t, string(expected), readPlainScript(t, cfg.Destination))
+
+		isCompressed, err := isGzipFileAt(cfg.Destination)
+		require.NoError(t, err)
+		assert.Equal(t, compressed, isCompressed)
+	}
+}
+
+func TestSavePlainDump_CopyLineInStatement(t *testing.T) {
+	// GIVEN: A CREATE TABLE statement with a line looking like a COPY statement.
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.sql")
+	cfg := plainTestConfig(src, filepath.Join(dir, "dest.sql"))
+	script := "CREATE TABLE public.notes (\n" +
+		"    body text DEFAULT '\nCOPY public.fake (id) FROM stdin;\n'::text\n" +
+		");\n\n" +
+		"COPY public.notes (body) FROM stdin;\nfoo\n\\.\n\n"
+	require.NoError(t, os.WriteFile(src, []byte(script), 0o644))
+
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+	defer dump.Close()
+	require.Len(t, dump.Entities, 1)
+
+	// WHEN: The table is rewritten and the script is saved.
+	entity, err := dump.GetTable("notes")
+	require.NoError(t, err)
+	writer := entity.DumpHandler.GetWriter()
+	require.NoError(t, writer.Open())
+	_, err = writer.Write([]byte("bar\n\\.\n\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, SaveDump(cfg, dump))
+
+	// THEN: The rewritten block replaces the COPY block found by the load.
+	expected := bytes.Replace([]byte(script), []byte("foo\n"), []byte("bar\n"), 1)
+	assert.Equal(t, string(expected), readPlainScript(t, cfg.Destination))
+}
+
+func isGzipFileAt(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return isGzipFile(file)
+}
+
+func TestSavePlainDump_OutputCompression(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.sql.gz")
+	cfg := plainTestConfig(src, filepath.Join(dir, "dest.sql"))
+	cfg.Output = config.Output{Compression: config.NONE_COMPRESSION}
+	buildPlainScript(t, src, true)
+
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+	require.NoError(t, SaveDump(cfg, dump))
+	require.NoError(t, dump.Close())
+
+	data, err := os.ReadFile(cfg.Destination)
+	require.NoError(t, err)
+	assert.Equal(t, plainTestScript, string(data))
+}
@@ -0,0 +1,114 @@
+package dump
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+// Single-file archives can't be rewritten in place, so rewritten entity data
+// is staged to a temporary directory next to the destination and the archive
+// is assembled from the staged and the untouched source data on save.
+
+// initStaging creates the staging directory for the given destination file.
+func (d *Dump) initStaging(dest string) error {
+	dir, name := filepath.Split(dest)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("mkdir destination error: %w", err)
+	}
+
+	stagingDir, err := os.MkdirTemp(dir, "."+name+".chisel-")
+	if err != nil {
+		return fmt.Errorf("cannot create staging directory: %w", err)
+	}
+	d.stagingDir = stagingDir
+	log.Printf("[DEBUG] Staging directory created: %s", stagingDir)
+	return nil
+}
+
+// stagedDataPath returns the path of the staged data of the TOC entry.
+func (d *Dump) stagedDataPath(dumpId int) string {
+	return filepath.Join(d.stagingDir, fmt.Sprintf("%d.dat.gz", dumpId))
+}
+
+// stagedScriptPath returns the path of the uncompressed copy of a gzipped plain script.
+func (d *Dump) stagedScriptPath() string {
+	return filepath.Join(d.stagingDir, "script.sql")
+}
+
+// isStaged reports whether the data of the TOC entry was rewritten.
+func (d *Dump) isStaged(dumpId int) (bool, error) {
+	if d.stagingDir == "" {
+		return false, nil
+	}
+	if _, err := os.Stat(d.stagedDataPath(dumpId)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat error on staged file: %w", err)
+	}
+	return true, nil
+}
+
+// openStaged opens the decompressed staged data of the TOC entry.
+func (d *Dump) openStaged(dumpId int) (io.ReadCloser, error) {
+	path := d.stagedDataPath(dumpId)
+	reader := dumpio.NewGzipReader(dumpio.NewSourceFileHandler(path, path))
+	if err := reader.Open(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Close releases resources held by the dump, e.g. removes the staging directory.
+func (d *Dump) Close() error {
+	if d.stagingDir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(d.stagingDir); err != nil {
+		return fmt.Errorf("cannot remove staging directory: %w", err)
+	}
+	log.Printf("[DEBUG] Staging directory removed: %s", d.stagingDir)
+	d.stagingDir = ""
+	return nil
+}
+
+// replaceFile writes a file next to dest using write and renames it into place.
+func replaceFile(dest string, write func(file *os.File) error) error {
+	dir, name := filepath.Split(dest)
+	tmpPath := filepath.Join(dir, "tmp_"+name)
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("cannot create file %q: %w", tmpPath, err)
+	}
+
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err = os.Rename(tmpPath, dest); err != nil {
+		return fmt.Errorf("cannot rename temp file to %q: %w", dest, err)
+	}
+	return nil
+}
+
+// readCloser combines a reader with a custom close function.
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *readCloser) Close() error {
+	return rc.close()
+}
@@ -10,6 +10,9 @@ import (
 
 type ColumnMeta struct {
 	Position int
+	// Type and NotNull are taken from the table definition, Type is empty if it is unknown.
+	Type    string
+	NotNull bool
 }
 
 type TableMeta struct {
@@ -47,6 +50,16 @@ func fromByteLine(line []byte) (*TableMeta, error) {
 	return &table, nil
 }
 
+// TableMetaFromCopyStmt builds table metadata from the COPY statement of a TOC entry.
+func TableMetaFromCopyStmt(copyStmt string) (*TableMeta, error) {
+	// example: "COPY public.test_table (id, Name, comment) FROM stdin;\n"
+	line := bytes.TrimSpace([]byte(copyStmt))
+	if !bytes.HasPrefix(line, []byte("COPY ")) || !bytes.HasSuffix(line, []byte("FROM stdin;")) {
+		return nil, fmt.Errorf("unexpected COPY statement: %q", copyStmt)
+	}
+	return fromByteLine(line)
+}
+
 func LoadTableMetaFromFile(filePath string) ([]*TableMeta, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
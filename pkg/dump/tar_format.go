@@ -0,0 +1,378 @@
+package dump
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+	"github.com/zwergpro/pg-chisel/pkg/dump/dumpio"
+)
+
+// The layout of tar archives follows
+// https://github.com/postgres/postgres/blob/master/src/bin/pg_dump/pg_backup_tar.c
+// toc.dat comes first, followed by data members in TOC order and restore.sql.
+
+// tarRestoreScript is the member with the SQL script restoring the extracted archive.
+const tarRestoreScript = "restore.sql"
+
+// tarMember is the location of a member data within the tar archive.
+type tarMember struct {
+	offset int64
+	size   int64
+}
+
+// loadTarDump handles loading metadata for a tar archive.
+// Members are indexed by their offsets, table data is read directly from the archive
+// until it is rewritten by a command.
+func loadTarDump(cfg *config.Config) (*Dump, error) {
+	file, err := os.Open(cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive: %w", err)
+	}
+	defer file.Close()
+
+	var toc *Toc
+	members := make(map[string]tarMember)
+
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read tar header: %w", err)
+		}
+
+		// tar.Reader reads headers block by block, so the file is positioned at the member data.
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("seek error: %w", err)
+		}
+		members[hdr.Name] = tarMember{offset: offset, size: hdr.Size}
+
+		if hdr.Name == cfg.TocFile {
+			if toc, err = ReadToc(tr); err != nil {
+				return nil, fmt.Errorf("cannot read TOC: %w", err)
+			}
+		}
+	}
+
+	if toc == nil {
+		return nil, fmt.Errorf("archive has no %s member", cfg.TocFile)
+	}
+	if toc.Header.Format != TAR_ARCHIVE {
+		return nil, fmt.Errorf("TOC is not a tar archive, got format %d", toc.Header.Format)
+	}
+
+	dump, err := newDumpFromToc(toc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dump.initStaging(cfg.Destination); err != nil {
+		return nil, err
+	}
+
+	for _, entity := range dump.Entities {
+		entry := entity.TocEntry
+		if entity.Meta.Desc != TABLE_DATA || entry.DataFile == "" {
+			continue
+		}
+
+		name, compressed := entry.DataFile, false
+		if _, ok := members[name]; !ok {
+			// archives made by old pg_dump versions may contain compressed members
+			name, compressed = name+".gz", true
+		}
+		member, ok := members[name]
+		if !ok {
+			return nil, fmt.Errorf("archive has no data member %s", entry.DataFile)
+		}
+
+		entity.DumpHandler = dumpio.NewStagedDumpHandler(
+			dump.stagedDataPath(entry.DumpId),
+			func() (io.ReadCloser, error) {
+				return openTarMember(cfg.Source, member, compressed)
+			},
+		)
+	}
+
+	return dump, nil
+}
+
+// openTarMember returns a reader of the member data within the tar archive.
+func openTarMember(path string, member tarMember, compressed bool) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive: %w", err)
+	}
+
+	section := io.NewSectionReader(file, member.offset, member.size)
+	if !compressed {
+		return &readCloser{Reader: section, close: file.Close}, nil
+	}
+
+	gr, err := gzip.NewReader(section)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot open gzip member: %w", err)
+	}
+	return &readCloser{
+		Reader: gr,
+		close: func() error {
+			err := gr.Close()
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		},
+	}, nil
+}
+
+// saveTarDump writes a new tar archive to the destination. Members are written in
+// the source order: the TOC is rebuilt, rewritten data is taken from the staging
+// directory, members of dropped entries are skipped, the statements of dropped
+// entries are removed from restore.sql and all others are copied as is.
+func saveTarDump(cfg *config.Config, dump *Dump) error {
+	toc := dump.BuildToc()
+
+	var tocBuf bytes.Buffer
+	if err := WriteToc(&tocBuf, toc); err != nil {
+		return fmt.Errorf("cannot write TOC: %w", err)
+	}
+
+	entries := make(map[string]*TocEntry)
+	for _, entry := range dump.Toc.Entries {
+		if entry.DataFile != "" {
+			entries[entry.DataFile] = entry
+			entries[entry.DataFile+".gz"] = entry
+		}
+	}
+
+	err := replaceFile(cfg.Destination, func(file *os.File) error {
+		src, err := os.Open(cfg.Source)
+		if err != nil {
+			return fmt.Errorf("cannot open source archive: %w", err)
+		}
+		defer src.Close()
+
+		tr := tar.NewReader(src)
+		tw := tar.NewWriter(file)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("cannot read tar header: %w", err)
+			}
+
+			if hdr.Name == cfg.TocFile {
+				if err := writeTarMember(tw, hdr, &tocBuf, int64(tocBuf.Len())); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if hdr.Name == tarRestoreScript && len(dump.DroppedEntries()) > 0 {
+				script, err := io.ReadAll(tr)
+				if err != nil {
+					return fmt.Errorf("cannot read %s: %w", hdr.Name, err)
+				}
+				script = removeDroppedStatements(script, dump)
+				if err := writeTarMember(
+					tw, hdr, bytes.NewReader(script), int64(len(script)),
+				); err != nil {
+					return err
+				}
+				continue
+			}
+
+			entry, ok := entries[hdr.Name]
+			if !ok {
+				if err := writeTarMember(tw, hdr, tr, hdr.Size); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if dump.IsDropped(entry.DumpId) {
+				log.Printf("[DEBUG] Skip data member of dropped entry: %s", hdr.Name)
+				continue
+			}
+
+			staged, err := dump.isStaged(entry.DumpId)
+			if err != nil {
+				return err
+			}
+			if !staged {
+				if err := writeTarMember(tw, hdr, tr, hdr.Size); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := writeStagedTarMember(tw, hdr, dump, entry); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write tar archive: %w", err)
+	}
+	log.Printf("[INFO] Tar archive written: %s", cfg.Destination)
+	return nil
+}
+
+// writeTarMember writes a member with the source header and the given content.
+func writeTarMember(tw *tar.Writer, src *tar.Header, r io.Reader, size int64) error {
+	hdr := *src
+	hdr.Size = size
+	if err := tw.WriteHeader(&hdr); err != nil {
+		return fmt.Errorf("cannot write tar header of %s: %w", hdr.Name, err)
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return fmt.Errorf("cannot write tar member %s: %w", hdr.Name, err)
+	}
+	return nil
+}
+
+// writeStagedTarMember writes the staged entity data as a member.
+// Compressed members get the staged gzip file as is, otherwise the staged data
+// is read twice, as the member size must be known before its content.
+func writeStagedTarMember(tw *tar.Writer, src *tar.Header, dump *Dump, entry *TocEntry) error {
+	if strings.HasSuffix(src.Name, ".gz") {
+		file, err := os.Open(dump.stagedDataPath(entry.DumpId))
+		if err != nil {
+			return fmt.Errorf("cannot open staged file: %w", err)
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("stat error on staged file: %w", err)
+		}
+		return writeTarMember(tw, src, file, info.Size())
+	}
+
+	size, err := stagedDataSize(dump, entry.DumpId)
+	if err != nil {
+		return err
+	}
+
+	reader, err := dump.openStaged(entry.DumpId)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return writeTarMember(tw, src, reader, size)
+}
+
+func stagedDataSize(dump *Dump, dumpId int) (int64, error) {
+	reader, err := dump.openStaged(dumpId)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	size, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read staged data: %w", err)
+	}
+	return size, nil
+}
+
+// removeDroppedStatements removes the sections of dropped TOC entries from restore.sql.
+// pg_dump starts the section of each entry with a comment naming it:
+//
+//	--
+//	-- Data for Name: users; Type: TABLE DATA; Schema: public; Owner: postgres
+//	--
+//
+// Sections of entries with the same name are matched to the entries in TOC order.
+func removeDroppedStatements(script []byte, dump *Dump) []byte {
+	entries := make(map[string][]*TocEntry)
+	for _, entry := range dump.Toc.Entries {
+		key := restoreScriptKey(entry)
+		entries[key] = append(entries[key], entry)
+	}
+
+	var out bytes.Buffer
+	lines := bytes.SplitAfter(script, []byte("\n"))
+	skip := false
+	for idx, line := range lines {
+		if header, ok := restoreScriptHeader(lines, idx); ok {
+			skip = false
+			if matched := entries[header]; len(matched) > 0 {
+				entries[header] = matched[1:]
+				skip = dump.IsDropped(matched[0].DumpId)
+				if skip {
+					log.Printf("[DEBUG] Remove restore statements of dropped entry: %s", header)
+				}
+			}
+		}
+		if !skip {
+			out.Write(line)
+		}
+	}
+	return out.Bytes()
+}
+
+// restoreScriptHeader reports whether a section comment starts at the line and returns
+// the entry name it holds, the end of the dump is a section of its own.
+func restoreScriptHeader(lines [][]byte, idx int) (string, bool) {
+	if string(lines[idx]) != "--\n" {
+		return "", false
+	}
+	// verbose dumps add the dump id and the dependencies before the name
+	for idx++; idx < len(lines); idx++ {
+		if !bytes.HasPrefix(lines[idx], []byte("-- TOC entry ")) &&
+			!bytes.HasPrefix(lines[idx], []byte("-- Dependencies: ")) {
+			break
+		}
+	}
+	if idx == len(lines) {
+		return "", false
+	}
+
+	line := strings.TrimRight(string(lines[idx]), "\n")
+	switch {
+	case strings.HasPrefix(line, "-- PostgreSQL database dump complete"):
+		return "", true
+	case strings.HasPrefix(line, "-- Name: "):
+		line = strings.TrimPrefix(line, "-- ")
+	case strings.HasPrefix(line, "-- Data for Name: "):
+		line = strings.TrimPrefix(line, "-- Data for ")
+	default:
+		return "", false
+	}
+	if pos := strings.LastIndex(line, "; Tablespace: "); pos >= 0 {
+		line = line[:pos]
+	}
+	return line, true
+}
+
+// restoreScriptKey returns the name of the entry in the section comments of restore.sql.
+func restoreScriptKey(entry *TocEntry) string {
+	sanitize := func(s string, hyphen bool) string {
+		if s == "" && hyphen {
+			return "-"
+		}
+		return strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+	}
+	return fmt.Sprintf(
+		"Name: %s; Type: %s; Schema: %s; Owner: %s",
+		sanitize(entry.Tag, false),
+		entry.Desc,
+		sanitize(entry.Namespace, true),
+		sanitize(entry.Owner, true),
+	)
+}
@@ -0,0 +1,216 @@
+package dump
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zwergpro/pg-chisel/pkg/config"
+)
+
+const tarTestData = "1\tfoo\n2\tbar\n\\.\n\n"
+
+const tarTestPreamble = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+
+`
+
+const tarTestEpilogue = `--
+-- PostgreSQL database dump complete
+--
+
+`
+
+const tarTestRestoreScript = tarTestPreamble + `--
+-- Name: test_table; Type: TABLE; Schema: public; Owner: owner
+--
+
+CREATE TABLE public.test_table (
+    id integer NOT NULL
+);
+
+--
+-- Data for Name: test_table; Type: TABLE DATA; Schema: public; Owner: owner
+--
+
+COPY public.test_table (id, name) FROM stdin;
+\.
+COPY public.test_table (id, name) FROM '$$PATH$$/30.dat';
+
+--
+-- TOC entry 20 (class 2606 OID 1020)
+-- Name: test_table test_table_pkey; Type: CONSTRAINT; Schema: public; Owner: owner
+--
+
+ALTER TABLE ONLY public.test_table
+    ADD CONSTRAINT test_table_pkey PRIMARY KEY (id);
+
+` + tarTestEpilogue
+
+// buildTarArchive writes a tar archive with the same member layout as pg_dump -Ft.
+func buildTarArchive(t *testing.T, path string) {
+	toc, err := ReadToc(bytes.NewReader(buildTestToc(TAR_ARCHIVE, 15)))
+	require.NoError(t, err)
+	toc.Header.Compression = COMPRESSION_NONE
+
+	var tocBuf bytes.Buffer
+	require.NoError(t, WriteToc(&tocBuf, toc))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"toc.dat", tocBuf.Bytes()},
+		{"30.dat", []byte(tarTestData)},
+		{"restore.sql", []byte(tarTestRestoreScript)},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     member.name,
+			Mode:     0o600,
+			Size:     int64(len(member.data)),
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatUSTAR,
+		}))
+		_, err = tw.Write(member.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+func tarTestConfig(src, dest string) *config.Config {
+	return &config.Config{
+		Source:      src,
+		Destination: dest,
+		TocFile:     config.DEFAULT_TOC_FILE,
+		Format:      config.TAR_FORMAT,
+	}
+}
+
+func readTarMember(t *testing.T, path, name string) string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		if hdr.Name == name {
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			return string(data)
+		}
+	}
+}
+
+func tarMemberNames(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var names []string
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	return names
+}
+
+func TestLoadTarDump(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.tar")
+	buildTarArchive(t, src)
+
+	dump, err := LoadDump(tarTestConfig(src, filepath.Join(dir, "dest.tar")))
+	require.NoError(t, err)
+	defer dump.Close()
+
+	assert.Equal(t, TAR_ARCHIVE, dump.Toc.Header.Format)
+	assert.Equal(t, tarTestData, readTableData(t, dump, "test_table"))
+}
+
+func TestSaveTarDump(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.tar")
+	cfg := tarTestConfig(src, filepath.Join(dir, "dest.tar"))
+	buildTarArchive(t, src)
+
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+
+	entity, err := dump.GetTable("test_table")
+	require.NoError(t, err)
+	writer := entity.DumpHandler.GetWriter()
+	require.NoError(t, writer.Open())
+	_, err = writer.Write([]byte("3\tbaz\n\\.\n\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	require.NoError(t, SaveDump(cfg, dump))
+	require.NoError(t, dump.Close())
+
+	assert.Equal(t, []string{"toc.dat", "30.dat", "restore.sql"}, tarMemberNames(t, cfg.Destination))
+	assert.Equal(t, tarTestRestoreScript, readTarMember(t, cfg.Destination, "restore.sql"))
+
+	rewritten, err := LoadDump(tarTestConfig(cfg.Destination, filepath.Join(dir, "x.tar")))
+	require.NoError(t, err)
+	defer rewritten.Close()
+	assert.Len(t, rewritten.Toc.Entries, 3)
+	assert.Equal(t, "3\tbaz\n\\.\n\n", readTableData(t, rewritten, "test_table"))
+}
+
+func TestSaveTarDump_DropTable(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.tar")
+	cfg := tarTestConfig(src, filepath.Join(dir, "dest.tar"))
+	buildTarArchive(t, src)
+
+	dump, err := LoadDump(cfg)
+	require.NoError(t, err)
+	require.NoError(t, dump.DropTable("test_table"))
+	require.NoError(t, SaveDump(cfg, dump))
+	require.NoError(t, dump.Close())
+
+	assert.Equal(t, []string{"toc.dat", "restore.sql"}, tarMemberNames(t, cfg.Destination))
+	assert.Equal(
+		t,
+		tarTestPreamble+tarTestEpilogue,
+		readTarMember(t, cfg.Destination, "restore.sql"),
+		"restore.sql does not reference the dropped entries",
+	)
+}
+
+func TestRemoveDroppedStatements(t *testing.T) {
+	// GIVEN: A dump with the TABLE DATA entry dropped.
+	toc, err := ReadToc(bytes.NewReader(buildTestToc(TAR_ARCHIVE, 15)))
+	require.NoError(t, err)
+	dump := &Dump{Toc: toc, dropped: map[int]struct{}{30: {}}}
+
+	// WHEN: The statements of dropped entries are removed from restore.sql.
+	script := removeDroppedStatements([]byte(tarTestRestoreScript), dump)
+
+	// THEN: Only the data section is removed.
+	assert.NotContains(t, string(script), "TABLE DATA")
+	assert.NotContains(t, string(script), "30.dat")
+	assert.Contains(t, string(script), "CREATE TABLE public.test_table")
+	assert.Contains(t, string(script), "ADD CONSTRAINT test_table_pkey")
+	assert.True(t, strings.HasSuffix(string(script), tarTestEpilogue))
+}
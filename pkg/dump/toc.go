@@ -0,0 +1,491 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// The binary layout of the archive header and TOC entries follows
+// https://github.com/postgres/postgres/blob/master/src/bin/pg_dump/pg_backup_archiver.c
+// (see ReadHead and ReadToc).
+
+const tocMagic = "PGDMP"
+
+// Bounds of the sizes read from the archive, so a corrupt archive is rejected
+// instead of panicking or allocating the size it claims.
+const (
+	maxTocEntries = 1 << 24
+	maxTocString  = 1 << 30 // the largest text value PostgreSQL stores
+)
+
+// ArchiveFormat is the archive format byte stored in the header.
+type ArchiveFormat byte
+
+const (
+	CUSTOM_ARCHIVE    ArchiveFormat = 1
+	TAR_ARCHIVE       ArchiveFormat = 3
+	NULL_ARCHIVE      ArchiveFormat = 4
+	DIRECTORY_ARCHIVE ArchiveFormat = 5
+)
+
+// CompressionAlgorithm is the compression algorithm stored in the header.
+type CompressionAlgorithm byte
+
+const (
+	COMPRESSION_NONE CompressionAlgorithm = 0
+	COMPRESSION_GZIP CompressionAlgorithm = 1
+	COMPRESSION_LZ4  CompressionAlgorithm = 2
+	COMPRESSION_ZSTD CompressionAlgorithm = 3
+)
+
+// Data offset flags of the custom format.
+const (
+	OFFSET_POS_NOT_SET byte = 1
+	OFFSET_POS_SET     byte = 2
+	OFFSET_NO_DATA     byte = 3
+)
+
+// Archive versions that changed the layout of the header or TOC entries.
+const (
+	archiveVersion1_3  = 1<<16 | 3<<8
+	archiveVersion1_5  = 1<<16 | 5<<8
+	archiveVersion1_6  = 1<<16 | 6<<8
+	archiveVersion1_7  = 1<<16 | 7<<8
+	archiveVersion1_8  = 1<<16 | 8<<8
+	archiveVersion1_9  = 1<<16 | 9<<8
+	archiveVersion1_10 = 1<<16 | 10<<8
+	archiveVersion1_11 = 1<<16 | 11<<8
+	archiveVersion1_14 = 1<<16 | 14<<8
+	archiveVersion1_15 = 1<<16 | 15<<8
+	archiveVersion1_16 = 1<<16 | 16<<8
+)
+
+// ArchiveHeader describes the header of a pg_dump archive.
+type ArchiveHeader struct {
+	VersionMajor byte
+	VersionMinor byte
+	VersionRev   byte
+	IntSize      byte
+	OffSize      byte
+	Format       ArchiveFormat
+
+	Compression      CompressionAlgorithm
+	CompressionLevel int // only stored by archives older than 1.15
+
+	// sec, min, hour, mday, mon, year, isdst
+	CreateDate    [7]int
+	DbName        string
+	RemoteVersion string
+	DumpVersion   string
+}
+
+// Version returns the archive version in a comparable form.
+func (h *ArchiveHeader) Version() int {
+	return int(h.VersionMajor)<<16 | int(h.VersionMinor)<<8 | int(h.VersionRev)
+}
+
+// TocEntry is a single entry of the archive table of contents.
+type TocEntry struct {
+	DumpId       int
+	HadDumper    bool
+	TableOID     string
+	OID          string
+	Tag          string
+	Desc         EntityDescType
+	Section      int
+	Defn         string
+	DropStmt     string
+	CopyStmt     string
+	Namespace    string
+	Tablespace   string
+	TableAM      string
+	RelKind      int
+	Owner        string
+	WithOids     string
+	Dependencies []int
+
+	// DataFile is the data file name used by the directory and tar formats.
+	DataFile string
+
+	// DataState and DataOffset locate the data block in the custom format.
+	DataState  byte
+	DataOffset int64
+
+	nulls tocNullFields // string fields stored as NULL in the archive
+}
+
+// tocNullFields is a bit set of TOC entry string fields stored as NULL,
+// it lets the writer reproduce the source entry exactly.
+type tocNullFields uint16
+
+const (
+	nullDefn tocNullFields = 1 << iota
+	nullDropStmt
+	nullCopyStmt
+	nullNamespace
+	nullTablespace
+	nullTableAM
+	nullOwner
+)
+
+// HasData reports whether the entry refers to dumped data.
+func (e *TocEntry) HasData() bool {
+	return e.DataFile != "" || e.DataState == OFFSET_POS_SET || e.DataState == OFFSET_POS_NOT_SET
+}
+
+// Toc represents the header and table of contents of a pg_dump archive.
+type Toc struct {
+	Header  ArchiveHeader
+	Entries []*TocEntry
+}
+
+// ReadTocFile reads the archive header and TOC from the given file.
+func ReadTocFile(filePath string) (*Toc, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("can not open file: %w", err)
+	}
+	defer file.Close()
+
+	return ReadToc(bufio.NewReader(file))
+}
+
+// ReadToc reads the archive header and TOC from r.
+func ReadToc(r io.Reader) (*Toc, error) {
+	return newArchiveReader(r).readToc()
+}
+
+// archiveReader decodes the primitive types used by pg_dump archives.
+type archiveReader struct {
+	r      io.Reader
+	header *ArchiveHeader
+	pos    int64
+	buf    [1]byte
+}
+
+func newArchiveReader(r io.Reader) *archiveReader {
+	return &archiveReader{r: r}
+}
+
+func (ar *archiveReader) readByte() (byte, error) {
+	if _, err := io.ReadFull(ar.r, ar.buf[:]); err != nil {
+		return 0, err
+	}
+	ar.pos++
+	return ar.buf[0], nil
+}
+
+// readBytes reads n bytes, the buffer grows with the data read,
+// so a bogus length fails at the end of the file without being allocated.
+func (ar *archiveReader) readBytes(n int) ([]byte, error) {
+	var buf bytes.Buffer
+	read, err := io.CopyN(&buf, ar.r, int64(n))
+	ar.pos += read
+	if errors.Is(err, io.EOF) && read > 0 {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readInt reads a sign byte followed by IntSize little-endian bytes.
+func (ar *archiveReader) readInt() (int, error) {
+	sign, err := ar.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	res := 0
+	for i := 0; i < int(ar.header.IntSize); i++ {
+		b, err := ar.readByte()
+		if err != nil {
+			return 0, err
+		}
+		res |= int(b) << (8 * i)
+	}
+
+	if sign != 0 {
+		res = -res
+	}
+	return res, nil
+}
+
+// readStr reads a length-prefixed string, a negative length means NULL.
+func (ar *archiveReader) readStr() (string, bool, error) {
+	l, err := ar.readInt()
+	if err != nil {
+		return "", false, err
+	}
+	if l < 0 {
+		return "", false, nil
+	}
+	if l > maxTocString {
+		return "", false, fmt.Errorf("invalid string length %d", l)
+	}
+
+	buf, err := ar.readBytes(l)
+	if err != nil {
+		return "", false, err
+	}
+	return string(buf), true, nil
+}
+
+func (ar *archiveReader) readString() (string, error) {
+	s, _, err := ar.readStr()
+	return s, err
+}
+
+// readNullableString reads a string into dst and marks the field in nulls if it is NULL.
+func (ar *archiveReader) readNullableString(
+	dst *string,
+	nulls *tocNullFields,
+	field tocNullFields,
+) error {
+	s, ok, err := ar.readStr()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		*nulls |= field
+	}
+	*dst = s
+	return nil
+}
+
+// readOffset reads a data offset flag followed by OffSize little-endian bytes.
+func (ar *archiveReader) readOffset() (byte, int64, error) {
+	flag, err := ar.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	switch flag {
+	case OFFSET_POS_NOT_SET, OFFSET_POS_SET, OFFSET_NO_DATA:
+	default:
+		return 0, 0, fmt.Errorf("unexpected data offset flag %d", flag)
+	}
+
+	var off int64
+	for i := 0; i < int(ar.header.OffSize); i++ {
+		b, err := ar.readByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		if i >= 8 {
+			if b != 0 {
+				return 0, 0, errors.New("file offset is too large")
+			}
+			continue
+		}
+		off |= int64(b) << (8 * i)
+	}
+	return flag, off, nil
+}
+
+func (ar *archiveReader) readToc() (*Toc, error) {
+	toc := &Toc{}
+	if err := ar.readHeader(&toc.Header); err != nil {
+		return nil, fmt.Errorf("header parse error: %w", err)
+	}
+
+	count, err := ar.readInt()
+	if err != nil {
+		return nil, fmt.Errorf("TOC size parse error: %w", err)
+	}
+	if count < 0 || count > maxTocEntries {
+		return nil, fmt.Errorf("invalid TOC size %d", count)
+	}
+
+	toc.Entries = make([]*TocEntry, 0, count)
+	for i := 0; i < count; i++ {
+		entry, err := ar.readTocEntry()
+		if err != nil {
+			return nil, fmt.Errorf("TOC entry[%d] parse error: %w", i, err)
+		}
+		toc.Entries = append(toc.Entries, entry)
+	}
+	return toc, nil
+}
+
+func (ar *archiveReader) readHeader(h *ArchiveHeader) error {
+	magic, err := ar.readBytes(len(tocMagic))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(magic, []byte(tocMagic)) {
+		return errors.New("did not find magic string in file header")
+	}
+
+	fields := []*byte{&h.VersionMajor, &h.VersionMinor, &h.VersionRev, &h.IntSize, &h.OffSize}
+	for _, field := range fields {
+		if *field, err = ar.readByte(); err != nil {
+			return err
+		}
+	}
+	ar.header = h
+
+	if h.Version() < archiveVersion1_7 {
+		return fmt.Errorf("unsupported archive version %d.%d", h.VersionMajor, h.VersionMinor)
+	}
+	if h.IntSize == 0 || h.IntSize > 8 {
+		return fmt.Errorf("unsupported integer size %d", h.IntSize)
+	}
+
+	format, err := ar.readByte()
+	if err != nil {
+		return err
+	}
+	h.Format = ArchiveFormat(format)
+
+	if h.Version() >= archiveVersion1_15 {
+		algorithm, err := ar.readByte()
+		if err != nil {
+			return err
+		}
+		h.Compression = CompressionAlgorithm(algorithm)
+	} else {
+		if h.CompressionLevel, err = ar.readInt(); err != nil {
+			return err
+		}
+		if h.CompressionLevel != 0 {
+			h.Compression = COMPRESSION_GZIP
+		}
+	}
+
+	for i := range h.CreateDate {
+		if h.CreateDate[i], err = ar.readInt(); err != nil {
+			return err
+		}
+	}
+	if h.DbName, err = ar.readString(); err != nil {
+		return err
+	}
+
+	if h.Version() >= archiveVersion1_10 {
+		if h.RemoteVersion, err = ar.readString(); err != nil {
+			return err
+		}
+		if h.DumpVersion, err = ar.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ar *archiveReader) readTocEntry() (*TocEntry, error) {
+	var err error
+	e := &TocEntry{}
+	version := ar.header.Version()
+
+	if e.DumpId, err = ar.readInt(); err != nil {
+		return nil, err
+	}
+	hadDumper, err := ar.readInt()
+	if err != nil {
+		return nil, err
+	}
+	e.HadDumper = hadDumper != 0
+
+	if version >= archiveVersion1_8 {
+		if e.TableOID, err = ar.readString(); err != nil {
+			return nil, err
+		}
+	}
+	if e.OID, err = ar.readString(); err != nil {
+		return nil, err
+	}
+	if e.Tag, err = ar.readString(); err != nil {
+		return nil, err
+	}
+	desc, err := ar.readString()
+	if err != nil {
+		return nil, err
+	}
+	e.Desc = EntityDescType(desc)
+
+	if version >= archiveVersion1_11 {
+		if e.Section, err = ar.readInt(); err != nil {
+			return nil, err
+		}
+	}
+	if err = ar.readNullableString(&e.Defn, &e.nulls, nullDefn); err != nil {
+		return nil, err
+	}
+	if err = ar.readNullableString(&e.DropStmt, &e.nulls, nullDropStmt); err != nil {
+		return nil, err
+	}
+	if version >= archiveVersion1_3 {
+		if err = ar.readNullableString(&e.CopyStmt, &e.nulls, nullCopyStmt); err != nil {
+			return nil, err
+		}
+	}
+	if version >= archiveVersion1_6 {
+		if err = ar.readNullableString(&e.Namespace, &e.nulls, nullNamespace); err != nil {
+			return nil, err
+		}
+	}
+	if version >= archiveVersion1_10 {
+		if err = ar.readNullableString(&e.Tablespace, &e.nulls, nullTablespace); err != nil {
+			return nil, err
+		}
+	}
+	if version >= archiveVersion1_14 {
+		if err = ar.readNullableString(&e.TableAM, &e.nulls, nullTableAM); err != nil {
+			return nil, err
+		}
+	}
+	if version >= archiveVersion1_16 {
+		if e.RelKind, err = ar.readInt(); err != nil {
+			return nil, err
+		}
+	}
+	if err = ar.readNullableString(&e.Owner, &e.nulls, nullOwner); err != nil {
+		return nil, err
+	}
+	if version >= archiveVersion1_9 {
+		if e.WithOids, err = ar.readString(); err != nil {
+			return nil, err
+		}
+	}
+
+	if version >= archiveVersion1_5 {
+		for {
+			dep, ok, err := ar.readStr()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break // end of list
+			}
+			depId, err := strconv.Atoi(dep)
+			if err != nil {
+				return nil, fmt.Errorf("dependency parse error: %w", err)
+			}
+			e.Dependencies = append(e.Dependencies, depId)
+		}
+	}
+
+	if err = ar.readExtraTocEntry(e); err != nil {
+		return nil, fmt.Errorf("format specific data parse error: %w", err)
+	}
+	return e, nil
+}
+
+// readExtraTocEntry reads the format specific part of a TOC entry.
+func (ar *archiveReader) readExtraTocEntry(e *TocEntry) error {
+	var err error
+	switch ar.header.Format {
+	case CUSTOM_ARCHIVE:
+		e.DataState, e.DataOffset, err = ar.readOffset()
+	case DIRECTORY_ARCHIVE, TAR_ARCHIVE:
+		e.DataFile, err = ar.readString()
+	default:
+		err = fmt.Errorf("unsupported archive format %d", ar.header.Format)
+	}
+	return err
+}
@@ -0,0 +1,264 @@
+package dump
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tocBuilder encodes archive primitives the same way pg_dump does.
+type tocBuilder struct {
+	bytes.Buffer
+	intSize int
+	offSize int
+}
+
+func newTocBuilder() *tocBuilder {
+	return &tocBuilder{intSize: 4, offSize: 8}
+}
+
+func (b *tocBuilder) int(v int) {
+	sign := byte(0)
+	if v < 0 {
+		sign = 1
+		v = -v
+	}
+	b.WriteByte(sign)
+	for i := 0; i < b.intSize; i++ {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+}
+
+func (b *tocBuilder) str(s string) {
+	b.int(len(s))
+	b.WriteString(s)
+}
+
+func (b *tocBuilder) null() {
+	b.int(-1)
+}
+
+func (b *tocBuilder) offset(flag byte, off int64) {
+	b.WriteByte(flag)
+	for i := 0; i < b.offSize; i++ {
+		b.WriteByte(byte(off >> (8 * i)))
+	}
+}
+
+func (b *tocBuilder) header(format ArchiveFormat, minor byte) {
+	b.WriteString("PGDMP")
+	b.Write([]byte{1, minor, 0, byte(b.intSize), byte(b.offSize), byte(format)})
+	if minor >= 15 {
+		b.WriteByte(byte(COMPRESSION_GZIP))
+	} else {
+		b.int(-1)
+	}
+	for _, v := range []int{1, 2, 3, 4, 5, 124, 0} {
+		b.int(v)
+	}
+	b.str("testdb")
+	b.str("16.4")
+	b.str("16.4")
+}
+
+func (b *tocBuilder) entry(
+	minor byte,
+	format ArchiveFormat,
+	dumpId int,
+	desc, tag, copyStmt string,
+	deps ...int,
+) {
+	b.int(dumpId)
+	b.int(1)
+	b.str("1259")
+	b.str(strconv.Itoa(1000 + dumpId))
+	b.str(tag)
+	b.str(desc)
+	b.int(1)
+	if desc == string(TABLE) {
+		b.str(testTableDefn)
+	} else {
+		b.str("defn")
+	}
+	b.str("drop")
+	b.str(copyStmt)
+	b.str("public")
+	b.str("")
+	b.str("heap")
+	if minor >= 16 {
+		b.int('r')
+	}
+	b.str("owner")
+	b.str("false")
+	for _, dep := range deps {
+		b.str(strconv.Itoa(dep))
+	}
+	b.null()
+
+	switch format {
+	case CUSTOM_ARCHIVE:
+		if desc == string(TABLE_DATA) {
+			b.offset(OFFSET_POS_SET, int64(dumpId)*100)
+		} else {
+			b.offset(OFFSET_NO_DATA, 0)
+		}
+	default:
+		if desc == string(TABLE_DATA) {
+			b.str(strconv.Itoa(dumpId) + ".dat")
+		} else {
+			b.str("")
+		}
+	}
+}
+
+const testTableDefn = "CREATE TABLE public.test_table (\n" +
+	"    id integer NOT NULL,\n" +
+	"    name character varying(255)\n" +
+	");\n"
+
+func buildTestToc(format ArchiveFormat, minor byte) []byte {
+	b := newTocBuilder()
+	b.header(format, minor)
+	b.int(3)
+	b.entry(minor, format, 10, "TABLE", "test_table", "")
+	b.entry(minor, format, 20, "CONSTRAINT", "test_table test_table_pkey", "", 10)
+	b.entry(
+		minor,
+		format,
+		30,
+		"TABLE DATA",
+		"test_table",
+		"COPY public.test_table (id, name) FROM stdin;\n",
+		10,
+	)
+	return b.Bytes()
+}
+
+func TestReadToc_Directory(t *testing.T) {
+	for _, minor := range []byte{14, 15, 16} {
+		toc, err := ReadToc(bytes.NewReader(buildTestToc(DIRECTORY_ARCHIVE, minor)))
+		require.NoError(t, err)
+
+		assert.Equal(t, DIRECTORY_ARCHIVE, toc.Header.Format)
+		assert.Equal(t, COMPRESSION_GZIP, toc.Header.Compression)
+		assert.Equal(t, "testdb", toc.Header.DbName)
+		assert.Equal(t, "16.4", toc.Header.DumpVersion)
+		assert.Equal(t, [7]int{1, 2, 3, 4, 5, 124, 0}, toc.Header.CreateDate)
+		require.Len(t, toc.Entries, 3)
+
+		entry := toc.Entries[2]
+		assert.Equal(t, 30, entry.DumpId)
+		assert.Equal(t, TABLE_DATA, entry.Desc)
+		assert.Equal(t, "test_table", entry.Tag)
+		assert.Equal(t, "public", entry.Namespace)
+		assert.Equal(t, "owner", entry.Owner)
+		assert.Equal(t, "30.dat", entry.DataFile)
+		assert.Equal(t, []int{10}, entry.Dependencies)
+		assert.True(t, entry.HasData())
+		assert.False(t, toc.Entries[0].HasData())
+	}
+}
+
+func TestReadToc_Custom(t *testing.T) {
+	toc, err := ReadToc(bytes.NewReader(buildTestToc(CUSTOM_ARCHIVE, 15)))
+	require.NoError(t, err)
+
+	assert.Equal(t, CUSTOM_ARCHIVE, toc.Header.Format)
+	assert.Equal(t, OFFSET_NO_DATA, toc.Entries[0].DataState)
+	assert.Equal(t, OFFSET_POS_SET, toc.Entries[2].DataState)
+	assert.Equal(t, int64(3000), toc.Entries[2].DataOffset)
+}
+
+func TestReadToc_InvalidMagic(t *testing.T) {
+	_, err := ReadToc(bytes.NewReader([]byte("NOTADUMP")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "magic string")
+}
+
+func TestReadToc_Truncated(t *testing.T) {
+	data := buildTestToc(DIRECTORY_ARCHIVE, 15)
+	_, err := ReadToc(bytes.NewReader(data[:len(data)-10]))
+	require.Error(t, err)
+}
+
+func TestReadToc_InvalidSizes(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *tocBuilder)
+		err   string
+	}{
+		{
+			name:  "negative TOC size",
+			build: func(b *tocBuilder) { b.int(-1) },
+			err:   "invalid TOC size -1",
+		},
+		{
+			name:  "too large TOC size",
+			build: func(b *tocBuilder) { b.int(maxTocEntries + 1) },
+			err:   "invalid TOC size",
+		},
+		{
+			name: "too long string",
+			build: func(b *tocBuilder) {
+				b.int(1)
+				b.int(10) // dump id
+				b.int(1)  // had dumper
+				b.int(maxTocString + 1)
+			},
+			err: "invalid string length",
+		},
+		{
+			name: "string longer than the file",
+			build: func(b *tocBuilder) {
+				b.int(1)
+				b.int(10) // dump id
+				b.int(1)  // had dumper
+				b.int(maxTocString)
+				b.WriteString("table oid")
+			},
+			err: "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN: A corrupt archive claiming an invalid size.
+			b := newTocBuilder()
+			b.header(DIRECTORY_ARCHIVE, 15)
+			tt.build(b)
+
+			// WHEN: The TOC is read.
+			_, err := ReadToc(bytes.NewReader(b.Bytes()))
+
+			// THEN: It fails with an error instead of panicking.
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestNewDumpFromToc(t *testing.T) {
+	toc, err := ReadToc(bytes.NewReader(buildTestToc(DIRECTORY_ARCHIVE, 15)))
+	require.NoError(t, err)
+
+	dump, err := newDumpFromToc(toc)
+	require.NoError(t, err)
+
+	entity, err := dump.GetTable("test_table")
+	require.NoError(t, err)
+	assert.Equal(t, 30, entity.Id)
+	assert.Equal(t, 1030, entity.Meta.OID)
+	assert.Equal(t, []string{"id", "name"}, entity.Table.SortedColumns)
+	assert.Equal(t, "30.dat", entity.dataFileName())
+	assert.Equal(t, "integer", entity.Table.Columns["id"].Type)
+	assert.True(t, entity.Table.Columns["id"].NotNull)
+	assert.Equal(t, "character varying(255)", entity.Table.Columns["name"].Type)
+	assert.False(t, entity.Table.Columns["name"].NotNull)
+
+	constraint := dump.Entities["test_table_pkey"]
+	require.NotNil(t, constraint)
+	assert.Equal(t, CONSTRAINT, constraint.Meta.Desc)
+	assert.Equal(t, "test_table", constraint.Meta.Table)
+}
@@ -0,0 +1,229 @@
+package dump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// WriteTocFile writes the archive header and TOC to the given file.
+// The TOC is written to a temporary file first and then renamed, so an existing
+// file (possibly hard-linked to the source dump) is replaced, not modified.
+func WriteTocFile(filePath string, toc *Toc) error {
+	dir, name := filepath.Split(filePath)
+	tmpPath := filepath.Join(dir, "tmp_"+name)
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("can not create file: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	if err = WriteToc(w, toc); err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("can not write TOC file: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("can not rename TOC file: %w", err)
+	}
+	return nil
+}
+
+// WriteToc writes the archive header and TOC to w using the layout
+// expected by pg_restore for the header version.
+func WriteToc(w io.Writer, toc *Toc) error {
+	aw := newArchiveWriter(w, &toc.Header)
+
+	if err := aw.writeHeader(); err != nil {
+		return fmt.Errorf("header write error: %w", err)
+	}
+	return aw.writeTocEntries(toc.Entries)
+}
+
+// archiveWriter encodes the primitive types used by pg_dump archives.
+// The first write error is kept and all subsequent writes are skipped.
+type archiveWriter struct {
+	w      io.Writer
+	header *ArchiveHeader
+	level  int // compression level of data, dumpio.DEFAULT_LEVEL for the default
+	pos    int64
+	err    error
+}
+
+func newArchiveWriter(w io.Writer, header *ArchiveHeader) *archiveWriter {
+	return &archiveWriter{w: w, header: header}
+}
+
+func (aw *archiveWriter) write(p []byte) {
+	if aw.err != nil {
+		return
+	}
+	n, err := aw.w.Write(p)
+	aw.pos += int64(n)
+	aw.err = err
+}
+
+func (aw *archiveWriter) writeByte(b byte) {
+	aw.write([]byte{b})
+}
+
+// writeInt writes a sign byte followed by IntSize little-endian bytes.
+func (aw *archiveWriter) writeInt(v int) {
+	buf := make([]byte, 1+aw.header.IntSize)
+	if v < 0 {
+		buf[0] = 1
+		v = -v
+	}
+	for i := 1; i < len(buf); i++ {
+		buf[i] = byte(v)
+		v >>= 8
+	}
+	aw.write(buf)
+}
+
+func (aw *archiveWriter) writeString(s string) {
+	aw.writeInt(len(s))
+	aw.write([]byte(s))
+}
+
+// writeNullableString writes s, or NULL when the field is marked in nulls and s is empty.
+func (aw *archiveWriter) writeNullableString(s string, nulls, field tocNullFields) {
+	if s == "" && nulls&field != 0 {
+		aw.writeNull()
+		return
+	}
+	aw.writeString(s)
+}
+
+// writeNull writes a NULL string.
+func (aw *archiveWriter) writeNull() {
+	aw.writeInt(-1)
+}
+
+// writeOffset writes a data offset flag followed by OffSize little-endian bytes.
+func (aw *archiveWriter) writeOffset(flag byte, off int64) {
+	buf := make([]byte, 1+aw.header.OffSize)
+	buf[0] = flag
+	for i := 1; i < len(buf) && i <= 8; i++ {
+		buf[i] = byte(off)
+		off >>= 8
+	}
+	aw.write(buf)
+}
+
+func (aw *archiveWriter) writeHeader() error {
+	h := aw.header
+	if h.Version() < archiveVersion1_7 {
+		return fmt.Errorf("unsupported archive version %d.%d", h.VersionMajor, h.VersionMinor)
+	}
+
+	aw.write([]byte(tocMagic))
+	aw.write([]byte{h.VersionMajor, h.VersionMinor, h.VersionRev, h.IntSize, h.OffSize})
+	aw.writeByte(byte(h.Format))
+
+	if h.Version() >= archiveVersion1_15 {
+		aw.writeByte(byte(h.Compression))
+	} else {
+		aw.writeInt(h.CompressionLevel)
+	}
+
+	for _, v := range h.CreateDate {
+		aw.writeInt(v)
+	}
+	aw.writeString(h.DbName)
+
+	if h.Version() >= archiveVersion1_10 {
+		aw.writeString(h.RemoteVersion)
+		aw.writeString(h.DumpVersion)
+	}
+	return aw.err
+}
+
+func (aw *archiveWriter) writeTocEntries(entries []*TocEntry) error {
+	aw.writeInt(len(entries))
+	for i, entry := range entries {
+		if err := aw.writeTocEntry(entry); err != nil {
+			return fmt.Errorf("TOC entry[%d] write error: %w", i, err)
+		}
+	}
+	return aw.err
+}
+
+func (aw *archiveWriter) writeTocEntry(e *TocEntry) error {
+	version := aw.header.Version()
+
+	aw.writeInt(e.DumpId)
+	if e.HadDumper {
+		aw.writeInt(1)
+	} else {
+		aw.writeInt(0)
+	}
+
+	if version >= archiveVersion1_8 {
+		aw.writeString(e.TableOID)
+	}
+	aw.writeString(e.OID)
+	aw.writeString(e.Tag)
+	aw.writeString(string(e.Desc))
+
+	if version >= archiveVersion1_11 {
+		aw.writeInt(e.Section)
+	}
+	aw.writeNullableString(e.Defn, e.nulls, nullDefn)
+	aw.writeNullableString(e.DropStmt, e.nulls, nullDropStmt)
+	if version >= archiveVersion1_3 {
+		aw.writeNullableString(e.CopyStmt, e.nulls, nullCopyStmt)
+	}
+	if version >= archiveVersion1_6 {
+		aw.writeNullableString(e.Namespace, e.nulls, nullNamespace)
+	}
+	if version >= archiveVersion1_10 {
+		aw.writeNullableString(e.Tablespace, e.nulls, nullTablespace)
+	}
+	if version >= archiveVersion1_14 {
+		aw.writeNullableString(e.TableAM, e.nulls, nullTableAM)
+	}
+	if version >= archiveVersion1_16 {
+		aw.writeInt(e.RelKind)
+	}
+	aw.writeNullableString(e.Owner, e.nulls, nullOwner)
+	if version >= archiveVersion1_9 {
+		if e.WithOids == "" {
+			aw.writeString("false")
+		} else {
+			aw.writeString(e.WithOids)
+		}
+	}
+
+	if version >= archiveVersion1_5 {
+		for _, dep := range e.Dependencies {
+			aw.writeString(strconv.Itoa(dep))
+		}
+		aw.writeNull() // end of list
+	}
+
+	return aw.writeExtraTocEntry(e)
+}
+
+// writeExtraTocEntry writes the format specific part of a TOC entry.
+func (aw *archiveWriter) writeExtraTocEntry(e *TocEntry) error {
+	switch aw.header.Format {
+	case CUSTOM_ARCHIVE:
+		aw.writeOffset(e.DataState, e.DataOffset)
+	case DIRECTORY_ARCHIVE, TAR_ARCHIVE:
+		aw.writeString(e.DataFile)
+	default:
+		return fmt.Errorf("unsupported archive format %d", aw.header.Format)
+	}
+	return aw.err
+}
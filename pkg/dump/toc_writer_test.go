@@ -0,0 +1,92 @@
+package dump
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToc_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		format ArchiveFormat
+		minor  byte
+	}{
+		{DIRECTORY_ARCHIVE, 14},
+		{DIRECTORY_ARCHIVE, 15},
+		{DIRECTORY_ARCHIVE, 16},
+		{CUSTOM_ARCHIVE, 15},
+		{TAR_ARCHIVE, 15},
+	}
+
+	for _, tc := range testCases {
+		source := buildTestToc(tc.format, tc.minor)
+
+		toc, err := ReadToc(bytes.NewReader(source))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteToc(&buf, toc))
+		assert.Equal(t, source, buf.Bytes(), "format %d version 1.%d", tc.format, tc.minor)
+	}
+}
+
+func TestWriteToc_KeepsNullStrings(t *testing.T) {
+	b := newTocBuilder()
+	b.header(DIRECTORY_ARCHIVE, 15)
+	b.int(1)
+	b.int(1)   // dumpId
+	b.int(0)   // hadDumper
+	b.str("0") // tableoid
+	b.str("0") // oid
+	b.str("plpgsql")
+	b.str("EXTENSION")
+	b.int(1) // section
+	b.str("CREATE EXTENSION plpgsql;")
+	b.str("DROP EXTENSION plpgsql;")
+	b.str("") // copyStmt
+	b.null()  // namespace
+	b.null()  // tablespace
+	b.null()  // tableam
+	b.null()  // owner
+	b.str("false")
+	b.null()  // end of dependencies
+	b.str("") // data file
+	source := b.Bytes()
+
+	toc, err := ReadToc(bytes.NewReader(source))
+	require.NoError(t, err)
+	assert.Equal(t, "", toc.Entries[0].Namespace)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteToc(&buf, toc))
+	assert.Equal(t, source, buf.Bytes())
+}
+
+func TestWriteTocFile_ReplacesHardLink(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+
+	source := buildTestToc(DIRECTORY_ARCHIVE, 15)
+	srcPath := filepath.Join(srcDir, "toc.dat")
+	dstPath := filepath.Join(dstDir, "toc.dat")
+	require.NoError(t, os.WriteFile(srcPath, source, 0o644))
+	require.NoError(t, os.Link(srcPath, dstPath))
+
+	toc, err := ReadTocFile(srcPath)
+	require.NoError(t, err)
+	toc.Entries = toc.Entries[:1]
+
+	require.NoError(t, WriteTocFile(dstPath, toc))
+
+	srcContent, err := os.ReadFile(srcPath)
+	require.NoError(t, err)
+	assert.Equal(t, source, srcContent, "source TOC must not be modified")
+
+	written, err := ReadTocFile(dstPath)
+	require.NoError(t, err)
+	assert.Len(t, written.Entries, 1)
+}